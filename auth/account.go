@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	VerifyEmailTokenTTL   = 24 * time.Hour // Lifetime of email verification links
+	ResetPasswordTokenTTL = time.Hour      // Lifetime of password reset links
+)
+
+// Purposes of the one-time tokens sent by email.
+const (
+	purposeVerifyEmail   = "verify-email"
+	purposeResetPassword = "reset-password"
+)
+
+var ErrInvalidLink = errors.New("invalid or expired link") // The one-time token is unknown, used or expired
+
+// oneTimeToken is the server-side record of a token sent by email.
+type oneTimeToken struct {
+	userID    string    // User the token was sent to
+	purpose   string    // Action the token allows
+	email     string    // Email the token was sent to
+	expiresAt time.Time // Time the token expires
+}
+
+// oneTimeTokens holds the tokens sent by email, keyed by the SHA-256 of the token.
+// Tokens are single use, and sending a new token for a purpose invalidates the
+// previous tokens of the user for the same purpose.
+type oneTimeTokens struct {
+	mutex  sync.Mutex
+	tokens map[string]*oneTimeToken
+}
+
+// issue creates a token for the user and purpose.
+func (o *oneTimeTokens) issue(userID, purpose, email string, expiresAt time.Time) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.tokens == nil {
+		o.tokens = make(map[string]*oneTimeToken)
+	}
+	for key, existing := range o.tokens {
+		if existing.userID == userID && existing.purpose == purpose {
+			delete(o.tokens, key)
+		}
+	}
+	o.tokens[hashToken(token)] = &oneTimeToken{
+		userID:    userID,
+		purpose:   purpose,
+		email:     email,
+		expiresAt: expiresAt,
+	}
+	return token, nil
+}
+
+// consume removes the token and returns its record if it is valid for the purpose.
+func (o *oneTimeTokens) consume(token, purpose string, now time.Time) (*oneTimeToken, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	key := hashToken(token)
+	record, ok := o.tokens[key]
+	if !ok || record.purpose != purpose {
+		return nil, ErrInvalidLink
+	}
+	delete(o.tokens, key)
+	if now.After(record.expiresAt) {
+		return nil, ErrInvalidLink
+	}
+	return record, nil
+}
+
+// SendVerificationEmail sends the user a link to verify their email address.
+func (s *AuthService) SendVerificationEmail(user *User) error {
+	token, err := s.oneTimeTokens.issue(user.ID, purposeVerifyEmail, user.Email, s.Tokens.now().Add(VerifyEmailTokenTTL))
+	if err != nil {
+		return err
+	}
+	return s.Mailer.Send(&Mail{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link within 24 hours:\n\n%s/verify-email?token=%s\n",
+			user.Name, s.LinkBaseURL, token),
+	})
+}
+
+// SendPasswordResetEmail sends the user a link to choose a new password.
+func (s *AuthService) SendPasswordResetEmail(user *User) error {
+	token, err := s.oneTimeTokens.issue(user.ID, purposeResetPassword, user.Email, s.Tokens.now().Add(ResetPasswordTokenTTL))
+	if err != nil {
+		return err
+	}
+	return s.Mailer.Send(&Mail{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nChoose a new password by opening this link within an hour:\n\n%s/reset-password?token=%s\n\nIf you did not ask for a new password, ignore this email.\n",
+			user.Name, s.LinkBaseURL, token),
+	})
+}
+
+// VerifyEmailHandler marks the email of a user as verified using the token sent at signup.
+func (s *AuthService) VerifyEmailHandler(c *gin.Context) {
+	var verifyRequest struct {
+		Token string `json:"token"` // Token from the verification link
+	}
+	if err := c.BindJSON(&verifyRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	record, err := s.oneTimeTokens.consume(verifyRequest.Token, purposeVerifyEmail, s.Tokens.now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := s.Users.GetByID(record.userID)
+	// The link is only valid for the address it was sent to
+	if err != nil || user.Email != record.email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidLink.Error()})
+		return
+	}
+	user.EmailVerified = true
+	if err := s.Users.Update(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully", "user": user})
+}
+
+// ResendVerificationHandler sends a new verification link to the authenticated user.
+func (s *AuthService) ResendVerificationHandler(c *gin.Context) {
+	user, err := s.Users.GetByID(CurrentPeer(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already verified"})
+		return
+	}
+	if err := s.SendVerificationEmail(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// ForgotPasswordHandler sends a password reset link to the user with the email.
+// The response is the same whether or not the email is registered, so the
+// endpoint cannot be used to find out which users exist.
+func (s *AuthService) ForgotPasswordHandler(c *gin.Context) {
+	var forgotRequest struct {
+		Email string `json:"email"` // Email of the account to recover
+	}
+	if err := c.BindJSON(&forgotRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	email, err := NormalizeEmail(forgotRequest.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ValidationResponse(ValidationErrors{"email": err.Error()}))
+		return
+	}
+
+	if user, err := s.Users.GetByEmail(email); err == nil {
+		if err := s.SendPasswordResetEmail(user); err != nil {
+			log.Printf("Failed to send password reset email: %v", err)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the email is registered, a password reset link has been sent"})
+}
+
+// ResetPasswordHandler sets a new password using the token of a reset link.
+// Every session and API token of the user is revoked, since the old password may have leaked.
+func (s *AuthService) ResetPasswordHandler(c *gin.Context) {
+	var resetRequest struct {
+		Token    string `json:"token"`    // Token from the reset link
+		Password string `json:"password"` // New password in clear text, never stored
+	}
+	if err := c.BindJSON(&resetRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	// Check the policy first, so a weak password does not burn the link
+	if err := ValidatePassword(resetRequest.Password); err != nil {
+		c.JSON(http.StatusBadRequest, ValidationResponse(ValidationErrors{"password": err.Error()}))
+		return
+	}
+
+	record, err := s.oneTimeTokens.consume(resetRequest.Token, purposeResetPassword, s.Tokens.now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := s.Users.GetByID(record.userID)
+	if err != nil || user.Email != record.email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidLink.Error()})
+		return
+	}
+
+	hash, err := HashPassword(resetRequest.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	user.PasswordHash = hash
+	// Receiving the link proves the user owns the address
+	user.EmailVerified = true
+	if err := s.Users.Update(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// The owner proved who they are, lift a lockout caused by someone guessing
+	s.LoginAccounts.Success(strings.ToLower(user.Name))
+	if err := s.RevokeAllSessions(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
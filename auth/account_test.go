@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// linkToken matches the token of the links sent by email.
+var linkToken = regexp.MustCompile(`token=([0-9a-f]+)`)
+
+// lastLinkToken returns the token of the last link written to the mailbox.
+func lastLinkToken(t *testing.T, mailbox *bytes.Buffer) string {
+	matches := linkToken.FindAllStringSubmatch(mailbox.String(), -1)
+	require.NotEmpty(t, matches, "no link was sent")
+	return matches[len(matches)-1][1]
+}
+
+// accountRouter registers the signup, login and account recovery endpoints.
+func accountRouter(service *AuthService) *gin.Engine {
+	router := gin.New()
+	router.POST("/signup", service.SignupHandler)
+	router.POST("/login", service.LoginHandler)
+	router.POST("/verify-email", service.VerifyEmailHandler)
+	router.POST("/forgot-password", service.ForgotPasswordHandler)
+	router.POST("/reset-password", service.ResetPasswordHandler)
+	authorized := router.Group("/", service.Middleware())
+	authorized.POST("/resend-verification", service.ResendVerificationHandler)
+	authorized.GET("/sessions", service.ListSessionsHandler)
+	return router
+}
+
+func TestVerifyEmail(t *testing.T) {
+	service := newTestAuthService()
+	mailbox := new(bytes.Buffer)
+	service.Mailer = NewLogMailer(mailbox)
+	router := accountRouter(service)
+
+	resp := performJSON(router, "POST", "/signup", `{"name": "jane", "email": "jane@example.com", "password": "password123"}`, "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, mailbox.String(), "To: jane@example.com")
+	assert.Contains(t, mailbox.String(), "http://localhost:8080/verify-email?token=")
+	user, _ := service.Users.GetByName("jane")
+	assert.False(t, user.EmailVerified)
+
+	// A new link invalidates the previous one
+	first := lastLinkToken(t, mailbox)
+	tokens := login(t, service, "jane", "password123")
+	resp = performJSON(router, "POST", "/resend-verification", "", tokens.AccessToken)
+	require.Equal(t, http.StatusOK, resp.Code)
+	resp = performJSON(router, "POST", "/verify-email", `{"token": "`+first+`"}`, "")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	token := lastLinkToken(t, mailbox)
+	resp = performJSON(router, "POST", "/verify-email", `{"token": "`+token+`"}`, "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	user, _ = service.Users.GetByName("jane")
+	assert.True(t, user.EmailVerified)
+
+	// Links are single use
+	resp = performJSON(router, "POST", "/verify-email", `{"token": "`+token+`"}`, "")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	resp = performJSON(router, "POST", "/resend-verification", "", tokens.AccessToken)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+}
+
+func TestResetPassword(t *testing.T) {
+	service := newTestAuthService()
+	mailbox := new(bytes.Buffer)
+	router := accountRouter(service)
+	session := signupAndLogin(t, service, "jane", "password123")
+	_, credential, err := service.CreateAPIToken(userIDOf(t, service, "jane"), "CI bot", []string{ScopeChatWrite}, 0)
+	require.NoError(t, err)
+	service.Mailer = NewLogMailer(mailbox)
+
+	// Unknown emails get the same answer, and no email
+	resp := performJSON(router, "POST", "/forgot-password", `{"email": "nobody@example.com"}`, "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, mailbox.String())
+
+	resp = performJSON(router, "POST", "/forgot-password", `{"email": "JANE@example.com"}`, "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, mailbox.String(), "Subject: Reset your password")
+	token := lastLinkToken(t, mailbox)
+
+	// A weak password is rejected without using up the link
+	resp = performJSON(router, "POST", "/reset-password", `{"token": "`+token+`", "password": "weak"}`, "")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"password"`)
+
+	resp = performJSON(router, "POST", "/reset-password", `{"token": "`+token+`", "password": "newPassword456"}`, "")
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	// Only the new password works and existing sessions are logged out
+	resp = performJSON(router, "POST", "/login", `{"name": "jane", "password": "password123"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	login(t, service, "jane", "newPassword456")
+	resp = performJSON(router, "GET", "/sessions", "", session.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	// API tokens minted with the old password are revoked as well
+	_, err = service.authenticateAPIToken(credential)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	resp = performJSON(router, "POST", "/reset-password", `{"token": "`+token+`", "password": "otherPassword789"}`, "")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer, err := NewFileMailer(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, mailer.Send(&Mail{To: "jane@example.com", Subject: "Hello", Body: "First"}))
+	require.NoError(t, mailer.Send(&Mail{To: "../jane@example.com", Subject: "Hello", Body: "Second"}))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	content, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	require.NoError(t, err)
+	assert.Equal(t, "To: jane@example.com\nSubject: Hello\n\nFirst\n", string(content))
+	assert.NotContains(t, entries[1].Name(), "/")
+}
@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scopes granted to API tokens. Interactive sessions have every scope.
+const (
+	ScopeRoomsRead   = "rooms:read"   // List rooms
+	ScopeRoomsWrite  = "rooms:write"  // Create, join and leave rooms
+	ScopeChatRead    = "chat:read"    // Read room chat
+	ScopeChatWrite   = "chat:write"   // Post to room chat
+	ScopeCompileRun  = "compile:run"  // Run code through /compile
+	ScopeFilesRead   = "files:read"   // List and read files
+	ScopeFilesWrite  = "files:write"  // Create files and join /collab
+	ScopeTerminalRun = "terminal:run" // Run terminal commands through /execute
+	ScopeOrgsRead    = "orgs:read"    // List organizations, their members and workspaces
+	ScopeOrgsWrite   = "orgs:write"   // Manage organizations, their members and workspaces
+)
+
+// Scopes lists every scope an API token can be granted.
+var Scopes = []string{
+	ScopeRoomsRead, ScopeRoomsWrite,
+	ScopeChatRead, ScopeChatWrite,
+	ScopeCompileRun,
+	ScopeFilesRead, ScopeFilesWrite,
+	ScopeTerminalRun,
+	ScopeOrgsRead, ScopeOrgsWrite,
+}
+
+const (
+	DefaultAPITokenLifetime = 30 * 24 * time.Hour  // Lifetime of API tokens created without expiry
+	MaxAPITokenLifetime     = 365 * 24 * time.Hour // Longest lifetime an API token can be given
+
+	apiTokenPrefix            = "cc_"       // Prefix telling API tokens apart from access tokens
+	maxAPITokenNameLength     = 64          // Maximum number of characters in a token name
+	apiTokenIDBytes           = 8           // Random bytes of the public token ID
+	apiTokenSecretBytes       = 32          // Random bytes of the token secret
+	apiTokenLastUsedPrecision = time.Minute // Precision of the recorded last use
+)
+
+var (
+	ErrAPITokenNotFound = errors.New("api token not found")                           // No API token matches the lookup
+	ErrMissingScope     = errors.New("token is missing the required scope")           // The API token does not grant the required scope
+	ErrSessionRequired  = errors.New("this endpoint requires an interactive session") // API tokens cannot be used on the endpoint
+)
+
+// APIToken is a long-lived credential minted by a user for scripts and bots.
+// The token is only shown on creation, in the form "cc_<id>_<secret>", and only
+// the hash of the secret is stored.
+type APIToken struct {
+	ID         string    `json:"id"`         // Public identifier of the token
+	UserID     string    `json:"user_id"`    // User the token acts as
+	Name       string    `json:"name"`       // Name given by the user, such as "CI bot"
+	Scopes     []string  `json:"scopes"`     // Scopes granted to the token
+	SecretHash string    `json:"-"`          // SHA-256 of the token secret
+	CreatedAt  time.Time `json:"created_at"` // Time the token was created
+	ExpiresAt  time.Time `json:"expires_at"` // Time the token expires
+	LastUsed   time.Time `json:"last_used"`  // Time the token was last used, to the minute, zero if never used
+}
+
+// HasScope reports whether the token grants the scope.
+func (t *APIToken) HasScope(scope string) bool {
+	for _, granted := range t.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenStore persists the API tokens.
+type APITokenStore interface {
+	// Create adds a new API token.
+	Create(token *APIToken) error
+
+	// Get returns the API token with the given ID, or ErrAPITokenNotFound.
+	Get(id string) (*APIToken, error)
+
+	// ListByUser returns the API tokens of the user, newest first.
+	ListByUser(userID string) ([]*APIToken, error)
+
+	// Touch records the last use of the token.
+	Touch(id string, lastUsed time.Time) error
+
+	// Delete removes the API token.
+	// Returns ErrAPITokenNotFound if the token does not exist.
+	Delete(id string) error
+}
+
+// MemoryAPITokenStore is an APITokenStore keeping the tokens in memory.
+type MemoryAPITokenStore struct {
+	mutex  sync.RWMutex         // Mutex for safe access to the tokens map
+	tokens map[string]*APIToken // API tokens, keyed by ID
+}
+
+var _ APITokenStore = (*MemoryAPITokenStore)(nil)
+
+// NewMemoryAPITokenStore creates an empty in-memory API token store.
+func NewMemoryAPITokenStore() *MemoryAPITokenStore {
+	return &MemoryAPITokenStore{
+		tokens: make(map[string]*APIToken),
+	}
+}
+
+func (s *MemoryAPITokenStore) Create(token *APIToken) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored := *token
+	stored.Scopes = append([]string(nil), token.Scopes...)
+	s.tokens[token.ID] = &stored
+	return nil
+}
+
+func (s *MemoryAPITokenStore) Get(id string) (*APIToken, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	token, ok := s.tokens[id]
+	if !ok {
+		return nil, ErrAPITokenNotFound
+	}
+	found := *token
+	return &found, nil
+}
+
+func (s *MemoryAPITokenStore) ListByUser(userID string) ([]*APIToken, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var tokens []*APIToken
+	for _, token := range s.tokens {
+		if token.UserID == userID {
+			found := *token
+			tokens = append(tokens, &found)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (s *MemoryAPITokenStore) Touch(id string, lastUsed time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token, ok := s.tokens[id]
+	if !ok {
+		return ErrAPITokenNotFound
+	}
+	token.LastUsed = lastUsed
+	return nil
+}
+
+func (s *MemoryAPITokenStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.tokens[id]; !ok {
+		return ErrAPITokenNotFound
+	}
+	delete(s.tokens, id)
+	return nil
+}
+
+// CreateAPIToken mints a new API token for the user.
+// It returns the stored token and the credential, which cannot be recovered later.
+func (s *AuthService) CreateAPIToken(userID, name string, scopes []string, lifetime time.Duration) (*APIToken, string, error) {
+	errs := ValidationErrors{}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		errs.Add("name", "is required")
+	} else if len(name) > maxAPITokenNameLength {
+		errs.Add("name", "must be at most 64 characters long")
+	}
+	if len(scopes) == 0 {
+		errs.Add("scopes", "at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			errs.Add("scopes", "unknown scope "+scope)
+		}
+	}
+	if lifetime == 0 {
+		lifetime = DefaultAPITokenLifetime
+	}
+	if lifetime < 0 || lifetime > MaxAPITokenLifetime {
+		errs.Add("expires_in_days", "must be between 1 and 365 days")
+	}
+	if err := errs.Err(); err != nil {
+		return nil, "", err
+	}
+
+	id, err := randomToken(apiTokenIDBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomToken(apiTokenSecretBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	now := s.Tokens.now()
+	token := &APIToken{
+		ID:         id,
+		UserID:     userID,
+		Name:       name,
+		Scopes:     dedupeScopes(scopes),
+		SecretHash: hashToken(secret),
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(lifetime),
+	}
+	if err := s.APITokens.Create(token); err != nil {
+		return nil, "", err
+	}
+	return token, apiTokenPrefix + id + "_" + secret, nil
+}
+
+// RevokeAPIToken deletes an API token of the user and closes the websockets it opened.
+// Returns ErrAPITokenNotFound if the token does not belong to the user.
+func (s *AuthService) RevokeAPIToken(userID, tokenID string) error {
+	token, err := s.APITokens.Get(tokenID)
+	if err != nil {
+		return err
+	}
+	if token.UserID != userID {
+		return ErrAPITokenNotFound
+	}
+	if err := s.APITokens.Delete(tokenID); err != nil {
+		return err
+	}
+	s.connections.revoke(tokenID)
+	return nil
+}
+
+// RevokeAllAPITokens deletes every API token of the user and closes the websockets they opened.
+func (s *AuthService) RevokeAllAPITokens(userID string) error {
+	tokens, err := s.APITokens.ListByUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if err := s.RevokeAPIToken(userID, token.ID); err != nil && !errors.Is(err, ErrAPITokenNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// authenticateAPIToken validates an API token credential and returns the
+// claims of the user it acts as.
+func (s *AuthService) authenticateAPIToken(credential string) (*Claims, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(credential, apiTokenPrefix), "_")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	token, err := s.APITokens.Get(id)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(token.SecretHash)) != 1 {
+		return nil, ErrInvalidToken
+	}
+	now := s.Tokens.now()
+	if now.After(token.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	user, err := s.Users.GetByID(token.UserID)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// Writing on every request is wasteful, the last use is only tracked to the minute
+	if now.Sub(token.LastUsed) >= apiTokenLastUsedPrecision {
+		s.APITokens.Touch(token.ID, now.Truncate(apiTokenLastUsedPrecision))
+	}
+
+	claims := &Claims{
+		Name:    user.Name,
+		Email:   user.Email,
+		Address: user.Address,
+		Token:   token,
+	}
+	claims.Subject = user.ID
+	return claims, nil
+}
+
+// isKnownScope reports whether the scope can be granted to API tokens.
+func isKnownScope(scope string) bool {
+	for _, known := range Scopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// dedupeScopes returns the scopes without duplicates, in a stable order.
+func dedupeScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	var unique []string
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// apiTokenRouter registers the token endpoints and a few scoped routes.
+func apiTokenRouter(service *AuthService) *gin.Engine {
+	router := gin.New()
+	authorized := router.Group("/", service.Middleware())
+	sessions := authorized.Group("/", RequireSession())
+	sessions.POST("/tokens", service.CreateAPITokenHandler)
+	sessions.GET("/tokens", service.ListAPITokensHandler)
+	sessions.DELETE("/tokens/:tokenID", service.RevokeAPITokenHandler)
+
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, CurrentPeer(c)) }
+	authorized.POST("/chat", RequireScope(ScopeChatWrite), ok)
+	authorized.GET("/files", RequireScope(ScopeFilesRead), ok)
+	return router
+}
+
+// createAPIToken mints a token through the handler and returns the credential and its ID.
+func createAPIToken(t *testing.T, router http.Handler, accessToken, body string) (string, string) {
+	resp := performJSON(router, "POST", "/tokens", body, accessToken)
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	var created struct {
+		Token    string   `json:"token"`
+		APIToken APIToken `json:"api_token"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+	return created.Token, created.APIToken.ID
+}
+
+func TestAPITokens_ScopeEnforcement(t *testing.T) {
+	service := newTestAuthService()
+	router := apiTokenRouter(service)
+	session := signupAndLogin(t, service, "testUser", "testPassword1")
+
+	credential, tokenID := createAPIToken(t, router, session.AccessToken, `{"name": "CI bot", "scopes": ["chat:write", "compile:run"]}`)
+	assert.True(t, strings.HasPrefix(credential, "cc_"+tokenID+"_"))
+
+	// The token acts as its user, within its scopes
+	resp := performJSON(router, "POST", "/chat", "", credential)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), userIDOf(t, service, "testUser"))
+	resp = performJSON(router, "GET", "/files", "", credential)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Contains(t, resp.Body.String(), ScopeFilesRead)
+
+	// Sessions have every scope
+	resp = performJSON(router, "GET", "/files", "", session.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// API tokens cannot manage credentials
+	resp = performJSON(router, "POST", "/tokens", `{"name": "escalate", "scopes": ["files:read"]}`, credential)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	// A wrong secret is rejected
+	resp = performJSON(router, "POST", "/chat", "", credential[:len(credential)-1]+"x")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	// Listing never returns the secret
+	resp = performJSON(router, "GET", "/tokens", "", session.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"name":"CI bot"`)
+	assert.Contains(t, resp.Body.String(), `"scopes":["chat:write","compile:run"]`)
+	assert.NotContains(t, resp.Body.String(), credential[len("cc_"+tokenID+"_"):])
+
+	// Revoked tokens stop working
+	resp = performJSON(router, "DELETE", "/tokens/"+tokenID, "", session.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp = performJSON(router, "POST", "/chat", "", credential)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	resp = performJSON(router, "DELETE", "/tokens/"+tokenID, "", session.AccessToken)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestAPITokens_ExpiryAndValidation(t *testing.T) {
+	service := newTestAuthService()
+	router := apiTokenRouter(service)
+	session := signupAndLogin(t, service, "testUser", "testPassword1")
+
+	resp := performJSON(router, "POST", "/tokens", `{"name": "", "scopes": ["admin"], "expires_in_days": 400}`, session.AccessToken)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	var body struct {
+		Fields map[string]string `json:"fields"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, map[string]string{
+		"name":            "is required",
+		"scopes":          "unknown scope admin",
+		"expires_in_days": "must be between 1 and 365 days",
+	}, body.Fields)
+
+	credential, _ := createAPIToken(t, router, session.AccessToken, `{"name": "short lived", "scopes": ["chat:write"], "expires_in_days": 1}`)
+	resp = performJSON(router, "POST", "/chat", "", credential)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	service.Tokens.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	resp = performJSON(router, "POST", "/chat", "", credential)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestAPITokens_WebsocketScopes(t *testing.T) {
+	service := newTestAuthService()
+	session := signupAndLogin(t, service, "testUser", "testPassword1")
+	userID := userIDOf(t, service, "testUser")
+	_, compile, err := service.CreateAPIToken(userID, "CI bot", []string{ScopeCompileRun}, 0)
+	require.NoError(t, err)
+	_, chat, err := service.CreateAPIToken(userID, "chat bot", []string{ScopeChatWrite}, 0)
+	require.NoError(t, err)
+
+	upgrader := websocket.Upgrader{}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err == nil {
+			conn.Close()
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/compile", service.WebsocketMiddleware(handler, ScopeCompileRun))
+	mux.HandleFunc("/signal", service.WebsocketMiddleware(handler))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	dial := func(path, token string) int {
+		conn, resp, err := websocket.DefaultDialer.Dial(url+path+"?access_token="+token, nil)
+		if err == nil {
+			conn.Close()
+		}
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusSwitchingProtocols, dial("/compile", compile))
+	assert.Equal(t, http.StatusForbidden, dial("/compile", chat))
+	assert.Equal(t, http.StatusForbidden, dial("/signal", compile))
+	assert.Equal(t, http.StatusSwitchingProtocols, dial("/signal", session.AccessToken))
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPITokenHandler mints a personal API token for the authenticated user.
+// The credential is only returned in this response.
+func (s *AuthService) CreateAPITokenHandler(c *gin.Context) {
+	var tokenRequest struct {
+		Name          string   `json:"name"`            // Name of the token, such as "CI bot"
+		Scopes        []string `json:"scopes"`          // Scopes granted to the token
+		ExpiresInDays int      `json:"expires_in_days"` // Lifetime of the token, 30 days if omitted
+	}
+	if err := c.BindJSON(&tokenRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	peer := CurrentPeer(c)
+	lifetime := time.Duration(tokenRequest.ExpiresInDays) * 24 * time.Hour
+	token, credential, err := s.CreateAPIToken(peer.ID, tokenRequest.Name, tokenRequest.Scopes, lifetime)
+	if err != nil {
+		var errs ValidationErrors
+		if errors.As(err, &errs) {
+			c.JSON(http.StatusBadRequest, ValidationResponse(errs))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"token": credential, "api_token": token})
+}
+
+// ListAPITokensHandler lists the API tokens of the authenticated user, without their secrets.
+func (s *AuthService) ListAPITokensHandler(c *gin.Context) {
+	tokens, err := s.APITokens.ListByUser(CurrentPeer(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tokens == nil {
+		tokens = []*APIToken{}
+	}
+	c.JSON(http.StatusOK, gin.H{"api_tokens": tokens})
+}
+
+// RevokeAPITokenHandler revokes an API token of the authenticated user.
+func (s *AuthService) RevokeAPITokenHandler(c *gin.Context) {
+	if err := s.RevokeAPIToken(CurrentPeer(c).ID, c.Param("tokenID")); err != nil {
+		if errors.Is(err, ErrAPITokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API token revoked"})
+}
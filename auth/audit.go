@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Types of the audit events.
+const (
+	AuditAccountLocked = "login.account_locked" // Too many failed logins for an account
+	AuditIPLocked      = "login.ip_locked"      // Too many failed logins from an IP
+)
+
+// AuditEvent is a security relevant event, kept for later review.
+type AuditEvent struct {
+	Time   time.Time `json:"time"`              // Time the event happened
+	Type   string    `json:"type"`              // Type of the event, one of the Audit constants
+	UserID string    `json:"user_id,omitempty"` // User concerned, empty if unknown
+	Name   string    `json:"name,omitempty"`    // Name the request was made for
+	IP     string    `json:"ip,omitempty"`      // IP the request came from
+	Detail string    `json:"detail,omitempty"`  // Human readable details
+}
+
+// AuditLog records the audit events.
+type AuditLog interface {
+	// Record stores the event, returning an error if it could not be stored.
+	Record(event *AuditEvent) error
+}
+
+// LogAuditLog is an AuditLog writing one line per event to a writer.
+type LogAuditLog struct {
+	mutex sync.Mutex
+	out   io.Writer // Destination of the events
+}
+
+var _ AuditLog = (*LogAuditLog)(nil)
+
+// NewLogAuditLog creates an audit log writing the events to out.
+func NewLogAuditLog(out io.Writer) *LogAuditLog {
+	return &LogAuditLog{out: out}
+}
+
+func (l *LogAuditLog) Record(event *AuditEvent) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	_, err := fmt.Fprintf(l.out, "audit %s type=%s user=%q name=%q ip=%q detail=%q\n",
+		event.Time.UTC().Format(time.RFC3339), event.Type, event.UserID, event.Name, event.IP, event.Detail)
+	return err
+}
+
+// MemoryAuditLog is an AuditLog keeping the events in memory, for tests.
+type MemoryAuditLog struct {
+	mutex  sync.Mutex
+	events []*AuditEvent // Recorded events, oldest first
+}
+
+var _ AuditLog = (*MemoryAuditLog)(nil)
+
+// NewMemoryAuditLog creates an empty in-memory audit log.
+func NewMemoryAuditLog() *MemoryAuditLog {
+	return &MemoryAuditLog{}
+}
+
+func (l *MemoryAuditLog) Record(event *AuditEvent) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	copied := *event
+	l.events = append(l.events, &copied)
+	return nil
+}
+
+// Events returns the recorded events, oldest first.
+func (l *MemoryAuditLog) Events() []*AuditEvent {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	events := make([]*AuditEvent, len(l.events))
+	copy(events, l.events)
+	return events
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/ratelimit"
+)
+
+// AuthService handles the authentication of users.
+// It provides the signup, login and token handlers backed by a UserStore,
+// and the middlewares protecting the other endpoints.
+type AuthService struct {
+	Users     UserStore     // Store of the registered users
+	Tokens    *TokenIssuer  // Issuer of access and refresh tokens
+	Sessions  SessionStore  // Store of the active sessions, in memory by default
+	APITokens APITokenStore // Store of the personal API tokens, in memory by default
+	Orgs      OrgStore      // Store of the organizations and their workspaces, in memory by default
+	Mailer    Mailer        // Sends the verification and password reset emails, to the log by default
+	Audit     AuditLog      // Records the security events such as lockouts, to the log by default
+
+	LoginAccounts *ratelimit.Backoff // Failed logins of every account, locking it out after too many
+	LoginIPs      *ratelimit.Backoff // Failed logins from every IP, more lenient since IPs may be shared
+
+	LinkBaseURL string // Base URL of the links sent by email
+
+	OnOrgMemberRemoved func(orgID, userID string) // Called once a user is no longer a member of an organization, so it leaves the rooms of the organization
+
+	connections    sessionConnections          // Open websockets of every session
+	logins         oidcLogins                  // Logins waiting for the identity provider callback
+	oneTimeTokens  oneTimeTokens               // Tokens of the links sent by email
+	mfaChallenges  mfaChallenges               // Logins waiting for their second factor
+	twoFactorMutex sync.Mutex                  // Serializes the second factor checks, so codes cannot be replayed concurrently
+	providersMutex sync.RWMutex                // Mutex for safe access to the providers map
+	providers      map[string]IdentityProvider // Identity providers, keyed by name
+}
+
+// NewAuthService creates a new instance of AuthService backed by the provided user store and token issuer.
+func NewAuthService(users UserStore, tokens *TokenIssuer) *AuthService {
+	return &AuthService{
+		Users:     users,
+		Tokens:    tokens,
+		Sessions:  NewMemorySessionStore(),
+		APITokens: NewMemoryAPITokenStore(),
+		Orgs:      NewMemoryOrgStore(),
+		Mailer:    NewLogMailer(log.Writer()),
+		Audit:     NewLogAuditLog(log.Writer()),
+
+		LoginAccounts: ratelimit.NewBackoff(ratelimit.DefaultBackoffConfig()),
+		LoginIPs:      ratelimit.NewBackoff(loginIPBackoffConfig()),
+
+		LinkBaseURL: "http://localhost:8080",
+	}
+}
+
+// RefreshHandler exchanges a refresh token for a new token pair.
+// The refresh token is consumed; reusing it revokes every token derived from it.
+func (s *AuthService) RefreshHandler(c *gin.Context) {
+	var refreshRequest struct {
+		RefreshToken string `json:"refresh_token"` // Refresh token returned by login or a previous refresh
+	}
+	if err := c.BindJSON(&refreshRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	userID, sessionID, err := s.Tokens.Rotate(refreshRequest.RefreshToken)
+	if errors.Is(err, ErrTokenReused) {
+		// The token was stolen, log out the session it belongs to
+		s.RevokeSession(userID, sessionID)
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := s.Sessions.Get(sessionID); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidToken.Error()})
+		return
+	}
+	user, err := s.Users.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidToken.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Refreshing keeps the session alive for another refresh token lifetime
+	now := s.Tokens.now()
+	if err := s.Sessions.Touch(sessionID, now, now.Add(s.Tokens.RefreshTTL)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidToken.Error()})
+		return
+	}
+	tokens, err := s.Tokens.Issue(user, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
@@ -1,12 +1,32 @@
 package auth
 
 import (
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/ratelimit"
 )
 
-func LoginHandler(c *gin.Context) {
+// loginIPBackoffConfig returns the backoff of failed logins per IP. It allows more
+// failures than the per-account backoff, since many users may share an IP.
+func loginIPBackoffConfig() ratelimit.BackoffConfig {
+	config := ratelimit.DefaultBackoffConfig()
+	config.FreeAttempts = 10
+	config.LockoutThreshold = 50
+	return config
+}
+
+// LoginHandler handles the login process of a user.
+// Unknown users and wrong passwords produce the same response and take the same
+// time, so the endpoint cannot be used to find out which users exist.
+// Repeated failures for an account or from an IP delay the next attempts
+// exponentially, then lock them out for a while. Users with two-factor
+// authentication get an MFA token instead of tokens, see LoginTwoFactorHandler.
+func (s *AuthService) LoginHandler(c *gin.Context) {
 	var loginRequest struct {
 		Name     string `json:"name"`     // Username provided in the login request
 		Password string `json:"password"` // Password provided in the login request
@@ -17,14 +37,74 @@ func LoginHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
-	// Check if the user exists in the users map and if the provided password matches the stored password.
-	user, exists := peers[loginRequest.Name]
-	if !exists {
+
+	// Attempts are throttled before checking the password, so a locked out
+	// account cannot be guessed even with the right password
+	account := strings.ToLower(loginRequest.Name)
+	ip := c.ClientIP()
+	if wait, locked := s.loginWait(account, ip); wait > 0 {
+		ratelimit.SetRetryAfter(c.Writer, wait)
+		message := "Too many failed login attempts, try again later"
+		if locked {
+			message = "Too many failed login attempts, login is temporarily locked"
+		}
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": message, "locked": locked})
+		return
+	}
+
+	// Check if the user exists and if the provided password matches the stored hash.
+	// The hash comparison runs even for unknown users to keep the response time constant.
+	var hash []byte
+	user, err := s.Users.GetByName(loginRequest.Name)
+	if err == nil {
+		hash = user.PasswordHash
+	}
+	if !CheckPassword(hash, loginRequest.Password) {
+		s.loginFailed(user, account, ip)
 		// Respond with an error if the username or password is invalid.
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 		return
 	}
 
-	// Respond with a success message if the login process is successful.
-	c.JSON(http.StatusOK, gin.H{"message": "User logged in successfully", "user": user})
+	// With two-factor authentication, the failures are only forgotten once the code is checked
+	if !user.TwoFactorEnabled {
+		s.LoginAccounts.Success(account)
+	}
+	s.completeLogin(c, user)
+}
+
+// loginWait returns how long logins for the account from the IP must wait,
+// and whether the account or the IP is locked out.
+func (s *AuthService) loginWait(account, ip string) (time.Duration, bool) {
+	accountWait, accountLocked := s.LoginAccounts.Check(account)
+	ipWait, ipLocked := s.LoginIPs.Check(ip)
+	return max(accountWait, ipWait), accountLocked || ipLocked
+}
+
+// loginFailed records a failed login, auditing the lockouts it causes.
+// The user is nil if no account has the name.
+func (s *AuthService) loginFailed(user *User, account, ip string) {
+	event := AuditEvent{Time: s.Tokens.now(), Name: account, IP: ip}
+	if user != nil {
+		event.UserID = user.ID
+	}
+	if s.LoginAccounts.Failure(account) {
+		locked := event
+		locked.Type = AuditAccountLocked
+		locked.Detail = "account locked for " + s.LoginAccounts.Config.LockoutDuration.String()
+		s.audit(&locked)
+	}
+	if s.LoginIPs.Failure(ip) {
+		locked := event
+		locked.Type = AuditIPLocked
+		locked.Detail = "IP locked for " + s.LoginIPs.Config.LockoutDuration.String()
+		s.audit(&locked)
+	}
+}
+
+// audit records the event, logging the failures to record it.
+func (s *AuthService) audit(event *AuditEvent) {
+	if err := s.Audit.Record(event); err != nil {
+		log.Printf("Failed to record audit event %s: %v", event.Type, err)
+	}
 }
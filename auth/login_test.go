@@ -5,24 +5,45 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/ratelimit"
 )
 
 func TestLoginHandler(t *testing.T) {
 	// Setup a Gin router
+	service := newTestAuthService()
 	router := gin.Default()
-	router.POST("/login", LoginHandler)
+	router.POST("/signup", service.SignupHandler)
+	router.POST("/login", service.LoginHandler)
 
 	// Prepare a test user
-	testUser := `{"name": "testUser", "password": "testPassword"}`
+	signup := `{"name": "testUser", "email": "test@example.com", "password": "testPassword1"}`
+	req, _ := http.NewRequest("POST", "/signup", bytes.NewBufferString(signup))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
 
 	// Test case: Valid login request
-	req, _ := http.NewRequest("POST", "/login", bytes.NewBufferString(testUser))
+	testUser := `{"name": "testUser", "password": "testPassword1"}`
+	req, _ = http.NewRequest("POST", "/login", bytes.NewBufferString(testUser))
 	req.Header.Set("Content-Type", "application/json")
-	resp := httptest.NewRecorder()
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Test case: Invalid login request (wrong password)
+	wrongPassword := `{"name": "testUser", "password": "wrongPassword1"}`
+	req, _ = http.NewRequest("POST", "/login", bytes.NewBufferString(wrongPassword))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	wrongPasswordBody := resp.Body.String()
 
 	// Test case: Invalid login request (user doesn't exist)
 	invalidUser := `{"name": "nonExistentUser", "password": "testPassword"}`
@@ -32,5 +53,90 @@ func TestLoginHandler(t *testing.T) {
 	router.ServeHTTP(resp, req)
 	assert.Equal(t, http.StatusUnauthorized, resp.Code)
 
-	// Add more test cases as needed...
+	// Both failures are indistinguishable
+	assert.Equal(t, wrongPasswordBody, resp.Body.String())
+}
+
+func TestLoginHandler_IssuesTokens(t *testing.T) {
+	service := newTestAuthService()
+	tokens := signupAndLogin(t, service, "testUser", "testPassword1")
+
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	claims, err := service.Tokens.ParseAccessToken(tokens.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, userIDOf(t, service, "testUser"), claims.Peer().ID)
+	assert.Equal(t, "testUser", claims.Peer().Name)
+}
+
+func TestLoginHandler_BacksOffAfterFailures(t *testing.T) {
+	service := newTestAuthService()
+	signupAndLogin(t, service, "testUser", "testPassword1")
+	router := gin.New()
+	router.POST("/login", service.LoginHandler)
+
+	wrongPassword := `{"name": "testUser", "password": "wrongPassword1"}`
+	for i := 0; i < 4; i++ {
+		resp := performJSON(router, "POST", "/login", wrongPassword, "")
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	}
+
+	// Even the right password must wait for the delay
+	resp := performJSON(router, "POST", "/login", `{"name": "TESTUSER", "password": "testPassword1"}`, "")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "1", resp.Header().Get("Retry-After"))
+	assert.Contains(t, resp.Body.String(), `"locked":false`)
+}
+
+func TestLoginHandler_LocksOutAccount(t *testing.T) {
+	service := newTestAuthService()
+	audit := NewMemoryAuditLog()
+	service.Audit = audit
+	// No delays, so the lockout is reached right away
+	service.LoginAccounts = ratelimit.NewBackoff(ratelimit.BackoffConfig{
+		LockoutThreshold: 3,
+		LockoutDuration:  15 * time.Minute,
+		ResetAfter:       time.Hour,
+	})
+	signupAndLogin(t, service, "testUser", "testPassword1")
+	router := gin.New()
+	router.POST("/login", service.LoginHandler)
+
+	wrongPassword := `{"name": "testUser", "password": "wrongPassword1"}`
+	for i := 0; i < 3; i++ {
+		resp := performJSON(router, "POST", "/login", wrongPassword, "")
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	}
+
+	resp := performJSON(router, "POST", "/login", `{"name": "testUser", "password": "testPassword1"}`, "")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "900", resp.Header().Get("Retry-After"))
+	assert.Contains(t, resp.Body.String(), `"locked":true`)
+
+	// The lockout is audited once
+	events := audit.Events()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, AuditAccountLocked, events[0].Type)
+		assert.Equal(t, userIDOf(t, service, "testUser"), events[0].UserID)
+		assert.Equal(t, "192.0.2.1", events[0].IP)
+	}
+
+	// Other accounts can still log in from the same IP
+	signupAndLogin(t, service, "otherUser", "testPassword1")
+}
+
+func TestLoginHandler_SuccessResetsFailures(t *testing.T) {
+	service := newTestAuthService()
+	signupAndLogin(t, service, "testUser", "testPassword1")
+	router := gin.New()
+	router.POST("/login", service.LoginHandler)
+
+	for i := 0; i < 3; i++ {
+		performJSON(router, "POST", "/login", `{"name": "testUser", "password": "wrongPassword1"}`, "")
+	}
+	login(t, service, "testUser", "testPassword1")
+
+	wait, locked := service.LoginAccounts.Check("testuser")
+	assert.Zero(t, wait)
+	assert.False(t, locked)
 }
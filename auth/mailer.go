@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Mail is an email sent to a user.
+type Mail struct {
+	To      string // Recipient address
+	Subject string // Subject line
+	Body    string // Plain text body
+}
+
+// Mailer delivers emails to users.
+type Mailer interface {
+	// Send delivers the mail, returning an error if it could not be handed over.
+	Send(mail *Mail) error
+}
+
+// LogMailer is a Mailer writing the emails to a writer instead of sending them,
+// for local development.
+type LogMailer struct {
+	mutex sync.Mutex
+	out   io.Writer // Destination of the emails
+}
+
+var _ Mailer = (*LogMailer)(nil)
+
+// NewLogMailer creates a mailer writing the emails to out.
+func NewLogMailer(out io.Writer) *LogMailer {
+	return &LogMailer{out: out}
+}
+
+func (m *LogMailer) Send(mail *Mail) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	_, err := fmt.Fprintf(m.out, "To: %s\nSubject: %s\n\n%s\n\n", mail.To, mail.Subject, mail.Body)
+	return err
+}
+
+// FileMailer is a Mailer storing every email as a file in a directory,
+// for local development and tests.
+type FileMailer struct {
+	Dir string // Directory the emails are written to
+
+	mutex sync.Mutex
+	count int // Number of emails written, to keep file names unique and ordered
+}
+
+var _ Mailer = (*FileMailer)(nil)
+
+// NewFileMailer creates a mailer writing the emails to dir, creating it if needed.
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{Dir: dir}, nil
+}
+
+// unsafeFileCharacters matches the characters of an address not used in file names.
+var unsafeFileCharacters = regexp.MustCompile(`[^A-Za-z0-9@._-]+`)
+
+func (m *FileMailer) Send(mail *Mail) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.count++
+	name := fmt.Sprintf("%s-%04d-%s.eml", time.Now().UTC().Format("20060102T150405"), m.count, unsafeFileCharacters.ReplaceAllString(mail.To, "_"))
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", mail.To, mail.Subject, mail.Body)
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(content), 0600)
+}
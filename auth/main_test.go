@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestAuthService creates an AuthService backed by in-memory stores.
+// Emails are discarded, tests reading them set their own mailer.
+func newTestAuthService() *AuthService {
+	service := NewAuthService(NewMemoryUserStore(), NewTokenIssuer([]byte("test-secret")))
+	service.Mailer = NewLogMailer(io.Discard)
+	service.Audit = NewMemoryAuditLog()
+	return service
+}
+
+// performJSON sends a JSON request to the router and returns the recorded response.
+func performJSON(router http.Handler, method, path, body, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "test-agent")
+	req.RemoteAddr = "192.0.2.1:40000"
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+// signupAndLogin registers a user through the handlers and returns the tokens issued on login.
+func signupAndLogin(t *testing.T, service *AuthService, name, password string) TokenPair {
+	router := gin.New()
+	router.POST("/signup", service.SignupHandler)
+
+	signup, _ := json.Marshal(map[string]string{"name": name, "email": strings.ToLower(name) + "@example.com", "password": password})
+	if resp := performJSON(router, "POST", "/signup", string(signup), ""); resp.Code != http.StatusOK {
+		t.Fatalf("signup failed: %s", resp.Body.String())
+	}
+
+	return login(t, service, name, password)
+}
+
+// login logs the user in through the handler and returns the issued tokens.
+func login(t *testing.T, service *AuthService, name, password string) TokenPair {
+	router := gin.New()
+	router.POST("/login", service.LoginHandler)
+
+	login, _ := json.Marshal(map[string]string{"name": name, "password": password})
+	resp := performJSON(router, "POST", "/login", string(login), "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("login failed: %s", resp.Body.String())
+	}
+	var body struct {
+		Tokens TokenPair `json:"tokens"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Tokens
+}
+
+// userIDOf returns the ID generated for the user on signup.
+func userIDOf(t *testing.T, service *AuthService, name string) string {
+	user, err := service.Users.GetByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+	"github.com/Rishi-Mishra0704/code-collab-backend/ratelimit"
+)
+
+const (
+	peerKey   = "auth.peer"   // Key of the authenticated peer in gin and request contexts
+	claimsKey = "auth.claims" // Key of the claims of the credential in gin contexts
+)
+
+// contextKey is the type of the keys stored in request contexts.
+type contextKey string
+
+// Middleware returns a Gin middleware rejecting requests without a valid access
+// token or API token. The authenticated peer is available to the handlers through
+// CurrentPeer; routes reachable with API tokens are guarded with RequireScope.
+func (s *AuthService) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := s.authenticate(c.Request)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		SetCurrentPeer(c, claims.Peer())
+		c.Set(claimsKey, claims)
+		c.Next()
+	}
+}
+
+// RequireScope returns a Gin middleware rejecting API tokens without the scope.
+// It must run after Middleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims := currentClaims(c); claims == nil || !claims.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrMissingScope.Error(), "scope": scope})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession returns a Gin middleware rejecting API tokens, for the endpoints
+// managing credentials. It must run after Middleware.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if claims := currentClaims(c); claims == nil || claims.Token != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrSessionRequired.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// WebsocketMiddleware wraps a websocket handler so the connection is only
+// upgraded for requests carrying a valid access token. Browsers cannot set
+// headers on websocket upgrades, so the token may also be passed in the
+// "access_token" query parameter. The peer is available through PeerFromRequest.
+// The request context is cancelled when the session or API token is revoked, see CloseOnRevoke.
+// API tokens are only accepted if they grant every scope; without scopes the
+// endpoint requires an interactive session.
+func (s *AuthService) WebsocketMiddleware(next http.HandlerFunc, scopes ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := s.authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if claims.Token != nil && len(scopes) == 0 {
+			http.Error(w, ErrSessionRequired.Error(), http.StatusForbidden)
+			return
+		}
+		for _, scope := range scopes {
+			if !claims.HasScope(scope) {
+				http.Error(w, ErrMissingScope.Error(), http.StatusForbidden)
+				return
+			}
+		}
+
+		credential := claims.SessionID
+		if claims.Token != nil {
+			credential = claims.Token.ID
+		}
+		ctx, release := s.connections.track(r.Context(), credential)
+		defer release()
+		next(w, r.WithContext(WithPeer(ctx, claims.Peer())))
+	}
+}
+
+// CurrentPeer returns the peer authenticated by the middleware, or nil.
+func CurrentPeer(c *gin.Context) *network.Peer {
+	if peer, ok := c.Get(peerKey); ok {
+		return peer.(*network.Peer)
+	}
+	return PeerFromRequest(c.Request)
+}
+
+// CurrentSessionID returns the ID of the session authenticated by the middleware,
+// or an empty string for API tokens.
+func CurrentSessionID(c *gin.Context) string {
+	if claims := currentClaims(c); claims != nil {
+		return claims.SessionID
+	}
+	return ""
+}
+
+// currentClaims returns the claims of the credential authenticated by the middleware, or nil.
+func currentClaims(c *gin.Context) *Claims {
+	claims, _ := c.Value(claimsKey).(*Claims)
+	return claims
+}
+
+// SetCurrentPeer stores the authenticated peer in the gin context.
+func SetCurrentPeer(c *gin.Context, peer *network.Peer) {
+	c.Set(peerKey, peer)
+}
+
+// PeerFromRequest returns the peer authenticated by the websocket middleware, or nil.
+func PeerFromRequest(r *http.Request) *network.Peer {
+	if r == nil {
+		return nil
+	}
+	peer, _ := r.Context().Value(contextKey(peerKey)).(*network.Peer)
+	return peer
+}
+
+// RateLimitKey keys the rate limits of Gin requests by authenticated peer,
+// falling back to the client IP for anonymous requests.
+func RateLimitKey(c *gin.Context) string {
+	if peer := CurrentPeer(c); peer != nil {
+		return "peer:" + peer.ID
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// RequestRateLimitKey keys the rate limits of websocket requests by the peer
+// authenticated by the websocket middleware, falling back to the remote IP.
+func RequestRateLimitKey(r *http.Request) string {
+	if peer := PeerFromRequest(r); peer != nil {
+		return "peer:" + peer.ID
+	}
+	return "ip:" + ratelimit.RemoteIP(r)
+}
+
+// WithPeer returns a copy of the context carrying the authenticated peer.
+func WithPeer(ctx context.Context, peer *network.Peer) context.Context {
+	return context.WithValue(ctx, contextKey(peerKey), peer)
+}
+
+// authenticate validates the access token of the request and the session it
+// belongs to, recording the activity on the session. Credentials starting with
+// "cc_" are API tokens.
+func (s *AuthService) authenticate(r *http.Request) (*Claims, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+	if strings.HasPrefix(token, apiTokenPrefix) {
+		return s.authenticateAPIToken(token)
+	}
+	claims, err := s.Tokens.ParseAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+	// Access tokens of revoked sessions are rejected before they expire
+	session, err := s.Sessions.Get(claims.SessionID)
+	if err != nil || session.UserID != claims.Subject {
+		return nil, ErrSessionRevoked
+	}
+	if err := s.Sessions.Touch(session.ID, s.Tokens.now(), time.Time{}); err != nil {
+		return nil, ErrSessionRevoked
+	}
+	return claims, nil
+}
+
+// bearerToken extracts the token from the Authorization header, or from the
+// "access_token" query parameter for websocket upgrades.
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if websocket.IsWebSocketUpgrade(r) {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
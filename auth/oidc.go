@@ -0,0 +1,431 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	oidcStateCookie   = "oidc_state"     // Cookie binding the login flow to the browser
+	oidcStateLifetime = 10 * time.Minute // Time the user has to complete the login at the provider
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")                                                             // No provider is registered under the name
+	ErrInvalidState    = errors.New("invalid or expired login state")                                                        // The callback does not match a login started by the browser
+	ErrIdentityInvalid = errors.New("identity provider returned no subject")                                                 // The identity cannot be linked to a user
+	ErrLinkUnverified  = errors.New("an account with this email exists, verify its email before logging in with a provider") // The local account never proved it owns the email
+)
+
+// Identity is a user as described by an external identity provider.
+type Identity struct {
+	Provider      string `json:"provider"`       // Name of the provider the identity comes from
+	Subject       string `json:"subject"`        // Stable identifier of the user at the provider
+	Email         string `json:"email"`          // Email of the user
+	EmailVerified bool   `json:"email_verified"` // Indicates whether the provider verified the email
+	Name          string `json:"name"`           // Preferred username or display name
+}
+
+// IdentityProvider is an OAuth2/OIDC provider users can log in with,
+// using the authorization code flow with PKCE.
+type IdentityProvider interface {
+	// Name returns the name of the provider, used in the login and callback URLs.
+	Name() string
+
+	// AuthCodeURL returns the URL of the provider the browser is redirected to.
+	// The provider redirects back to the callback with the state and a code.
+	AuthCodeURL(state, codeVerifier string) string
+
+	// Exchange trades the code for the identity of the user.
+	Exchange(ctx context.Context, code, codeVerifier string) (*Identity, error)
+}
+
+// OIDCConfig configures an OIDCProvider.
+type OIDCConfig struct {
+	Name         string   // Name of the provider, such as "company"
+	ClientID     string   // OAuth2 client ID registered with the provider
+	ClientSecret string   // OAuth2 client secret registered with the provider
+	AuthURL      string   // Authorization endpoint
+	TokenURL     string   // Token endpoint
+	UserInfoURL  string   // UserInfo endpoint
+	RedirectURL  string   // Callback URL of this backend, /auth/<name>/callback
+	Scopes       []string // Requested scopes, "openid email profile" by default
+}
+
+// OIDCProvider is an IdentityProvider for any OIDC compliant provider.
+// The code is exchanged over a back channel authenticated with the client
+// secret and the identity is read from the UserInfo endpoint.
+type OIDCProvider struct {
+	Config OIDCConfig
+	Client *http.Client // HTTP client used for the back channel calls
+}
+
+var _ IdentityProvider = (*OIDCProvider)(nil)
+
+// NewOIDCProvider creates a provider from its configuration.
+func NewOIDCProvider(config OIDCConfig) *OIDCProvider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &OIDCProvider{
+		Config: config,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.Config.Name
+}
+
+func (p *OIDCProvider) AuthCodeURL(state, codeVerifier string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.Config.ClientID},
+		"redirect_uri":          {p.Config.RedirectURL},
+		"scope":                 {strings.Join(p.Config.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.Config.AuthURL, "?") {
+		separator = "&"
+	}
+	return p.Config.AuthURL + separator + query.Encode()
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier string) (*Identity, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.Config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.Config.ClientID), url.QueryEscape(p.Config.ClientSecret))
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+	}
+	if err := p.do(req, &token); err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("failed to exchange code: no access token")
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, p.Config.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	var userInfo struct {
+		Subject           string `json:"sub"`
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		Name              string `json:"name"`
+		PreferredUsername string `json:"preferred_username"`
+	}
+	if err := p.do(req, &userInfo); err != nil {
+		return nil, fmt.Errorf("failed to get user info: %w", err)
+	}
+
+	name := userInfo.PreferredUsername
+	if name == "" {
+		name = userInfo.Name
+	}
+	return &Identity{
+		Provider:      p.Config.Name,
+		Subject:       userInfo.Subject,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.EmailVerified,
+		Name:          name,
+	}, nil
+}
+
+// do sends the request and decodes the JSON response.
+func (p *OIDCProvider) do(req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("provider responded with %s", resp.Status)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// codeChallenge returns the S256 PKCE challenge of the verifier.
+func codeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// pendingLogin is a login flow waiting for the provider callback.
+type pendingLogin struct {
+	provider     string    // Name of the provider the user was sent to
+	codeVerifier string    // PKCE verifier of the flow
+	expiresAt    time.Time // Time the flow expires
+}
+
+// oidcLogins holds the login flows waiting for the provider callback, keyed by state.
+type oidcLogins struct {
+	mutex   sync.Mutex
+	pending map[string]*pendingLogin
+}
+
+// start records a new login flow, dropping the expired ones.
+func (l *oidcLogins) start(state string, login *pendingLogin, now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.pending == nil {
+		l.pending = make(map[string]*pendingLogin)
+	}
+	for key, existing := range l.pending {
+		if now.After(existing.expiresAt) {
+			delete(l.pending, key)
+		}
+	}
+	l.pending[state] = login
+}
+
+// finish removes and returns the login flow of the state, or nil.
+func (l *oidcLogins) finish(state string, now time.Time) *pendingLogin {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	login, ok := l.pending[state]
+	if !ok {
+		return nil
+	}
+	delete(l.pending, state)
+	if now.After(login.expiresAt) {
+		return nil
+	}
+	return login
+}
+
+// RegisterProvider makes the provider available under /auth/<name>/login.
+func (s *AuthService) RegisterProvider(provider IdentityProvider) {
+	s.providersMutex.Lock()
+	defer s.providersMutex.Unlock()
+
+	if s.providers == nil {
+		s.providers = make(map[string]IdentityProvider)
+	}
+	s.providers[provider.Name()] = provider
+}
+
+// provider returns the provider registered under the name.
+func (s *AuthService) provider(name string) (IdentityProvider, error) {
+	s.providersMutex.RLock()
+	defer s.providersMutex.RUnlock()
+
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// ProviderLoginHandler starts the login with an identity provider by
+// redirecting the browser to it. The state is bound to the browser with a cookie.
+func (s *AuthService) ProviderLoginHandler(c *gin.Context) {
+	provider, err := s.provider(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	state, err := randomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	codeVerifier, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	now := s.Tokens.now()
+	s.logins.start(state, &pendingLogin{
+		provider:     provider.Name(),
+		codeVerifier: codeVerifier,
+		expiresAt:    now.Add(oidcStateLifetime),
+	}, now)
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/",
+		MaxAge:   int(oidcStateLifetime / time.Second),
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, codeVerifier))
+}
+
+// ProviderCallbackHandler completes the login with an identity provider.
+// The external identity is mapped to a local user and a session is started,
+// with the same response as LoginHandler, including the two-factor step.
+func (s *AuthService) ProviderCallbackHandler(c *gin.Context) {
+	provider, err := s.provider(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if message := c.Query("error"); message != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login refused by the identity provider: " + message})
+		return
+	}
+
+	// The state must match the cookie set when the login started, or the
+	// callback was not initiated by this browser
+	state := c.Query("state")
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie != state {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidState.Error()})
+		return
+	}
+	login := s.logins.finish(state, s.Tokens.now())
+	if login == nil || login.provider != provider.Name() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidState.Error()})
+		return
+	}
+	http.SetCookie(c.Writer, &http.Cookie{Name: oidcStateCookie, Path: "/auth/", MaxAge: -1})
+
+	identity, err := provider.Exchange(c.Request.Context(), c.Query("code"), login.codeVerifier)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := s.MapIdentity(identity)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.completeLogin(c, user)
+}
+
+// invalidNameCharacters matches the characters not allowed in names.
+var invalidNameCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// MapIdentity returns the local user of an external identity.
+// Known identities log in as the user they are linked to. Otherwise the identity
+// is linked to the user with the same email if both the provider and the user
+// verified it, or a new user without password is created.
+func (s *AuthService) MapIdentity(identity *Identity) (*User, error) {
+	if identity.Subject == "" {
+		return nil, ErrIdentityInvalid
+	}
+	if user, err := s.Users.GetByIdentity(identity.Provider, identity.Subject); err == nil {
+		return user, nil
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+
+	email, err := NormalizeEmail(identity.Email)
+	if err != nil {
+		return nil, fmt.Errorf("identity provider returned an invalid email: %w", err)
+	}
+
+	// Unverified emails could be used to take over local accounts
+	if user, err := s.Users.GetByEmail(email); err == nil {
+		if !identity.EmailVerified {
+			return nil, ErrEmailTaken
+		}
+		// Anyone can sign up with an email they do not own and wait for its
+		// owner to log in with a provider, so only verified accounts are linked
+		if !user.EmailVerified {
+			return nil, ErrLinkUnverified
+		}
+		user.Identities = linkIdentity(user.Identities, identity)
+		if err := s.Users.Update(user); err != nil {
+			return nil, err
+		}
+		return user, nil
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+
+	id, err := NewUserID()
+	if err != nil {
+		return nil, err
+	}
+	user := &User{
+		ID:            id,
+		Email:         email,
+		EmailVerified: identity.EmailVerified,
+		Identities:    linkIdentity(nil, identity),
+		CreatedAt:     s.Tokens.now(),
+	}
+	// Derive a valid name, adding a suffix until it is free
+	base := identityName(identity, email)
+	for attempt := 0; ; attempt++ {
+		user.Name = base
+		if attempt > 0 {
+			user.Name = fmt.Sprintf("%s%d", base, attempt+1)
+		}
+		err := s.Users.Create(user)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrNameTaken) || attempt >= 100 {
+			return nil, err
+		}
+	}
+}
+
+// linkIdentity adds the identity to the identities of a user.
+func linkIdentity(identities map[string]string, identity *Identity) map[string]string {
+	linked := make(map[string]string, len(identities)+1)
+	for provider, subject := range identities {
+		linked[provider] = subject
+	}
+	linked[identity.Provider] = identity.Subject
+	return linked
+}
+
+// identityName derives a valid user name from the identity, falling back to
+// the local part of the email.
+func identityName(identity *Identity, email string) string {
+	for _, candidate := range []string{identity.Name, email[:strings.Index(email, "@")]} {
+		name := strings.Trim(invalidNameCharacters.ReplaceAllString(candidate, "_"), "._-")
+		if len(name) > maxNameLength-3 {
+			name = name[:maxNameLength-3]
+		}
+		if ValidateName(name) == nil {
+			return name
+		}
+	}
+	return "user"
+}
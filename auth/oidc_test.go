@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// providerRouter registers the identity provider endpoints.
+func providerRouter(service *AuthService) *gin.Engine {
+	router := gin.New()
+	router.GET("/auth/:provider/login", service.ProviderLoginHandler)
+	router.GET("/auth/:provider/callback", service.ProviderCallbackHandler)
+	return router
+}
+
+// startProviderLogin starts a login and returns the provider redirect and the state cookie.
+func startProviderLogin(t *testing.T, router http.Handler, provider string) (*url.URL, *http.Cookie) {
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/"+provider+"/login", nil)
+	router.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusFound, resp.Code)
+
+	location, err := url.Parse(resp.Header().Get("Location"))
+	require.NoError(t, err)
+	cookies := resp.Result().Cookies()
+	require.Len(t, cookies, 1)
+	return location, cookies[0]
+}
+
+// callback sends the provider redirect back to the callback with the cookie.
+func callback(router http.Handler, location *url.URL, cookie *http.Cookie) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", location.RequestURI(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestProviderLogin_FakeProvider(t *testing.T) {
+	service := newTestAuthService()
+	provider := NewFakeProvider("fake", "/auth/fake/callback", &Identity{Subject: "ext-1", Email: "Jane@Corp.example", EmailVerified: true, Name: "Jane Doe"})
+	service.RegisterProvider(provider)
+	router := providerRouter(service)
+
+	location, cookie := startProviderLogin(t, router, "fake")
+	assert.Equal(t, "oidc_state", cookie.Name)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, cookie.Value, location.Query().Get("state"))
+
+	resp := callback(router, location, cookie)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var body struct {
+		User   User      `json:"user"`
+		Tokens TokenPair `json:"tokens"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, "Jane_Doe", body.User.Name)
+	assert.Equal(t, "jane@corp.example", body.User.Email)
+	assert.Equal(t, map[string]string{"fake": "ext-1"}, body.User.Identities)
+
+	claims, err := service.Tokens.ParseAccessToken(body.Tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, body.User.ID, claims.Peer().ID)
+
+	// The state cannot be replayed
+	resp = callback(router, location, cookie)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	// Logging in again maps to the same user
+	location, cookie = startProviderLogin(t, router, "fake")
+	resp = callback(router, location, cookie)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), body.User.ID)
+}
+
+func TestProviderLogin_RejectsForgedCallbacks(t *testing.T) {
+	service := newTestAuthService()
+	service.RegisterProvider(NewFakeProvider("fake", "/auth/fake/callback", &Identity{Subject: "ext-1", Email: "jane@corp.example"}))
+	router := providerRouter(service)
+
+	// Without the cookie set by the login, the callback was not started by this browser
+	location, cookie := startProviderLogin(t, router, "fake")
+	assert.Equal(t, http.StatusBadRequest, callback(router, location, nil).Code)
+	assert.Equal(t, http.StatusBadRequest, callback(router, location, &http.Cookie{Name: cookie.Name, Value: "other"}).Code)
+
+	// Codes are bound to the PKCE verifier of their flow
+	other, otherCookie := startProviderLogin(t, router, "fake")
+	query := other.Query()
+	query.Set("code", location.Query().Get("code"))
+	other.RawQuery = query.Encode()
+	assert.Equal(t, http.StatusUnauthorized, callback(router, other, otherCookie).Code)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/auth/unknown/login", nil)
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestMapIdentity(t *testing.T) {
+	service := newTestAuthService()
+	signupAndLogin(t, service, "jane", "testPassword1")
+	localID := userIDOf(t, service, "jane")
+
+	// Unverified emails are never linked to existing accounts
+	_, err := service.MapIdentity(&Identity{Provider: "corp", Subject: "1", Email: "jane@example.com"})
+	assert.ErrorIs(t, err, ErrEmailTaken)
+
+	// Nor to accounts that never verified their email, which could have been
+	// created by someone waiting for the owner of the email to log in
+	_, err = service.MapIdentity(&Identity{Provider: "corp", Subject: "1", Email: "jane@example.com", EmailVerified: true})
+	assert.ErrorIs(t, err, ErrLinkUnverified)
+	_, err = service.Users.GetByIdentity("corp", "1")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	// Verified emails link the identity to the verified local account
+	local, err := service.Users.GetByID(localID)
+	require.NoError(t, err)
+	local.EmailVerified = true
+	require.NoError(t, service.Users.Update(local))
+	user, err := service.MapIdentity(&Identity{Provider: "corp", Subject: "1", Email: "JANE@example.com", EmailVerified: true})
+	require.NoError(t, err)
+	assert.Equal(t, localID, user.ID)
+	linked, err := service.Users.GetByIdentity("corp", "1")
+	require.NoError(t, err)
+	assert.Equal(t, localID, linked.ID)
+
+	// New identities get a free name derived from the identity
+	user, err = service.MapIdentity(&Identity{Provider: "corp", Subject: "2", Email: "jane@corp.example", Name: "jane"})
+	require.NoError(t, err)
+	assert.Equal(t, "jane2", user.Name)
+	assert.Empty(t, user.PasswordHash)
+	assert.Equal(t, user.Peer().ID, user.ID)
+
+	_, err = service.MapIdentity(&Identity{Provider: "corp", Email: "x@corp.example"})
+	assert.ErrorIs(t, err, ErrIdentityInvalid)
+}
+
+func TestOIDCProvider_Exchange(t *testing.T) {
+	var challenge string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, _ := r.BasicAuth()
+		r.ParseForm()
+		if clientID != "backend" || secret != "s3cret" || r.Form.Get("code") != "good-code" ||
+			codeChallenge(r.Form.Get("code_verifier")) != challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at-1", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub": "abc", "email": "jane@corp.example", "email_verified": true, "preferred_username": "jane",
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	provider := NewOIDCProvider(OIDCConfig{
+		Name:         "corp",
+		ClientID:     "backend",
+		ClientSecret: "s3cret",
+		AuthURL:      server.URL + "/authorize",
+		TokenURL:     server.URL + "/token",
+		UserInfoURL:  server.URL + "/userinfo",
+		RedirectURL:  "http://localhost:8080/auth/corp/callback",
+	})
+
+	authURL, err := url.Parse(provider.AuthCodeURL("state-1", "verifier-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "/authorize", authURL.Path)
+	assert.Equal(t, "state-1", authURL.Query().Get("state"))
+	assert.Equal(t, "openid email profile", authURL.Query().Get("scope"))
+	assert.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+	challenge = authURL.Query().Get("code_challenge")
+
+	identity, err := provider.Exchange(context.Background(), "good-code", "verifier-1")
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{Provider: "corp", Subject: "abc", Email: "jane@corp.example", EmailVerified: true, Name: "jane"}, identity)
+
+	_, err = provider.Exchange(context.Background(), "good-code", "wrong-verifier")
+	assert.Error(t, err)
+	_, err = provider.Exchange(context.Background(), "bad-code", "verifier-1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,306 @@
+package auth
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Roles of the organization members.
+const (
+	OrgRoleAdmin  = "admin"  // Manages the organization, its members and workspaces
+	OrgRoleMember = "member" // Uses the rooms and workspaces of the organization
+)
+
+var (
+	ErrOrgNotFound        = errors.New("organization not found")                              // No organization matches the lookup
+	ErrOrgNameTaken       = errors.New("organization name is already taken")                  // Another organization has the same name, ignoring case
+	ErrNotOrgMember       = errors.New("not a member of the organization")                    // The user has no role in the organization
+	ErrNotOrgAdmin        = errors.New("only organization admins can do this")                // The user is a member but not an admin
+	ErrMemberNotFound     = errors.New("user is not a member of the organization")            // The member changed has no role in the organization
+	ErrAlreadyOrgMember   = errors.New("user is already a member of the organization")        // The user added already has a role in the organization
+	ErrLastAdmin          = errors.New("an organization must keep at least one admin")        // The change would leave the organization without admin
+	ErrInvalidOrgRole     = errors.New("role must be admin or member")                        // The role is not one of the OrgRole constants
+	ErrWorkspaceNotFound  = errors.New("workspace not found")                                 // No workspace matches the lookup
+	ErrWorkspaceNameTaken = errors.New("workspace name is already taken in the organization") // Another workspace of the organization has the same name
+)
+
+// Organization groups users sharing rooms and workspaces.
+type Organization struct {
+	ID        string            `json:"id"`         // Unique identifier for the organization
+	Name      string            `json:"name"`       // Name of the organization, unique ignoring case
+	CreatedAt time.Time         `json:"created_at"` // Time the organization was created
+	Members   map[string]string `json:"members"`    // Roles of the members, keyed by user ID
+}
+
+// Role returns the role of the user in the organization, or an empty string.
+func (o *Organization) Role(userID string) string {
+	return o.Members[userID]
+}
+
+// admins returns the number of admins of the organization.
+func (o *Organization) admins() int {
+	count := 0
+	for _, role := range o.Members {
+		if role == OrgRoleAdmin {
+			count++
+		}
+	}
+	return count
+}
+
+// clone returns a deep copy of the organization, so stored organizations are never shared.
+func (o *Organization) clone() *Organization {
+	cloned := *o
+	cloned.Members = make(map[string]string, len(o.Members))
+	for userID, role := range o.Members {
+		cloned.Members[userID] = role
+	}
+	return &cloned
+}
+
+// Workspace is a directory of files belonging to an organization.
+type Workspace struct {
+	ID        string    `json:"id"`         // Unique identifier for the workspace, also its directory name
+	OrgID     string    `json:"org_id"`     // Organization owning the workspace
+	Name      string    `json:"name"`       // Name of the workspace, unique in the organization
+	CreatedAt time.Time `json:"created_at"` // Time the workspace was created
+}
+
+// OrgStore persists the organizations and their workspaces.
+type OrgStore interface {
+	// CreateOrg adds a new organization.
+	// Returns ErrOrgNameTaken if another organization has the same name.
+	CreateOrg(org *Organization) error
+
+	// UpdateOrg applies the change to a copy of the organization and stores it,
+	// unless the change returns an error. Updates of an organization are applied
+	// one at a time, so the change sees the latest state and can check it.
+	// Returns the updated organization, or ErrOrgNotFound if it does not exist.
+	UpdateOrg(id string, change func(org *Organization) error) (*Organization, error)
+
+	// DeleteOrg removes the organization and its workspaces, if check returns no
+	// error for its latest state. The check may be nil.
+	DeleteOrg(id string, check func(org *Organization) error) error
+
+	// GetOrg returns the organization with the given ID, or ErrOrgNotFound.
+	GetOrg(id string) (*Organization, error)
+
+	// ListOrgsByUser returns the organizations the user is a member of, sorted by name.
+	ListOrgsByUser(userID string) ([]*Organization, error)
+
+	// CreateWorkspace adds a workspace to its organization.
+	// Returns ErrWorkspaceNameTaken if the organization has a workspace with the same name.
+	CreateWorkspace(workspace *Workspace) error
+
+	// GetWorkspace returns the workspace with the given ID, or ErrWorkspaceNotFound.
+	GetWorkspace(id string) (*Workspace, error)
+
+	// ListWorkspaces returns the workspaces of the organization, sorted by name.
+	ListWorkspaces(orgID string) ([]*Workspace, error)
+
+	// DeleteWorkspace removes the workspace.
+	DeleteWorkspace(id string) error
+}
+
+// MemoryOrgStore is an OrgStore keeping the organizations in memory.
+type MemoryOrgStore struct {
+	mutex      sync.RWMutex
+	orgs       map[string]*Organization // Organizations, keyed by ID
+	workspaces map[string]*Workspace    // Workspaces, keyed by ID
+}
+
+var _ OrgStore = (*MemoryOrgStore)(nil)
+
+// NewMemoryOrgStore creates an empty in-memory organization store.
+func NewMemoryOrgStore() *MemoryOrgStore {
+	return &MemoryOrgStore{
+		orgs:       make(map[string]*Organization),
+		workspaces: make(map[string]*Workspace),
+	}
+}
+
+func (s *MemoryOrgStore) CreateOrg(org *Organization) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.checkOrgName(org); err != nil {
+		return err
+	}
+	s.orgs[org.ID] = org.clone()
+	return nil
+}
+
+func (s *MemoryOrgStore) UpdateOrg(id string, change func(org *Organization) error) (*Organization, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, ok := s.orgs[id]
+	if !ok {
+		return nil, ErrOrgNotFound
+	}
+	org := stored.clone()
+	if err := change(org); err != nil {
+		return nil, err
+	}
+	org.ID = id
+	if err := s.checkOrgName(org); err != nil {
+		return nil, err
+	}
+	s.orgs[id] = org.clone()
+	return org, nil
+}
+
+func (s *MemoryOrgStore) DeleteOrg(id string, check func(org *Organization) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	org, ok := s.orgs[id]
+	if !ok {
+		return ErrOrgNotFound
+	}
+	if check != nil {
+		if err := check(org.clone()); err != nil {
+			return err
+		}
+	}
+	delete(s.orgs, id)
+	for workspaceID, workspace := range s.workspaces {
+		if workspace.OrgID == id {
+			delete(s.workspaces, workspaceID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryOrgStore) GetOrg(id string) (*Organization, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	org, ok := s.orgs[id]
+	if !ok {
+		return nil, ErrOrgNotFound
+	}
+	return org.clone(), nil
+}
+
+func (s *MemoryOrgStore) ListOrgsByUser(userID string) ([]*Organization, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	orgs := []*Organization{}
+	for _, org := range s.orgs {
+		if org.Role(userID) != "" {
+			orgs = append(orgs, org.clone())
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Name < orgs[j].Name })
+	return orgs, nil
+}
+
+func (s *MemoryOrgStore) CreateWorkspace(workspace *Workspace) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.orgs[workspace.OrgID]; !ok {
+		return ErrOrgNotFound
+	}
+	for _, existing := range s.workspaces {
+		if existing.OrgID == workspace.OrgID && strings.EqualFold(existing.Name, workspace.Name) {
+			return ErrWorkspaceNameTaken
+		}
+	}
+	copied := *workspace
+	s.workspaces[workspace.ID] = &copied
+	return nil
+}
+
+func (s *MemoryOrgStore) GetWorkspace(id string) (*Workspace, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	workspace, ok := s.workspaces[id]
+	if !ok {
+		return nil, ErrWorkspaceNotFound
+	}
+	copied := *workspace
+	return &copied, nil
+}
+
+func (s *MemoryOrgStore) ListWorkspaces(orgID string) ([]*Workspace, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	workspaces := []*Workspace{}
+	for _, workspace := range s.workspaces {
+		if workspace.OrgID == orgID {
+			copied := *workspace
+			workspaces = append(workspaces, &copied)
+		}
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].Name < workspaces[j].Name })
+	return workspaces, nil
+}
+
+func (s *MemoryOrgStore) DeleteWorkspace(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.workspaces[id]; !ok {
+		return ErrWorkspaceNotFound
+	}
+	delete(s.workspaces, id)
+	return nil
+}
+
+// checkOrgName returns ErrOrgNameTaken if another organization has the same name.
+// The caller must hold the mutex.
+func (s *MemoryOrgStore) checkOrgName(org *Organization) error {
+	for id, existing := range s.orgs {
+		if id != org.ID && strings.EqualFold(existing.Name, org.Name) {
+			return ErrOrgNameTaken
+		}
+	}
+	return nil
+}
+
+// checkOrgAdmin returns ErrNotOrgMember or ErrNotOrgAdmin if the user is not an
+// admin of the organization.
+func checkOrgAdmin(org *Organization, userID string) error {
+	switch org.Role(userID) {
+	case OrgRoleAdmin:
+		return nil
+	case "":
+		return ErrNotOrgMember
+	default:
+		return ErrNotOrgAdmin
+	}
+}
+
+// CheckOrgMember returns the organization if the user is one of its members,
+// ErrNotOrgMember otherwise.
+func CheckOrgMember(orgs OrgStore, orgID, userID string) (*Organization, error) {
+	org, err := orgs.GetOrg(orgID)
+	if err != nil {
+		return nil, err
+	}
+	if org.Role(userID) == "" {
+		return nil, ErrNotOrgMember
+	}
+	return org, nil
+}
+
+// CheckWorkspaceAccess returns the workspace if the user is a member of the
+// organization owning it, ErrNotOrgMember otherwise.
+func CheckWorkspaceAccess(orgs OrgStore, workspaceID, userID string) (*Workspace, error) {
+	workspace, err := orgs.GetWorkspace(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := CheckOrgMember(orgs, workspace.OrgID, userID); err != nil {
+		return nil, err
+	}
+	return workspace, nil
+}
@@ -0,0 +1,338 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateOrgHandler creates an organization with the authenticated user as its admin.
+func (s *AuthService) CreateOrgHandler(c *gin.Context) {
+	var orgRequest struct {
+		Name string `json:"name"` // Name of the organization
+	}
+	if err := c.BindJSON(&orgRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	if err := ValidateName(orgRequest.Name); err != nil {
+		c.JSON(http.StatusBadRequest, ValidationResponse(ValidationErrors{"name": err.Error()}))
+		return
+	}
+
+	id, err := randomToken(8)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	org := &Organization{
+		ID:        id,
+		Name:      orgRequest.Name,
+		CreatedAt: s.Tokens.now(),
+		Members:   map[string]string{CurrentPeer(c).ID: OrgRoleAdmin},
+	}
+	if err := s.Orgs.CreateOrg(org); err != nil {
+		RespondOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"org": org})
+}
+
+// ListOrgsHandler lists the organizations of the authenticated user.
+func (s *AuthService) ListOrgsHandler(c *gin.Context) {
+	orgs, err := s.Orgs.ListOrgsByUser(CurrentPeer(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"orgs": orgs})
+}
+
+// GetOrgHandler returns an organization of the authenticated user.
+func (s *AuthService) GetOrgHandler(c *gin.Context) {
+	org, err := CheckOrgMember(s.Orgs, c.Param("orgID"), CurrentPeer(c).ID)
+	if err != nil {
+		RespondOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"org": org})
+}
+
+// UpdateOrgHandler renames an organization. Only admins can rename it.
+func (s *AuthService) UpdateOrgHandler(c *gin.Context) {
+	var orgRequest struct {
+		Name string `json:"name"` // New name of the organization
+	}
+	if err := c.BindJSON(&orgRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	if err := ValidateName(orgRequest.Name); err != nil {
+		c.JSON(http.StatusBadRequest, ValidationResponse(ValidationErrors{"name": err.Error()}))
+		return
+	}
+
+	callerID := CurrentPeer(c).ID
+	org, err := s.Orgs.UpdateOrg(c.Param("orgID"), func(org *Organization) error {
+		if err := checkOrgAdmin(org, callerID); err != nil {
+			return err
+		}
+		org.Name = orgRequest.Name
+		return nil
+	})
+	if err != nil {
+		RespondOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"org": org})
+}
+
+// DeleteOrgHandler deletes an organization and its workspaces. Only admins can delete it.
+func (s *AuthService) DeleteOrgHandler(c *gin.Context) {
+	callerID := CurrentPeer(c).ID
+	orgID := c.Param("orgID")
+	var members []string
+	err := s.Orgs.DeleteOrg(orgID, func(org *Organization) error {
+		if err := checkOrgAdmin(org, callerID); err != nil {
+			return err
+		}
+		for userID := range org.Members {
+			members = append(members, userID)
+		}
+		return nil
+	})
+	if err != nil {
+		RespondOrgError(c, err)
+		return
+	}
+	for _, userID := range members {
+		s.orgMemberRemoved(orgID, userID)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Organization deleted"})
+}
+
+// AddOrgMemberHandler adds a user to an organization, by name.
+// Only admins can add members.
+func (s *AuthService) AddOrgMemberHandler(c *gin.Context) {
+	var memberRequest struct {
+		Name string `json:"name"` // Name of the user to add
+		Role string `json:"role"` // Role of the user, member if omitted
+	}
+	if err := c.BindJSON(&memberRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	if memberRequest.Role == "" {
+		memberRequest.Role = OrgRoleMember
+	}
+	if !validOrgRole(memberRequest.Role) {
+		c.JSON(http.StatusBadRequest, ValidationResponse(ValidationErrors{"role": ErrInvalidOrgRole.Error()}))
+		return
+	}
+	user, err := s.Users.GetByName(memberRequest.Name)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	callerID := CurrentPeer(c).ID
+	org, err := s.Orgs.UpdateOrg(c.Param("orgID"), func(org *Organization) error {
+		if err := checkOrgAdmin(org, callerID); err != nil {
+			return err
+		}
+		if org.Role(user.ID) != "" {
+			return ErrAlreadyOrgMember
+		}
+		org.Members[user.ID] = memberRequest.Role
+		return nil
+	})
+	if err != nil {
+		RespondOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"org": org})
+}
+
+// UpdateOrgMemberHandler changes the role of a member. Only admins can change roles,
+// and the last admin cannot be demoted.
+func (s *AuthService) UpdateOrgMemberHandler(c *gin.Context) {
+	var memberRequest struct {
+		Role string `json:"role"` // New role of the member
+	}
+	if err := c.BindJSON(&memberRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	if !validOrgRole(memberRequest.Role) {
+		c.JSON(http.StatusBadRequest, ValidationResponse(ValidationErrors{"role": ErrInvalidOrgRole.Error()}))
+		return
+	}
+
+	callerID := CurrentPeer(c).ID
+	userID := c.Param("userID")
+	org, err := s.Orgs.UpdateOrg(c.Param("orgID"), func(org *Organization) error {
+		if err := checkOrgAdmin(org, callerID); err != nil {
+			return err
+		}
+		if org.Role(userID) == "" {
+			return ErrMemberNotFound
+		}
+		org.Members[userID] = memberRequest.Role
+		if org.admins() == 0 {
+			return ErrLastAdmin
+		}
+		return nil
+	})
+	if err != nil {
+		RespondOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"org": org})
+}
+
+// RemoveOrgMemberHandler removes a member from an organization. Admins can remove
+// anyone and members can remove themselves, but the last admin cannot leave.
+func (s *AuthService) RemoveOrgMemberHandler(c *gin.Context) {
+	callerID := CurrentPeer(c).ID
+	orgID := c.Param("orgID")
+	userID := c.Param("userID")
+	_, err := s.Orgs.UpdateOrg(orgID, func(org *Organization) error {
+		if userID != callerID {
+			if err := checkOrgAdmin(org, callerID); err != nil {
+				return err
+			}
+		} else if org.Role(callerID) == "" {
+			return ErrNotOrgMember
+		}
+		if org.Role(userID) == "" {
+			return ErrMemberNotFound
+		}
+		delete(org.Members, userID)
+		if org.admins() == 0 {
+			return ErrLastAdmin
+		}
+		return nil
+	})
+	if err != nil {
+		RespondOrgError(c, err)
+		return
+	}
+	s.orgMemberRemoved(orgID, userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+// orgMemberRemoved runs the OnOrgMemberRemoved hook, if set.
+func (s *AuthService) orgMemberRemoved(orgID, userID string) {
+	if s.OnOrgMemberRemoved != nil {
+		s.OnOrgMemberRemoved(orgID, userID)
+	}
+}
+
+// CreateWorkspaceHandler creates a workspace in an organization of the authenticated user.
+func (s *AuthService) CreateWorkspaceHandler(c *gin.Context) {
+	var workspaceRequest struct {
+		Name string `json:"name"` // Name of the workspace
+	}
+	if err := c.BindJSON(&workspaceRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	if err := ValidateName(workspaceRequest.Name); err != nil {
+		c.JSON(http.StatusBadRequest, ValidationResponse(ValidationErrors{"name": err.Error()}))
+		return
+	}
+	org, err := CheckOrgMember(s.Orgs, c.Param("orgID"), CurrentPeer(c).ID)
+	if err != nil {
+		RespondOrgError(c, err)
+		return
+	}
+
+	id, err := randomToken(8)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	workspace := &Workspace{
+		ID:        id,
+		OrgID:     org.ID,
+		Name:      workspaceRequest.Name,
+		CreatedAt: s.Tokens.now(),
+	}
+	if err := s.Orgs.CreateWorkspace(workspace); err != nil {
+		RespondOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"workspace": workspace})
+}
+
+// ListWorkspacesHandler lists the workspaces of an organization of the authenticated user.
+func (s *AuthService) ListWorkspacesHandler(c *gin.Context) {
+	org, err := CheckOrgMember(s.Orgs, c.Param("orgID"), CurrentPeer(c).ID)
+	if err != nil {
+		RespondOrgError(c, err)
+		return
+	}
+	workspaces, err := s.Orgs.ListWorkspaces(org.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"workspaces": workspaces})
+}
+
+// DeleteWorkspaceHandler deletes a workspace. Only admins can delete workspaces.
+// The files of the workspace are kept on disk.
+func (s *AuthService) DeleteWorkspaceHandler(c *gin.Context) {
+	org, err := s.orgAsAdmin(c)
+	if err != nil {
+		RespondOrgError(c, err)
+		return
+	}
+	workspace, err := s.Orgs.GetWorkspace(c.Param("workspaceID"))
+	if err != nil || workspace.OrgID != org.ID {
+		RespondOrgError(c, ErrWorkspaceNotFound)
+		return
+	}
+	if err := s.Orgs.DeleteWorkspace(workspace.ID); err != nil {
+		RespondOrgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Workspace deleted"})
+}
+
+// orgAsAdmin returns the organization of the request if the authenticated user is one of its admins.
+func (s *AuthService) orgAsAdmin(c *gin.Context) (*Organization, error) {
+	userID := CurrentPeer(c).ID
+	org, err := s.Orgs.GetOrg(c.Param("orgID"))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOrgAdmin(org, userID); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// validOrgRole reports whether the role is one of the OrgRole constants.
+func validOrgRole(role string) bool {
+	return role == OrgRoleAdmin || role == OrgRoleMember
+}
+
+// RespondOrgError maps the organization errors to responses.
+func RespondOrgError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrOrgNotFound), errors.Is(err, ErrWorkspaceNotFound), errors.Is(err, ErrMemberNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNotOrgMember), errors.Is(err, ErrNotOrgAdmin):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrOrgNameTaken), errors.Is(err, ErrWorkspaceNameTaken), errors.Is(err, ErrLastAdmin), errors.Is(err, ErrAlreadyOrgMember):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
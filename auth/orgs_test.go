@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newOrgRouter returns a router with the organization endpoints.
+func newOrgRouter(service *AuthService) *gin.Engine {
+	router := gin.New()
+	authorized := router.Group("/", service.Middleware())
+	authorized.POST("/orgs", service.CreateOrgHandler)
+	authorized.GET("/orgs", service.ListOrgsHandler)
+	authorized.GET("/orgs/:orgID", service.GetOrgHandler)
+	authorized.PATCH("/orgs/:orgID", service.UpdateOrgHandler)
+	authorized.DELETE("/orgs/:orgID", service.DeleteOrgHandler)
+	authorized.POST("/orgs/:orgID/members", service.AddOrgMemberHandler)
+	authorized.PATCH("/orgs/:orgID/members/:userID", service.UpdateOrgMemberHandler)
+	authorized.DELETE("/orgs/:orgID/members/:userID", service.RemoveOrgMemberHandler)
+	authorized.POST("/orgs/:orgID/workspaces", service.CreateWorkspaceHandler)
+	authorized.GET("/orgs/:orgID/workspaces", service.ListWorkspacesHandler)
+	authorized.DELETE("/orgs/:orgID/workspaces/:workspaceID", service.DeleteWorkspaceHandler)
+	return router
+}
+
+// createOrg creates an organization through the handler and returns it.
+func createOrg(t *testing.T, router http.Handler, name, accessToken string) *Organization {
+	resp := performJSON(router, "POST", "/orgs", `{"name": "`+name+`"}`, accessToken)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create organization failed: %s", resp.Body.String())
+	}
+	var body struct {
+		Org *Organization `json:"org"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Org
+}
+
+func TestOrgs_CreateAndList(t *testing.T) {
+	service := newTestAuthService()
+	router := newOrgRouter(service)
+	alice := signupAndLogin(t, service, "alice", "testPassword1")
+	bob := signupAndLogin(t, service, "bob", "testPassword1")
+
+	org := createOrg(t, router, "acme", alice.AccessToken)
+	assert.Equal(t, OrgRoleAdmin, org.Role(userIDOf(t, service, "alice")))
+
+	// Names are unique ignoring case
+	resp := performJSON(router, "POST", "/orgs", `{"name": "ACME"}`, bob.AccessToken)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	resp = performJSON(router, "POST", "/orgs", `{"name": "a"}`, bob.AccessToken)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	// Organizations are only visible to their members
+	resp = performJSON(router, "GET", "/orgs", "", bob.AccessToken)
+	assert.JSONEq(t, `{"orgs": []}`, resp.Body.String())
+	resp = performJSON(router, "GET", "/orgs/"+org.ID, "", bob.AccessToken)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	resp = performJSON(router, "GET", "/orgs", "", alice.AccessToken)
+	assert.Contains(t, resp.Body.String(), org.ID)
+	resp = performJSON(router, "GET", "/orgs/missing", "", alice.AccessToken)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestOrgs_Membership(t *testing.T) {
+	service := newTestAuthService()
+	router := newOrgRouter(service)
+	alice := signupAndLogin(t, service, "alice", "testPassword1")
+	bob := signupAndLogin(t, service, "bob", "testPassword1")
+	carol := signupAndLogin(t, service, "carol", "testPassword1")
+	aliceID, bobID, carolID := userIDOf(t, service, "alice"), userIDOf(t, service, "bob"), userIDOf(t, service, "carol")
+	org := createOrg(t, router, "acme", alice.AccessToken)
+	var removed []string
+	service.OnOrgMemberRemoved = func(orgID, userID string) {
+		assert.Equal(t, org.ID, orgID)
+		removed = append(removed, userID)
+	}
+
+	resp := performJSON(router, "POST", "/orgs/"+org.ID+"/members", `{"name": "bob"}`, alice.AccessToken)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	resp = performJSON(router, "POST", "/orgs/"+org.ID+"/members", `{"name": "bob"}`, alice.AccessToken)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	resp = performJSON(router, "POST", "/orgs/"+org.ID+"/members", `{"name": "nobody"}`, alice.AccessToken)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	resp = performJSON(router, "POST", "/orgs/"+org.ID+"/members", `{"name": "carol", "role": "owner"}`, alice.AccessToken)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	// Members cannot manage the organization
+	resp = performJSON(router, "POST", "/orgs/"+org.ID+"/members", `{"name": "carol"}`, bob.AccessToken)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	resp = performJSON(router, "PATCH", "/orgs/"+org.ID, `{"name": "bobcorp"}`, bob.AccessToken)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	resp = performJSON(router, "DELETE", "/orgs/"+org.ID+"/members/"+aliceID, "", bob.AccessToken)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+
+	// The last admin cannot be demoted or leave
+	resp = performJSON(router, "PATCH", "/orgs/"+org.ID+"/members/"+aliceID, `{"role": "member"}`, alice.AccessToken)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	resp = performJSON(router, "DELETE", "/orgs/"+org.ID+"/members/"+aliceID, "", alice.AccessToken)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+
+	// Once promoted, bob can manage members and alice can leave
+	resp = performJSON(router, "PATCH", "/orgs/"+org.ID+"/members/"+bobID, `{"role": "admin"}`, alice.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp = performJSON(router, "POST", "/orgs/"+org.ID+"/members", `{"name": "carol"}`, bob.AccessToken)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	resp = performJSON(router, "DELETE", "/orgs/"+org.ID+"/members/"+aliceID, "", alice.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Members can leave on their own
+	resp = performJSON(router, "DELETE", "/orgs/"+org.ID+"/members/"+carolID, "", carol.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	stored, err := service.Orgs.GetOrg(org.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{bobID: OrgRoleAdmin}, stored.Members)
+
+	// The members removed, and those of deleted organizations, leave its rooms
+	assert.Equal(t, []string{aliceID, carolID}, removed)
+	resp = performJSON(router, "DELETE", "/orgs/"+org.ID, "", bob.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, []string{aliceID, carolID, bobID}, removed)
+}
+
+func TestOrgs_ConcurrentChanges(t *testing.T) {
+	service := newTestAuthService()
+	router := newOrgRouter(service)
+	alice := signupAndLogin(t, service, "alice", "testPassword1")
+	bob := signupAndLogin(t, service, "bob", "testPassword1")
+	aliceID, bobID := userIDOf(t, service, "alice"), userIDOf(t, service, "bob")
+	org := createOrg(t, router, "acme", alice.AccessToken)
+	resp := performJSON(router, "POST", "/orgs/"+org.ID+"/members", `{"name": "bob", "role": "admin"}`, alice.AccessToken)
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	// Members added at the same time are all kept
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("user%d", i)
+		require.NoError(t, service.Users.Create(&User{ID: name, Name: name, Email: name + "@example.com"}))
+		wg.Add(1)
+		go func(token string) {
+			defer wg.Done()
+			performJSON(router, "POST", "/orgs/"+org.ID+"/members", `{"name": "`+name+`"}`, token)
+		}([]string{alice.AccessToken, bob.AccessToken}[i%2])
+	}
+	wg.Wait()
+	stored, err := service.Orgs.GetOrg(org.ID)
+	require.NoError(t, err)
+	assert.Len(t, stored.Members, 22)
+
+	// Two admins demoting each other at the same time cannot leave the organization without admin
+	codes := make([]int, 2)
+	for i, demotion := range []struct{ token, userID string }{{alice.AccessToken, bobID}, {bob.AccessToken, aliceID}} {
+		wg.Add(1)
+		go func(i int, token, userID string) {
+			defer wg.Done()
+			codes[i] = performJSON(router, "PATCH", "/orgs/"+org.ID+"/members/"+userID, `{"role": "member"}`, token).Code
+		}(i, demotion.token, demotion.userID)
+	}
+	wg.Wait()
+	stored, err = service.Orgs.GetOrg(org.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored.admins())
+	assert.ElementsMatch(t, []int{http.StatusOK, http.StatusForbidden}, codes)
+}
+
+func TestOrgs_Workspaces(t *testing.T) {
+	service := newTestAuthService()
+	router := newOrgRouter(service)
+	alice := signupAndLogin(t, service, "alice", "testPassword1")
+	bob := signupAndLogin(t, service, "bob", "testPassword1")
+	org := createOrg(t, router, "acme", alice.AccessToken)
+	performJSON(router, "POST", "/orgs/"+org.ID+"/members", `{"name": "bob"}`, alice.AccessToken)
+
+	// Members can create workspaces
+	resp := performJSON(router, "POST", "/orgs/"+org.ID+"/workspaces", `{"name": "backend"}`, bob.AccessToken)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	var body struct {
+		Workspace *Workspace `json:"workspace"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, org.ID, body.Workspace.OrgID)
+	resp = performJSON(router, "POST", "/orgs/"+org.ID+"/workspaces", `{"name": "Backend"}`, alice.AccessToken)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+
+	resp = performJSON(router, "GET", "/orgs/"+org.ID+"/workspaces", "", alice.AccessToken)
+	assert.Contains(t, resp.Body.String(), body.Workspace.ID)
+
+	workspace, err := CheckWorkspaceAccess(service.Orgs, body.Workspace.ID, userIDOf(t, service, "bob"))
+	assert.NoError(t, err)
+	assert.Equal(t, "backend", workspace.Name)
+
+	// Only admins delete workspaces
+	resp = performJSON(router, "DELETE", "/orgs/"+org.ID+"/workspaces/"+body.Workspace.ID, "", bob.AccessToken)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	resp = performJSON(router, "DELETE", "/orgs/"+org.ID+"/workspaces/"+body.Workspace.ID, "", alice.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Deleting the organization deletes its workspaces
+	performJSON(router, "POST", "/orgs/"+org.ID+"/workspaces", `{"name": "frontend"}`, alice.AccessToken)
+	resp = performJSON(router, "DELETE", "/orgs/"+org.ID, "", alice.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	workspaces, _ := service.Orgs.ListWorkspaces(org.ID)
+	assert.Empty(t, workspaces)
+}
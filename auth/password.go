@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"errors"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 8  // Minimum number of characters in a password
+	maxPasswordLength = 72 // bcrypt ignores everything after the 72nd byte
+)
+
+// dummyHash is compared against when the user does not exist,
+// so that failed logins take the same time whether or not the user exists.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password 0"), bcrypt.DefaultCost)
+
+// ValidatePassword checks the password against the password policy.
+// Passwords must be 8 to 72 bytes long and contain at least one letter and one digit.
+func ValidatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return errors.New("password must be at least 8 characters long")
+	}
+	if len(password) > maxPasswordLength {
+		return errors.New("password must be at most 72 bytes long")
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return errors.New("password must contain at least one letter and one digit")
+	}
+	return nil
+}
+
+// HashPassword hashes a password with bcrypt.
+func HashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// CheckPassword reports whether the password matches the hash.
+// A nil hash is compared against a dummy hash so the call takes the same time.
+func CheckPassword(hash []byte, password string) bool {
+	if hash == nil {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
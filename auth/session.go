@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")        // No active session matches the lookup
+	ErrSessionRevoked  = errors.New("session has been revoked") // The session was revoked while in use
+)
+
+// Session is a login of a user on a device.
+// Every token pair belongs to a session: the session ID is the "sid" claim of the
+// access tokens and the family of the refresh tokens, so revoking the session
+// invalidates both.
+type Session struct {
+	ID        string    `json:"id"`         // Unique identifier for the session
+	UserID    string    `json:"user_id"`    // User the session belongs to
+	Device    string    `json:"device"`     // User-Agent of the client that logged in
+	IP        string    `json:"ip"`         // IP address of the client
+	CreatedAt time.Time `json:"created_at"` // Time of the login
+	LastSeen  time.Time `json:"last_seen"`  // Time of the last authenticated request
+	ExpiresAt time.Time `json:"expires_at"` // Time the session expires unless refreshed
+}
+
+// SessionStore persists the active sessions.
+type SessionStore interface {
+	// Create adds a new session.
+	Create(session *Session) error
+
+	// Get returns the session with the given ID, or ErrSessionNotFound if it
+	// does not exist, was revoked or expired.
+	Get(id string) (*Session, error)
+
+	// ListByUser returns the active sessions of the user, most recently seen first.
+	ListByUser(userID string) ([]*Session, error)
+
+	// Touch records activity on the session and extends it until expiresAt.
+	// A zero expiresAt keeps the current expiry.
+	Touch(id string, lastSeen, expiresAt time.Time) error
+
+	// Delete removes the session.
+	// Returns ErrSessionNotFound if the session does not exist.
+	Delete(id string) error
+}
+
+// MemorySessionStore is a SessionStore keeping the sessions in memory.
+type MemorySessionStore struct {
+	mutex    sync.RWMutex        // Mutex for safe access to the sessions map
+	sessions map[string]*Session // Sessions, keyed by ID
+	now      func() time.Time
+}
+
+var _ SessionStore = (*MemorySessionStore)(nil)
+
+// NewMemorySessionStore creates an empty in-memory session store.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]*Session),
+		now:      time.Now,
+	}
+}
+
+func (s *MemorySessionStore) Create(session *Session) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored := *session
+	s.sessions[session.ID] = &stored
+	return nil
+}
+
+func (s *MemorySessionStore) Get(id string) (*Session, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	session, ok := s.sessions[id]
+	if !ok || s.now().After(session.ExpiresAt) {
+		return nil, ErrSessionNotFound
+	}
+	found := *session
+	return &found, nil
+}
+
+func (s *MemorySessionStore) ListByUser(userID string) ([]*Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	var sessions []*Session
+	for id, session := range s.sessions {
+		// Expired sessions are pruned as they are encountered
+		if now.After(session.ExpiresAt) {
+			delete(s.sessions, id)
+			continue
+		}
+		if session.UserID == userID {
+			found := *session
+			sessions = append(sessions, &found)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions, nil
+}
+
+func (s *MemorySessionStore) Touch(id string, lastSeen, expiresAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	session.LastSeen = lastSeen
+	if !expiresAt.IsZero() {
+		session.ExpiresAt = expiresAt
+	}
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.sessions[id]; !ok {
+		return ErrSessionNotFound
+	}
+	delete(s.sessions, id)
+	return nil
+}
+
+// sessionConnections tracks the long-lived requests of every session, so they
+// can be cancelled when the session is revoked.
+type sessionConnections struct {
+	mutex   sync.Mutex
+	next    int
+	cancels map[string]map[int]context.CancelCauseFunc // Cancel functions, keyed by session ID and connection number
+}
+
+// track returns a context of the request that is cancelled with ErrSessionRevoked
+// when the session is revoked. The release function must be called once the
+// request is done.
+func (sc *sessionConnections) track(ctx context.Context, sessionID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	sc.mutex.Lock()
+	if sc.cancels == nil {
+		sc.cancels = make(map[string]map[int]context.CancelCauseFunc)
+	}
+	if sc.cancels[sessionID] == nil {
+		sc.cancels[sessionID] = make(map[int]context.CancelCauseFunc)
+	}
+	id := sc.next
+	sc.next++
+	sc.cancels[sessionID][id] = cancel
+	sc.mutex.Unlock()
+
+	return ctx, func() {
+		sc.mutex.Lock()
+		delete(sc.cancels[sessionID], id)
+		if len(sc.cancels[sessionID]) == 0 {
+			delete(sc.cancels, sessionID)
+		}
+		sc.mutex.Unlock()
+		cancel(nil)
+	}
+}
+
+// revoke cancels every tracked request of the session.
+func (sc *sessionConnections) revoke(sessionID string) {
+	sc.mutex.Lock()
+	cancels := sc.cancels[sessionID]
+	delete(sc.cancels, sessionID)
+	sc.mutex.Unlock()
+
+	for _, cancel := range cancels {
+		cancel(ErrSessionRevoked)
+	}
+}
+
+// CloseOnRevoke closes the websocket connection of the request as soon as the
+// session that opened it is revoked. Websocket handlers behind WebsocketMiddleware
+// call it right after upgrading the connection.
+func CloseOnRevoke(r *http.Request, conn *websocket.Conn) {
+	ctx := r.Context()
+	go func() {
+		<-ctx.Done()
+		if !errors.Is(context.Cause(ctx), ErrSessionRevoked) {
+			return
+		}
+		message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, ErrSessionRevoked.Error())
+		conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		conn.Close()
+	}()
+}
+
+// startSession creates a session for the user logging in with the request.
+func (s *AuthService) startSession(user *User, r *http.Request, clientIP string) (*Session, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	now := s.Tokens.now()
+	session := &Session{
+		ID:        id,
+		UserID:    user.ID,
+		Device:    r.UserAgent(),
+		IP:        clientIP,
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(s.Tokens.RefreshTTL),
+	}
+	if err := s.Sessions.Create(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// RevokeSession ends a session of the user: its refresh tokens stop working,
+// its access tokens are rejected and its open websockets are closed.
+// Returns ErrSessionNotFound if the session does not belong to the user.
+func (s *AuthService) RevokeSession(userID, sessionID string) error {
+	session, err := s.Sessions.Get(sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
+	if err := s.Sessions.Delete(sessionID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+	s.Tokens.RevokeFamily(sessionID)
+	s.connections.revoke(sessionID)
+	return nil
+}
+
+// RevokeAllSessions ends every session of the user and revokes their API tokens,
+// so no credential issued before the call keeps working.
+func (s *AuthService) RevokeAllSessions(userID string) error {
+	sessions, err := s.Sessions.ListByUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := s.RevokeSession(userID, session.ID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+	}
+	s.Tokens.RevokeUser(userID)
+	return s.RevokeAllAPITokens(userID)
+}
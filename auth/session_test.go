@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sessionRouter registers the session endpoints behind the auth middleware.
+func sessionRouter(service *AuthService) *gin.Engine {
+	router := gin.New()
+	router.POST("/refresh", service.RefreshHandler)
+	authorized := router.Group("/", service.Middleware())
+	authorized.GET("/sessions", service.ListSessionsHandler)
+	authorized.DELETE("/sessions/:sessionID", service.RevokeSessionHandler)
+	authorized.DELETE("/sessions", service.RevokeAllSessionsHandler)
+	return router
+}
+
+// listSessions returns the sessions listed for the token.
+func listSessions(t *testing.T, router http.Handler, token string) []sessionResponse {
+	resp := performJSON(router, "GET", "/sessions", "", token)
+	require.Equal(t, http.StatusOK, resp.Code)
+	var body struct {
+		Sessions []sessionResponse `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	return body.Sessions
+}
+
+func TestSessions_ListAndRevoke(t *testing.T) {
+	service := newTestAuthService()
+	router := sessionRouter(service)
+	laptop := signupAndLogin(t, service, "testUser", "testPassword1")
+	phone := login(t, service, "testUser", "testPassword1")
+
+	sessions := listSessions(t, router, laptop.AccessToken)
+	require.Len(t, sessions, 2)
+	var current, other string
+	for _, session := range sessions {
+		assert.Equal(t, userIDOf(t, service, "testUser"), session.UserID)
+		assert.Equal(t, "test-agent", session.Device)
+		assert.Equal(t, "192.0.2.1", session.IP)
+		if session.Current {
+			current = session.ID
+		} else {
+			other = session.ID
+		}
+	}
+	require.NotEmpty(t, current)
+	require.NotEmpty(t, other)
+
+	// Revoking the phone session rejects its tokens right away
+	resp := performJSON(router, "DELETE", "/sessions/"+other, "", laptop.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp = performJSON(router, "GET", "/sessions", "", phone.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	resp = performJSON(router, "POST", "/refresh", `{"refresh_token": "`+phone.RefreshToken+`"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Len(t, listSessions(t, router, laptop.AccessToken), 1)
+
+	// Sessions of other users cannot be revoked
+	intruder := signupAndLogin(t, service, "otherUser", "testPassword2")
+	resp = performJSON(router, "DELETE", "/sessions/"+current, "", intruder.AccessToken)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	// Revoking every session logs out the caller as well, and revokes the API tokens
+	_, credential, err := service.CreateAPIToken(userIDOf(t, service, "testUser"), "CI bot", []string{ScopeChatWrite}, 0)
+	require.NoError(t, err)
+	resp = performJSON(router, "DELETE", "/sessions", "", laptop.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp = performJSON(router, "GET", "/sessions", "", laptop.AccessToken)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	_, err = service.authenticateAPIToken(credential)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.Len(t, listSessions(t, router, intruder.AccessToken), 1)
+}
+
+func TestSessions_RefreshExtendsSession(t *testing.T) {
+	service := newTestAuthService()
+	router := sessionRouter(service)
+	tokens := signupAndLogin(t, service, "testUser", "testPassword1")
+	before := listSessions(t, router, tokens.AccessToken)[0]
+
+	later := time.Now().Add(time.Hour)
+	service.Tokens.now = func() time.Time { return later }
+	resp := performJSON(router, "POST", "/refresh", `{"refresh_token": "`+tokens.RefreshToken+`"}`, "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var refreshed TokenPair
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &refreshed))
+
+	after := listSessions(t, router, refreshed.AccessToken)[0]
+	assert.Equal(t, before.ID, after.ID)
+	assert.True(t, after.ExpiresAt.After(before.ExpiresAt))
+	assert.True(t, after.LastSeen.After(before.LastSeen))
+}
+
+func TestSessions_RevokeClosesWebsockets(t *testing.T) {
+	service := newTestAuthService()
+	tokens := signupAndLogin(t, service, "testUser", "testPassword1")
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(service.WebsocketMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		CloseOnRevoke(r, conn)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "?access_token=" + tokens.AccessToken
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	userID := userIDOf(t, service, "testUser")
+	sessions, err := service.Sessions.ListByUser(userID)
+	require.NoError(t, err)
+	require.NoError(t, service.RevokeSession(userID, sessions[0].ID))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+	assert.Equal(t, ErrSessionRevoked.Error(), closeErr.Text)
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionResponse is a session as listed to its user.
+type sessionResponse struct {
+	*Session
+	Current bool `json:"current"` // Indicates whether the request was made with this session
+}
+
+// ListSessionsHandler lists the active sessions of the authenticated user.
+func (s *AuthService) ListSessionsHandler(c *gin.Context) {
+	peer := CurrentPeer(c)
+	sessions, err := s.Sessions.ListByUser(peer.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	current := CurrentSessionID(c)
+	response := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, sessionResponse{Session: session, Current: session.ID == current})
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+// RevokeSessionHandler revokes one session of the authenticated user.
+// The open websockets of the session are closed right away.
+func (s *AuthService) RevokeSessionHandler(c *gin.Context) {
+	peer := CurrentPeer(c)
+	if err := s.RevokeSession(peer.ID, c.Param("sessionID")); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeAllSessionsHandler revokes every session and API token of the
+// authenticated user, including the session making the request.
+func (s *AuthService) RevokeAllSessionsHandler(c *gin.Context) {
+	peer := CurrentPeer(c)
+	if err := s.RevokeAllSessions(peer.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions revoked"})
+}
@@ -1,38 +1,93 @@
 package auth
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
-	"github.com/Rishi-Mishra0704/code-collab-backend/network"
 	"github.com/gin-gonic/gin"
 )
 
-var peers = map[string]network.Peer{}
-
-// SignupHandler handles the signup process for a new peer.
-func SignupHandler(c *gin.Context) {
-	var newPeer network.Peer
-	// Parse the JSON request body into the newPeer struct.
-	if err := c.BindJSON(&newPeer); err != nil {
+// SignupHandler handles the signup process for a new user.
+// The fields are validated and the email normalized before the user is stored,
+// the user ID is generated by the server and only the hash of the password is kept.
+func (s *AuthService) SignupHandler(c *gin.Context) {
+	var signupRequest struct {
+		Name     string `json:"name"`     // Name of the user, used to log in
+		Email    string `json:"email"`    // Email of the user
+		Address  string `json:"address"`  // Host:Port address of the user's peer
+		Password string `json:"password"` // Password in clear text, never stored
+	}
+	// Parse the JSON request body into the signupRequest struct.
+	if err := c.BindJSON(&signupRequest); err != nil {
 		// Respond with an error if the request payload is invalid.
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
-	// Check if the peer ID already exists in the peers map. If it does, return an error.
-	if _, exists := peers[newPeer.ID]; exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Peer ID already exists"})
+
+	// Validate every field, so the client can report all the problems at once.
+	errs := ValidationErrors{}
+	name := strings.TrimSpace(signupRequest.Name)
+	if err := ValidateName(name); err != nil {
+		errs.Add("name", err.Error())
+	}
+	email, err := NormalizeEmail(signupRequest.Email)
+	if err != nil {
+		errs.Add("email", err.Error())
+	}
+	if signupRequest.Address != "" {
+		if err := ValidateAddress(signupRequest.Address); err != nil {
+			errs.Add("address", err.Error())
+		}
+	}
+	if err := ValidatePassword(signupRequest.Password); err != nil {
+		errs.Add("password", err.Error())
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, ValidationResponse(errs))
 		return
 	}
-	// Check if the email already exists among existing peers. If it does, return an error.
-	for _, existingPeer := range peers {
-		if existingPeer.Email == newPeer.Email {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Email already exists"})
+
+	id, err := NewUserID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate user ID"})
+		return
+	}
+	hash, err := HashPassword(signupRequest.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	user := &User{
+		ID:           id,
+		Name:         name,
+		Email:        email,
+		Address:      signupRequest.Address,
+		PasswordHash: hash,
+		CreatedAt:    time.Now(),
+	}
+	// Add the new user to the store. It fails if the name or email is already taken.
+	if err := s.Users.Create(user); err != nil {
+		if errors.Is(err, ErrNameTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "fields": ValidationErrors{"name": "is already taken"}})
 			return
 		}
+		if errors.Is(err, ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "fields": ValidationErrors{"email": "is already taken"}})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Ask the user to confirm the email. The account works meanwhile, so a mail
+	// failure does not fail the signup; the user can ask for a new link.
+	if err := s.SendVerificationEmail(user); err != nil {
+		log.Printf("Failed to send verification email: %v", err)
 	}
 
-	// Add the new peer to the peers map.
-	peers[newPeer.ID] = newPeer
 	// Respond with a success message if the signup process is successful.
-	c.JSON(http.StatusOK, gin.H{"message": "Peer signed up successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Peer signed up successfully", "user": user})
 }
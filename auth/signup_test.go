@@ -2,6 +2,7 @@ package auth
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -12,23 +13,87 @@ import (
 
 func TestSignupHandler(t *testing.T) {
 	// Setup a Gin router
+	service := newTestAuthService()
 	router := gin.Default()
-	router.POST("/signup", SignupHandler)
+	router.POST("/signup", service.SignupHandler)
 
 	// Test case: Valid signup request
-	validPayload := `{"id": "user1", "name": "John Doe", "email": "john@example.com", "password": "password123"}`
+	validPayload := `{"name": "JohnDoe", "email": " John@Example.com ", "password": "password123"}`
 	req, _ := http.NewRequest("POST", "/signup", bytes.NewBufferString(validPayload))
 	req.Header.Set("Content-Type", "application/json")
 	resp := httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
 	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotContains(t, resp.Body.String(), "password")
+
+	// The password is stored hashed
+	user, err := service.Users.GetByName("JohnDoe")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, user.ID)
+	assert.Equal(t, "john@example.com", user.Email)
+	assert.NotEqual(t, "password123", string(user.PasswordHash))
+	assert.True(t, CheckPassword(user.PasswordHash, "password123"))
 
 	// Test case: Invalid request payload
-	invalidPayload := `{"id": "user1", "email": "john@example.com", "password": "password123"}`
+	invalidPayload := `{"email": "john@example.com", "password": "password123"}`
 	req, _ = http.NewRequest("POST", "/signup", bytes.NewBufferString(invalidPayload))
 	req.Header.Set("Content-Type", "application/json")
 	resp = httptest.NewRecorder()
 	router.ServeHTTP(resp, req)
 	assert.Equal(t, http.StatusBadRequest, resp.Code)
 
+	// Test case: Password that does not follow the policy
+	weakPayload := `{"name": "JaneDoe", "email": "jane@example.com", "password": "short"}`
+	req, _ = http.NewRequest("POST", "/signup", bytes.NewBufferString(weakPayload))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	// Test case: Duplicate email
+	duplicatePayload := `{"name": "Johnny", "email": "JOHN@example.com", "password": "password123"}`
+	req, _ = http.NewRequest("POST", "/signup", bytes.NewBufferString(duplicatePayload))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+}
+
+func TestValidatePassword(t *testing.T) {
+	assert.NoError(t, ValidatePassword("password123"))
+	assert.Error(t, ValidatePassword("pass1"))
+	assert.Error(t, ValidatePassword("passwordonly"))
+	assert.Error(t, ValidatePassword("1234567890"))
+	assert.Error(t, ValidatePassword(string(bytes.Repeat([]byte("a1"), 40))))
+}
+
+func TestSignupHandler_FieldErrors(t *testing.T) {
+	service := newTestAuthService()
+	router := gin.New()
+	router.POST("/signup", service.SignupHandler)
+
+	// Every invalid field is reported at once
+	resp := performJSON(router, "POST", "/signup", `{"name": "a b", "email": "John <john@example.com>", "address": "nowhere", "password": "short"}`, "")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	var body struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, "validation failed", body.Error)
+	assert.Len(t, body.Fields, 4)
+	assert.Contains(t, body.Fields, "name")
+	assert.Contains(t, body.Fields, "email")
+	assert.Contains(t, body.Fields, "address")
+	assert.Contains(t, body.Fields, "password")
+
+	// The client cannot pick its ID, and names are unique ignoring case
+	resp = performJSON(router, "POST", "/signup", `{"id": "admin", "name": "Alice", "email": "alice@example.com", "password": "password123"}`, "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	_, err := service.Users.GetByID("admin")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	resp = performJSON(router, "POST", "/signup", `{"name": "alice", "email": "other@example.com", "password": "password123"}`, "")
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"name":"is already taken"`)
 }
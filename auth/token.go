@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute   // Lifetime of access tokens
+	DefaultRefreshTokenTTL = 7 * 24 * time.Hour // Lifetime of refresh tokens
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid or expired token")   // The token is malformed, expired or has a bad signature
+	ErrTokenReused  = errors.New("refresh token already used") // A rotated refresh token was presented again
+)
+
+// Claims are the claims carried by access tokens.
+// The subject is the user ID; the other claims describe the user's peer
+// and the session the token was issued to.
+type Claims struct {
+	Name      string `json:"name"`              // Name of the user
+	Email     string `json:"email"`             // Email of the user
+	Address   string `json:"address,omitempty"` // Host:Port address of the user's peer
+	SessionID string `json:"sid"`               // Session the token belongs to
+	jwt.RegisteredClaims
+
+	Token *APIToken `json:"-"` // API token the request was authenticated with, nil for sessions
+}
+
+// HasScope reports whether the credential grants the scope.
+// Interactive sessions have every scope, API tokens only the ones they were given.
+func (c *Claims) HasScope(scope string) bool {
+	return c.Token == nil || c.Token.HasScope(scope)
+}
+
+// Peer returns the network peer of the authenticated user.
+func (c *Claims) Peer() *network.Peer {
+	return &network.Peer{
+		ID:      c.Subject,
+		Name:    c.Name,
+		Email:   c.Email,
+		Address: c.Address,
+		Online:  true,
+	}
+}
+
+// TokenPair is returned to the client on login and refresh.
+type TokenPair struct {
+	AccessToken  string    `json:"access_token"`  // Signed short-lived JWT
+	RefreshToken string    `json:"refresh_token"` // Opaque single-use token to get a new pair
+	TokenType    string    `json:"token_type"`    // Always "Bearer"
+	ExpiresAt    time.Time `json:"expires_at"`    // Expiry of the access token
+}
+
+// refreshToken is the server-side record of an issued refresh token.
+type refreshToken struct {
+	userID    string    // User the token was issued to
+	family    string    // Session the token belongs to, shared by every rotated token
+	expiresAt time.Time // Time the token expires
+	used      bool      // Indicates whether the token was already rotated
+}
+
+// TokenIssuer issues HMAC-signed access tokens and rotating refresh tokens.
+// Refresh tokens are single use: refreshing consumes the token and issues a new
+// one in the same family, which is the session of the login. Presenting a
+// consumed token again revokes the whole family, since it means the token was stolen.
+type TokenIssuer struct {
+	Secret     []byte        // Key used to sign access tokens
+	Issuer     string        // Value of the "iss" claim
+	AccessTTL  time.Duration // Lifetime of access tokens
+	RefreshTTL time.Duration // Lifetime of refresh tokens
+
+	mutex   sync.Mutex
+	refresh map[string]*refreshToken // Issued refresh tokens, keyed by the SHA-256 of the token
+	now     func() time.Time
+}
+
+// NewTokenIssuer creates a token issuer signing with the given secret and default lifetimes.
+func NewTokenIssuer(secret []byte) *TokenIssuer {
+	return &TokenIssuer{
+		Secret:     secret,
+		Issuer:     "code-collab-backend",
+		AccessTTL:  DefaultAccessTokenTTL,
+		RefreshTTL: DefaultRefreshTokenTTL,
+		refresh:    make(map[string]*refreshToken),
+		now:        time.Now,
+	}
+}
+
+// Issue creates a new token pair for the user in the given session.
+func (ti *TokenIssuer) Issue(user *User, sessionID string) (*TokenPair, error) {
+	return ti.issue(user, sessionID)
+}
+
+// ParseAccessToken verifies the signature and expiry of an access token and returns its claims.
+func (ti *TokenIssuer) ParseAccessToken(token string) (*Claims, error) {
+	claims := new(Claims)
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return ti.Secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(ti.Issuer),
+		jwt.WithTimeFunc(ti.now),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// Rotate consumes a refresh token and returns the user and session it was issued to.
+// The caller then issues the new pair with Issue.
+func (ti *TokenIssuer) Rotate(token string) (userID, sessionID string, err error) {
+	ti.mutex.Lock()
+	defer ti.mutex.Unlock()
+
+	record, ok := ti.refresh[hashToken(token)]
+	if !ok || ti.now().After(record.expiresAt) {
+		return "", "", ErrInvalidToken
+	}
+	if record.used {
+		ti.revokeFamily(record.family)
+		return record.userID, record.family, ErrTokenReused
+	}
+	record.used = true
+	return record.userID, record.family, nil
+}
+
+// RevokeFamily revokes every refresh token issued to the session.
+func (ti *TokenIssuer) RevokeFamily(sessionID string) {
+	ti.mutex.Lock()
+	defer ti.mutex.Unlock()
+
+	ti.revokeFamily(sessionID)
+}
+
+// RevokeUser revokes every refresh token issued to the user.
+func (ti *TokenIssuer) RevokeUser(userID string) {
+	ti.mutex.Lock()
+	defer ti.mutex.Unlock()
+
+	for key, record := range ti.refresh {
+		if record.userID == userID {
+			delete(ti.refresh, key)
+		}
+	}
+}
+
+// issue signs an access token and records a refresh token in the family.
+func (ti *TokenIssuer) issue(user *User, family string) (*TokenPair, error) {
+	now := ti.now()
+	expiresAt := now.Add(ti.AccessTTL)
+
+	tokenID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{
+		Name:      user.Name,
+		Email:     user.Email,
+		Address:   user.Address,
+		SessionID: family,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Subject:   user.ID,
+			Issuer:    ti.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	access, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ti.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	ti.mutex.Lock()
+	ti.refresh[hashToken(refresh)] = &refreshToken{
+		userID:    user.ID,
+		family:    family,
+		expiresAt: now.Add(ti.RefreshTTL),
+	}
+	ti.mutex.Unlock()
+
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// revokeFamily deletes every refresh token of the family.
+// The caller must hold the mutex.
+func (ti *TokenIssuer) revokeFamily(family string) {
+	for key, record := range ti.refresh {
+		if record.family == family {
+			delete(ti.refresh, key)
+		}
+	}
+}
+
+// randomToken returns n random bytes encoded as hexadecimal.
+func randomToken(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// hashToken returns the SHA-256 of a token, so tokens are never stored in clear.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenIssuer_AccessToken(t *testing.T) {
+	issuer := NewTokenIssuer([]byte("secret"))
+	user := &User{ID: "user1", Name: "John", Email: "john@example.com", Address: "127.0.0.1:9000"}
+
+	tokens, err := issuer.Issue(user, "session1")
+	require.NoError(t, err)
+
+	claims, err := issuer.ParseAccessToken(tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", claims.Subject)
+	assert.Equal(t, "session1", claims.SessionID)
+	assert.Equal(t, "127.0.0.1:9000", claims.Peer().Address)
+
+	// A different secret rejects the token
+	_, err = NewTokenIssuer([]byte("other")).ParseAccessToken(tokens.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Expired tokens are rejected
+	issuer.now = func() time.Time { return time.Now().Add(DefaultAccessTokenTTL + time.Minute) }
+	_, err = issuer.ParseAccessToken(tokens.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = issuer.ParseAccessToken("garbage")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestRefreshHandler_RotatesTokens(t *testing.T) {
+	service := newTestAuthService()
+	tokens := signupAndLogin(t, service, "testUser", "testPassword1")
+
+	router := gin.New()
+	router.POST("/refresh", service.RefreshHandler)
+
+	// The refresh token can be exchanged once
+	resp := performJSON(router, "POST", "/refresh", `{"refresh_token": "`+tokens.RefreshToken+`"}`, "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "access_token")
+
+	// Reusing it is rejected and revokes the rotated token as well
+	resp = performJSON(router, "POST", "/refresh", `{"refresh_token": "`+tokens.RefreshToken+`"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Contains(t, resp.Body.String(), ErrTokenReused.Error())
+	assert.Empty(t, service.Tokens.refresh)
+
+	resp = performJSON(router, "POST", "/refresh", `{"refresh_token": "unknown"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestMiddleware(t *testing.T) {
+	service := newTestAuthService()
+	tokens := signupAndLogin(t, service, "testUser", "testPassword1")
+
+	router := gin.New()
+	router.GET("/me", service.Middleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, CurrentPeer(c))
+	})
+
+	resp := performJSON(router, "GET", "/me", "", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = performJSON(router, "GET", "/me", "", "invalid")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = performJSON(router, "GET", "/me", "", tokens.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"id":"`+userIDOf(t, service, "testUser")+`"`)
+
+	// The query parameter is only accepted for websocket upgrades
+	resp = performJSON(router, "GET", "/me?access_token="+tokens.AccessToken, "", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestWebsocketMiddleware(t *testing.T) {
+	service := newTestAuthService()
+	tokens := signupAndLogin(t, service, "testUser", "testPassword1")
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(service.WebsocketMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(PeerFromRequest(r))
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?access_token="+tokens.AccessToken, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	var peer struct {
+		ID string `json:"id"`
+	}
+	require.NoError(t, conn.ReadJSON(&peer))
+	assert.Equal(t, userIDOf(t, service, "testUser"), peer.ID)
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfcSecret is the base32 encoding of the SHA-1 secret of the RFC 6238 test vectors.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// Last six digits of the RFC 6238 appendix B values
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for seconds, expected := range vectors {
+		code, err := TOTPCode(rfcSecret, TOTPStep(time.Unix(seconds, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, code, "time %d", seconds)
+	}
+
+	_, err := TOTPCode("not base32!", 1)
+	assert.Error(t, err)
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := TOTPStep(now)
+	previous, _ := TOTPCode(rfcSecret, step-1)
+	current, _ := TOTPCode(rfcSecret, step)
+	old, _ := TOTPCode(rfcSecret, step-2)
+
+	matched, ok := ValidateTOTP(rfcSecret, current, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, step, matched)
+
+	// One step of clock drift is tolerated
+	_, ok = ValidateTOTP(rfcSecret, previous, now, 0)
+	assert.True(t, ok)
+	_, ok = ValidateTOTP(rfcSecret, old, now, 0)
+	assert.False(t, ok)
+
+	// Codes of steps already used are rejected
+	_, ok = ValidateTOTP(rfcSecret, current, now, step)
+	assert.False(t, ok)
+	_, ok = ValidateTOTP(rfcSecret, previous, now, step-1)
+	assert.False(t, ok)
+
+	_, ok = ValidateTOTP(rfcSecret, "12345", now, 0)
+	assert.False(t, ok)
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(TOTPProvisioningURI("Code Collab", "alice", rfcSecret))
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Code Collab:alice", uri.Path)
+	assert.Equal(t, rfcSecret, uri.Query().Get("secret"))
+	assert.Equal(t, "Code Collab", uri.Query().Get("issuer"))
+	assert.Equal(t, "6", uri.Query().Get("digits"))
+	assert.Equal(t, "30", uri.Query().Get("period"))
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	assert.NoError(t, err)
+	assert.Len(t, codes, RecoveryCodeCount)
+	assert.Len(t, hashes, RecoveryCodeCount)
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		assert.Regexp(t, `^[a-z2-9]{5}-[a-z2-9]{5}$`, code)
+		assert.False(t, seen[code])
+		seen[code] = true
+		// Codes match however they are typed
+		assert.Equal(t, i, matchRecoveryCode(hashes, strings.ToUpper(strings.Replace(code, "-", " ", 1))))
+	}
+	assert.Equal(t, -1, matchRecoveryCode(hashes, "aaaaa-aaaaa"))
+}
@@ -0,0 +1,403 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/ratelimit"
+)
+
+const (
+	TOTPIssuer = "Code Collab" // Issuer shown by authenticator apps
+
+	MFATokenTTL    = 5 * time.Minute // Time allowed to enter the second factor after the password
+	maxMFAAttempts = 5               // Wrong codes allowed per MFA token
+	mfaTokenBytes  = 32              // Random bytes of an MFA token
+)
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled") // The user must disable it before enrolling again
+	ErrTwoFactorDisabled   = errors.New("two-factor authentication is not enabled")     // The user has no second factor
+	ErrNoPendingEnrollment = errors.New("no two-factor enrollment in progress")         // Confirm was called before enroll
+	ErrInvalidCode         = errors.New("invalid two-factor code")                      // The TOTP or recovery code does not match
+	ErrInvalidMFAToken     = errors.New("invalid or expired MFA token")                 // The login must start again with the password
+)
+
+// mfaChallenge is a login waiting for its second factor.
+type mfaChallenge struct {
+	userID    string    // User who entered the right password
+	expiresAt time.Time // Time the challenge expires
+	attempts  int       // Wrong codes entered so far
+}
+
+// mfaChallenges holds the logins waiting for their second factor, keyed by the
+// SHA-256 of the MFA token.
+type mfaChallenges struct {
+	mutex   sync.Mutex
+	pending map[string]*mfaChallenge
+}
+
+// issue creates a challenge for the user, dropping the expired ones.
+func (m *mfaChallenges) issue(userID string, now time.Time) (string, error) {
+	token, err := randomToken(mfaTokenBytes)
+	if err != nil {
+		return "", err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.pending == nil {
+		m.pending = make(map[string]*mfaChallenge)
+	}
+	for key, existing := range m.pending {
+		if now.After(existing.expiresAt) {
+			delete(m.pending, key)
+		}
+	}
+	m.pending[hashToken(token)] = &mfaChallenge{userID: userID, expiresAt: now.Add(MFATokenTTL)}
+	return token, nil
+}
+
+// get returns the user of the challenge, or ErrInvalidMFAToken.
+func (m *mfaChallenges) get(token string, now time.Time) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	challenge, ok := m.pending[hashToken(token)]
+	if !ok || now.After(challenge.expiresAt) {
+		return "", ErrInvalidMFAToken
+	}
+	return challenge.userID, nil
+}
+
+// fail records a wrong code, dropping the challenge after too many.
+func (m *mfaChallenges) fail(token string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key := hashToken(token)
+	if challenge, ok := m.pending[key]; ok {
+		challenge.attempts++
+		if challenge.attempts >= maxMFAAttempts {
+			delete(m.pending, key)
+		}
+	}
+}
+
+// finish removes the challenge once the login is complete.
+func (m *mfaChallenges) finish(token string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.pending, hashToken(token))
+}
+
+// completeLogin responds to a login whose first factor succeeded. Users with
+// two-factor authentication get an MFA token to exchange with their code at
+// /login/2fa; the others get a new session right away.
+func (s *AuthService) completeLogin(c *gin.Context, user *User) {
+	if user.TwoFactorEnabled {
+		token, err := s.mfaChallenges.issue(user.ID, s.Tokens.now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor login"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication required", "mfa_required": true, "mfa_token": token})
+		return
+	}
+	s.respondWithSession(c, user)
+}
+
+// respondWithSession starts a session for the user and responds with its tokens.
+func (s *AuthService) respondWithSession(c *gin.Context, user *User) {
+	// Every login is a new session, listed with the device and IP it came from
+	session, err := s.startSession(user, c.Request, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+		return
+	}
+	tokens, err := s.Tokens.Issue(user, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User logged in successfully", "user": user, "tokens": tokens})
+}
+
+// checkSecondFactor checks a TOTP code or a recovery code of the user, applies
+// the change to the user if set, and stores the user, so neither code can be
+// used twice and concurrent checks cannot undo the change.
+func (s *AuthService) checkSecondFactor(userID, code string, change func(*User)) (*User, error) {
+	s.twoFactorMutex.Lock()
+	defer s.twoFactorMutex.Unlock()
+
+	user, err := s.Users.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TwoFactorEnabled {
+		return nil, ErrTwoFactorDisabled
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := ValidateTOTP(user.TOTPSecret, code, s.Tokens.now(), user.TOTPLastStep); ok {
+		user.TOTPLastStep = step
+	} else if index := matchRecoveryCode(user.RecoveryCodes, code); index >= 0 {
+		user.RecoveryCodes = append(user.RecoveryCodes[:index], user.RecoveryCodes[index+1:]...)
+	} else {
+		return nil, ErrInvalidCode
+	}
+	if change != nil {
+		change(user)
+	}
+	if err := s.Users.Update(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// matchRecoveryCode returns the index of the hash of the code, or -1.
+func matchRecoveryCode(hashes []string, code string) int {
+	code = normalizeRecoveryCode(code)
+	if len(code) != recoveryCodeChars {
+		return -1
+	}
+	hash := hashToken(code)
+	for i, stored := range hashes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			return i
+		}
+	}
+	return -1
+}
+
+// twoFactorRequest is the body of the endpoints expecting a code.
+type twoFactorRequest struct {
+	Code string `json:"code"` // TOTP code, or recovery code where accepted
+}
+
+// LoginTwoFactorHandler completes a login with the MFA token returned by the
+// login and a TOTP or recovery code. Wrong codes count as failed logins.
+func (s *AuthService) LoginTwoFactorHandler(c *gin.Context) {
+	var loginRequest struct {
+		MFAToken string `json:"mfa_token"` // Token returned by the login
+		Code     string `json:"code"`      // TOTP code or unused recovery code
+	}
+	if err := c.BindJSON(&loginRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	userID, err := s.mfaChallenges.get(loginRequest.MFAToken, s.Tokens.now())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := s.Users.GetByID(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidMFAToken.Error()})
+		return
+	}
+
+	account := strings.ToLower(user.Name)
+	ip := c.ClientIP()
+	if wait, locked := s.loginWait(account, ip); wait > 0 {
+		ratelimit.SetRetryAfter(c.Writer, wait)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later", "locked": locked})
+		return
+	}
+
+	verified, err := s.checkSecondFactor(userID, loginRequest.Code, nil)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			s.mfaChallenges.fail(loginRequest.MFAToken)
+			s.loginFailed(user, account, ip)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidMFAToken.Error()})
+		return
+	}
+	s.mfaChallenges.finish(loginRequest.MFAToken)
+	s.LoginAccounts.Success(account)
+
+	s.respondWithSession(c, verified)
+}
+
+// EnrollTOTPHandler starts the enrollment of an authenticator app for the
+// authenticated user. The secret is only used once confirmed with a code.
+func (s *AuthService) EnrollTOTPHandler(c *gin.Context) {
+	s.twoFactorMutex.Lock()
+	defer s.twoFactorMutex.Unlock()
+
+	user, err := s.Users.GetByID(CurrentPeer(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": ErrTwoFactorEnabled.Error()})
+		return
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	user.TOTPPendingSecret = secret
+	if err := s.Users.Update(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": TOTPProvisioningURI(TOTPIssuer, user.Name, secret),
+	})
+}
+
+// ConfirmTOTPHandler enables two-factor authentication once the user enters a
+// code of the enrolled app. The recovery codes are only returned here.
+func (s *AuthService) ConfirmTOTPHandler(c *gin.Context) {
+	var confirmRequest twoFactorRequest
+	if err := c.BindJSON(&confirmRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	s.twoFactorMutex.Lock()
+	defer s.twoFactorMutex.Unlock()
+
+	user, err := s.Users.GetByID(CurrentPeer(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if user.TwoFactorEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": ErrTwoFactorEnabled.Error()})
+		return
+	}
+	if user.TOTPPendingSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrNoPendingEnrollment.Error()})
+		return
+	}
+	step, ok := ValidateTOTP(user.TOTPPendingSecret, strings.TrimSpace(confirmRequest.Code), s.Tokens.now(), 0)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidCode.Error()})
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	user.TwoFactorEnabled = true
+	user.TOTPSecret = user.TOTPPendingSecret
+	user.TOTPPendingSecret = ""
+	user.TOTPLastStep = step
+	user.RecoveryCodes = hashes
+	if err := s.Users.Update(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled", "recovery_codes": codes})
+}
+
+// DisableTwoFactorHandler turns two-factor authentication off after checking a
+// TOTP or recovery code, so a stolen session alone cannot remove it.
+func (s *AuthService) DisableTwoFactorHandler(c *gin.Context) {
+	var disableRequest twoFactorRequest
+	if err := c.BindJSON(&disableRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	disable := func(user *User) {
+		user.TwoFactorEnabled = false
+		user.TOTPSecret = ""
+		user.TOTPLastStep = 0
+		user.RecoveryCodes = nil
+	}
+	if !s.verifySecondFactor(c, disableRequest.Code, disable) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodesHandler replaces the recovery codes of the user after
+// checking a TOTP code. The previous codes stop working.
+func (s *AuthService) RegenerateRecoveryCodesHandler(c *gin.Context) {
+	var regenerateRequest twoFactorRequest
+	if err := c.BindJSON(&regenerateRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	// Only an authenticator code proves the user still has their second factor
+	if len(strings.TrimSpace(regenerateRequest.Code)) != TOTPDigits {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidCode.Error()})
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	replace := func(user *User) {
+		user.RecoveryCodes = hashes
+	}
+	if !s.verifySecondFactor(c, regenerateRequest.Code, replace) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Recovery codes regenerated", "recovery_codes": codes})
+}
+
+// verifySecondFactor checks a code of the authenticated user and applies the
+// change to the user, as checkSecondFactor does. Wrong codes count as failed
+// logins, so a stolen session cannot guess codes without limit.
+// It responds with an error and returns false if the code was not verified.
+func (s *AuthService) verifySecondFactor(c *gin.Context, code string, change func(*User)) bool {
+	user, err := s.Users.GetByID(CurrentPeer(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+
+	account := strings.ToLower(user.Name)
+	ip := c.ClientIP()
+	if wait, locked := s.loginWait(account, ip); wait > 0 {
+		ratelimit.SetRetryAfter(c.Writer, wait)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later", "locked": locked})
+		return false
+	}
+
+	if _, err := s.checkSecondFactor(user.ID, code, change); err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			s.loginFailed(user, account, ip)
+		}
+		s.respondSecondFactorError(c, err)
+		return false
+	}
+	s.LoginAccounts.Success(account)
+	return true
+}
+
+// respondSecondFactorError maps the errors of checkSecondFactor to responses.
+func (s *AuthService) respondSecondFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrTwoFactorDisabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
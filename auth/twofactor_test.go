@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTwoFactorRouter returns a router with the login and two-factor endpoints.
+func newTwoFactorRouter(service *AuthService) *gin.Engine {
+	router := gin.New()
+	router.POST("/login", service.LoginHandler)
+	router.POST("/login/2fa", service.LoginTwoFactorHandler)
+	authorized := router.Group("/", service.Middleware(), RequireSession())
+	authorized.POST("/2fa/enroll", service.EnrollTOTPHandler)
+	authorized.POST("/2fa/confirm", service.ConfirmTOTPHandler)
+	authorized.POST("/2fa/disable", service.DisableTwoFactorHandler)
+	authorized.POST("/2fa/recovery-codes", service.RegenerateRecoveryCodesHandler)
+	return router
+}
+
+// enableTwoFactor enrolls and confirms TOTP for the user, returning the secret
+// and the recovery codes.
+func enableTwoFactor(t *testing.T, service *AuthService, router http.Handler, accessToken string) (string, []string) {
+	resp := performJSON(router, "POST", "/2fa/enroll", "", accessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var enrollment struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &enrollment))
+	assert.Contains(t, enrollment.ProvisioningURI, "secret="+enrollment.Secret)
+
+	code, _ := TOTPCode(enrollment.Secret, TOTPStep(service.Tokens.now()))
+	resp = performJSON(router, "POST", "/2fa/confirm", `{"code": "`+code+`"}`, accessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var confirmation struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &confirmation))
+	assert.Len(t, confirmation.RecoveryCodes, RecoveryCodeCount)
+	return enrollment.Secret, confirmation.RecoveryCodes
+}
+
+// startTwoFactorLogin logs in with the password and returns the MFA token.
+func startTwoFactorLogin(t *testing.T, router http.Handler) string {
+	resp := performJSON(router, "POST", "/login", `{"name": "testUser", "password": "testPassword1"}`, "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var body struct {
+		MFARequired bool             `json:"mfa_required"`
+		MFAToken    string           `json:"mfa_token"`
+		Tokens      *json.RawMessage `json:"tokens"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.True(t, body.MFARequired)
+	assert.Nil(t, body.Tokens)
+	return body.MFAToken
+}
+
+func TestTwoFactor_EnrollAndLogin(t *testing.T) {
+	service := newTestAuthService()
+	now := time.Now()
+	service.Tokens.now = func() time.Time { return now }
+	tokens := signupAndLogin(t, service, "testUser", "testPassword1")
+	router := newTwoFactorRouter(service)
+
+	// Confirming requires an enrollment
+	resp := performJSON(router, "POST", "/2fa/confirm", `{"code": "123456"}`, tokens.AccessToken)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	secret, _ := enableTwoFactor(t, service, router, tokens.AccessToken)
+	user, _ := service.Users.GetByName("testUser")
+	assert.True(t, user.TwoFactorEnabled)
+	resp = performJSON(router, "POST", "/2fa/enroll", "", tokens.AccessToken)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+
+	// The password alone only returns an MFA token
+	mfaToken := startTwoFactorLogin(t, router)
+
+	// The code used to confirm the enrollment cannot be replayed
+	used, _ := TOTPCode(secret, TOTPStep(now))
+	resp = performJSON(router, "POST", "/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "`+used+`"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	now = now.Add(TOTPPeriod)
+	code, _ := TOTPCode(secret, TOTPStep(now))
+	resp = performJSON(router, "POST", "/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "`+code+`"}`, "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var body struct {
+		Tokens TokenPair `json:"tokens"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	_, err := service.Tokens.ParseAccessToken(body.Tokens.AccessToken)
+	assert.NoError(t, err)
+
+	// The MFA token is single use
+	resp = performJSON(router, "POST", "/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "`+code+`"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestTwoFactor_RecoveryCodes(t *testing.T) {
+	service := newTestAuthService()
+	now := time.Now()
+	service.Tokens.now = func() time.Time { return now }
+	tokens := signupAndLogin(t, service, "testUser", "testPassword1")
+	router := newTwoFactorRouter(service)
+	secret, recoveryCodes := enableTwoFactor(t, service, router, tokens.AccessToken)
+
+	// A recovery code logs in once
+	resp := performJSON(router, "POST", "/login/2fa", `{"mfa_token": "`+startTwoFactorLogin(t, router)+`", "code": "`+recoveryCodes[0]+`"}`, "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp = performJSON(router, "POST", "/login/2fa", `{"mfa_token": "`+startTwoFactorLogin(t, router)+`", "code": "`+recoveryCodes[0]+`"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	// Regenerating requires a TOTP code and replaces the codes
+	resp = performJSON(router, "POST", "/2fa/recovery-codes", `{"code": "`+recoveryCodes[1]+`"}`, tokens.AccessToken)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	now = now.Add(TOTPPeriod)
+	code, _ := TOTPCode(secret, TOTPStep(now))
+	resp = performJSON(router, "POST", "/2fa/recovery-codes", `{"code": "`+code+`"}`, tokens.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp = performJSON(router, "POST", "/login/2fa", `{"mfa_token": "`+startTwoFactorLogin(t, router)+`", "code": "`+recoveryCodes[1]+`"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestTwoFactor_Disable(t *testing.T) {
+	service := newTestAuthService()
+	now := time.Now()
+	service.Tokens.now = func() time.Time { return now }
+	tokens := signupAndLogin(t, service, "testUser", "testPassword1")
+	router := newTwoFactorRouter(service)
+	_, recoveryCodes := enableTwoFactor(t, service, router, tokens.AccessToken)
+
+	resp := performJSON(router, "POST", "/2fa/disable", `{"code": "000000"}`, tokens.AccessToken)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	resp = performJSON(router, "POST", "/2fa/disable", `{"code": "`+recoveryCodes[0]+`"}`, tokens.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp = performJSON(router, "POST", "/2fa/disable", `{"code": "`+recoveryCodes[1]+`"}`, tokens.AccessToken)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+
+	// The password is enough again
+	login(t, service, "testUser", "testPassword1")
+}
+
+func TestTwoFactor_WrongCodesAreThrottled(t *testing.T) {
+	service := newTestAuthService()
+	tokens := signupAndLogin(t, service, "testUser", "testPassword1")
+	router := newTwoFactorRouter(service)
+	enableTwoFactor(t, service, router, tokens.AccessToken)
+
+	// Each MFA token allows a few attempts, and every wrong code counts as a failed login
+	mfaToken := startTwoFactorLogin(t, router)
+	for i := 0; i < 4; i++ {
+		resp := performJSON(router, "POST", "/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "000000"}`, "")
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	}
+	resp := performJSON(router, "POST", "/login/2fa", `{"mfa_token": "`+mfaToken+`", "code": "000000"}`, "")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+
+	// A correct password does not reset the failures of the second factor
+	resp = performJSON(router, "POST", "/login", `{"name": "testUser", "password": "testPassword1"}`, "")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+}
+
+func TestTwoFactor_DisableIsThrottled(t *testing.T) {
+	service := newTestAuthService()
+	tokens := signupAndLogin(t, service, "testUser", "testPassword1")
+	router := newTwoFactorRouter(service)
+	enableTwoFactor(t, service, router, tokens.AccessToken)
+
+	// A stolen session cannot guess codes any faster than a login
+	for i := 0; i < 4; i++ {
+		resp := performJSON(router, "POST", "/2fa/disable", `{"code": "000000"}`, tokens.AccessToken)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	}
+	resp := performJSON(router, "POST", "/2fa/disable", `{"code": "000000"}`, tokens.AccessToken)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.NotEmpty(t, resp.Header().Get("Retry-After"))
+	resp = performJSON(router, "POST", "/2fa/recovery-codes", `{"code": "000000"}`, tokens.AccessToken)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	resp = performJSON(router, "POST", "/login", `{"name": "testUser", "password": "testPassword1"}`, "")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+}
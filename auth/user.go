@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")         // No user matches the lookup
+	ErrUserExists   = errors.New("user already exists")    // The user ID is already taken
+	ErrNameTaken    = errors.New("name is already taken")  // Another user has the same name, ignoring case
+	ErrEmailTaken   = errors.New("email is already taken") // Another user has the same email
+)
+
+// User is an account registered with the backend.
+// The password is only stored as a hash and never serialized.
+type User struct {
+	ID           string    `json:"id"`         // Unique identifier for the user, also used as peer ID
+	Name         string    `json:"name"`       // Name of the user, used to log in
+	Email        string    `json:"email"`      // Email of the user
+	Address      string    `json:"address"`    // Host:Port address of the user's peer
+	PasswordHash []byte    `json:"-"`          // Hash of the user's password, empty for users of identity providers
+	CreatedAt    time.Time `json:"created_at"` // Time the user signed up
+
+	EmailVerified bool `json:"email_verified"` // Indicates whether the user proved they own the email
+
+	Identities map[string]string `json:"identities,omitempty"` // Subjects of the linked external identities, keyed by provider
+
+	TwoFactorEnabled  bool     `json:"two_factor_enabled"` // Indicates whether logins require a TOTP or recovery code
+	TOTPSecret        string   `json:"-"`                  // Base32 TOTP secret, empty unless two-factor authentication is enabled
+	TOTPPendingSecret string   `json:"-"`                  // Secret waiting for the enrollment to be confirmed
+	TOTPLastStep      int64    `json:"-"`                  // Time step of the last accepted code, so codes cannot be replayed
+	RecoveryCodes     []string `json:"-"`                  // SHA-256 hashes of the unused recovery codes
+}
+
+// Peer returns the network peer representing the user.
+func (u *User) Peer() *network.Peer {
+	return &network.Peer{
+		ID:      u.ID,
+		Name:    u.Name,
+		Email:   u.Email,
+		Address: u.Address,
+		Online:  true,
+	}
+}
+
+// clone returns a deep copy of the user, so stored users are never shared.
+func (u *User) clone() *User {
+	cloned := *u
+	if u.Identities != nil {
+		cloned.Identities = make(map[string]string, len(u.Identities))
+		for provider, subject := range u.Identities {
+			cloned.Identities[provider] = subject
+		}
+	}
+	cloned.RecoveryCodes = append([]string(nil), u.RecoveryCodes...)
+	return &cloned
+}
+
+// UserStore persists the registered users.
+type UserStore interface {
+	// Create adds a new user.
+	// Returns an error if the ID, name or email is already taken.
+	Create(user *User) error
+
+	// Update replaces a stored user.
+	// Returns ErrUserNotFound if the user does not exist.
+	Update(user *User) error
+
+	// GetByID returns the user with the given ID, or ErrUserNotFound.
+	GetByID(id string) (*User, error)
+
+	// GetByName returns the user with the given name, or ErrUserNotFound.
+	// Names are compared case-insensitively.
+	GetByName(name string) (*User, error)
+
+	// GetByEmail returns the user with the given email, or ErrUserNotFound.
+	// Emails are compared case-insensitively.
+	GetByEmail(email string) (*User, error)
+
+	// GetByIdentity returns the user linked to the external identity, or ErrUserNotFound.
+	GetByIdentity(provider, subject string) (*User, error)
+}
+
+// MemoryUserStore is a UserStore keeping the users in memory.
+type MemoryUserStore struct {
+	mutex sync.RWMutex     // Mutex for safe access to the users map
+	users map[string]*User // Users, keyed by ID
+}
+
+var _ UserStore = (*MemoryUserStore)(nil)
+
+// NewMemoryUserStore creates an empty in-memory user store.
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{
+		users: make(map[string]*User),
+	}
+}
+
+func (s *MemoryUserStore) Create(user *User) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.users[user.ID]; exists {
+		return ErrUserExists
+	}
+	if err := s.checkUnique(user); err != nil {
+		return err
+	}
+
+	s.users[user.ID] = user.clone()
+	return nil
+}
+
+func (s *MemoryUserStore) Update(user *User) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.users[user.ID]; !exists {
+		return ErrUserNotFound
+	}
+	if err := s.checkUnique(user); err != nil {
+		return err
+	}
+
+	s.users[user.ID] = user.clone()
+	return nil
+}
+
+func (s *MemoryUserStore) GetByID(id string) (*User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return user.clone(), nil
+}
+
+func (s *MemoryUserStore) GetByName(name string) (*User, error) {
+	return s.find(func(user *User) bool { return strings.EqualFold(user.Name, name) })
+}
+
+func (s *MemoryUserStore) GetByEmail(email string) (*User, error) {
+	return s.find(func(user *User) bool { return strings.EqualFold(user.Email, email) })
+}
+
+func (s *MemoryUserStore) GetByIdentity(provider, subject string) (*User, error) {
+	return s.find(func(user *User) bool {
+		linked, ok := user.Identities[provider]
+		return ok && linked == subject
+	})
+}
+
+// find returns a copy of the first user matching the predicate.
+func (s *MemoryUserStore) find(match func(*User) bool) (*User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, user := range s.users {
+		if match(user) {
+			return user.clone(), nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// checkUnique returns an error if another user has the same name or email.
+// The caller must hold the mutex.
+func (s *MemoryUserStore) checkUnique(user *User) error {
+	for id, existing := range s.users {
+		if id == user.ID {
+			continue
+		}
+		if strings.EqualFold(existing.Name, user.Name) {
+			return ErrNameTaken
+		}
+		if strings.EqualFold(existing.Email, user.Email) {
+			return ErrEmailTaken
+		}
+	}
+	return nil
+}
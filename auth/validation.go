@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"errors"
+	"net"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+var (
+	peerIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)        // Characters allowed in peer IDs
+	namePattern   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`) // Characters allowed in names
+	roomIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)               // Format of the generated room IDs
+)
+
+const (
+	minNameLength = 3  // Minimum number of characters in a name
+	maxNameLength = 32 // Maximum number of characters in a name
+)
+
+// ValidationErrors maps the invalid fields of a request to the reason they were rejected.
+type ValidationErrors map[string]string
+
+// Add records an error on a field, keeping the first error of every field.
+func (e ValidationErrors) Add(field, message string) {
+	if _, exists := e[field]; !exists {
+		e[field] = message
+	}
+}
+
+// Err returns the errors as an error, or nil if there is none.
+func (e ValidationErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e ValidationErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = field + " " + e[field]
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ValidationResponse is the body of the 400 responses rejecting invalid fields,
+// so every endpoint reports them the same way.
+func ValidationResponse(errs ValidationErrors) gin.H {
+	return gin.H{"error": "validation failed", "fields": errs}
+}
+
+// ValidatePeerID checks that the ID only contains letters, digits, dashes and underscores.
+func ValidatePeerID(id string) error {
+	if id == "" {
+		return errors.New("is required")
+	}
+	if !peerIDPattern.MatchString(id) {
+		return errors.New("must be 1 to 64 letters, digits, dashes or underscores")
+	}
+	return nil
+}
+
+// ValidateName checks that the name is 3 to 32 characters long and made of
+// letters, digits, dots, dashes and underscores, starting with a letter or digit.
+func ValidateName(name string) error {
+	if name == "" {
+		return errors.New("is required")
+	}
+	if len(name) < minNameLength || len(name) > maxNameLength {
+		return errors.New("must be 3 to 32 characters long")
+	}
+	if !namePattern.MatchString(name) {
+		return errors.New("must only contain letters, digits, dots, dashes and underscores")
+	}
+	return nil
+}
+
+// NormalizeEmail checks the email address and returns its canonical form,
+// trimmed and in lowercase.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", errors.New("is required")
+	}
+	// Reject display names such as "John <john@example.com>"
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return "", errors.New("must be a valid email address")
+	}
+	at := strings.LastIndex(email, "@")
+	if !strings.Contains(email[at+1:], ".") {
+		return "", errors.New("must be a valid email address")
+	}
+	return strings.ToLower(email), nil
+}
+
+// ValidateAddress checks that the address is a host:port pair with a valid port.
+func ValidateAddress(address string) error {
+	if address == "" {
+		return errors.New("is required")
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host == "" {
+		return errors.New("must be a host:port address")
+	}
+	if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+		return errors.New("must have a port between 1 and 65535")
+	}
+	return nil
+}
+
+// ValidateRoomID checks that the room ID has the format of the generated room IDs.
+func ValidateRoomID(roomID string) error {
+	if roomID == "" {
+		return errors.New("is required")
+	}
+	if !roomIDPattern.MatchString(roomID) {
+		return errors.New("must be a 16 character hexadecimal room ID")
+	}
+	return nil
+}
+
+// ValidatePeer checks the identity fields of a peer.
+// The address is only checked when requireAddress is set or the address is not empty.
+func ValidatePeer(peer *network.Peer, requireAddress bool) ValidationErrors {
+	errs := ValidationErrors{}
+	if err := ValidatePeerID(peer.ID); err != nil {
+		errs.Add("id", err.Error())
+	}
+	if err := ValidateName(peer.Name); err != nil {
+		errs.Add("name", err.Error())
+	}
+	if _, err := NormalizeEmail(peer.Email); err != nil {
+		errs.Add("email", err.Error())
+	}
+	if requireAddress || peer.Address != "" {
+		if err := ValidateAddress(peer.Address); err != nil {
+			errs.Add("address", err.Error())
+		}
+	}
+	return errs
+}
+
+// NewUserID generates a random ID for a new user.
+func NewUserID() (string, error) {
+	return randomToken(8)
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	email, err := NormalizeEmail("  John.Doe@Example.COM ")
+	assert.NoError(t, err)
+	assert.Equal(t, "john.doe@example.com", email)
+
+	for _, invalid := range []string{"", "john", "john@", "@example.com", "john@localhost", "John <john@example.com>", "john@example.com, jane@example.com"} {
+		_, err := NormalizeEmail(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestValidateFields(t *testing.T) {
+	assert.NoError(t, ValidatePeerID("peer_1-a"))
+	assert.Error(t, ValidatePeerID(""))
+	assert.Error(t, ValidatePeerID("peer 1"))
+
+	assert.NoError(t, ValidateName("john.doe"))
+	assert.Error(t, ValidateName("jo"))
+	assert.Error(t, ValidateName("-john"))
+	assert.Error(t, ValidateName("john doe"))
+
+	assert.NoError(t, ValidateAddress("127.0.0.1:8080"))
+	assert.NoError(t, ValidateAddress("[::1]:8080"))
+	assert.NoError(t, ValidateAddress("example.com:443"))
+	assert.Error(t, ValidateAddress(":8080"))
+	assert.Error(t, ValidateAddress("127.0.0.1"))
+	assert.Error(t, ValidateAddress("127.0.0.1:0"))
+	assert.Error(t, ValidateAddress("127.0.0.1:http"))
+
+	assert.NoError(t, ValidateRoomID("0123456789abcdef"))
+	assert.Error(t, ValidateRoomID("room1"))
+}
+
+func TestValidatePeer(t *testing.T) {
+	peer := &network.Peer{ID: "peer1", Name: "john", Email: "john@example.com"}
+	assert.Empty(t, ValidatePeer(peer, false))
+	assert.Equal(t, ValidationErrors{"address": "is required"}, ValidatePeer(peer, true))
+
+	errs := ValidatePeer(&network.Peer{Email: "invalid"}, false)
+	assert.Equal(t, "email must be a valid email address; id is required; name is required", errs.Error())
+	assert.Nil(t, ValidationErrors{}.Err())
+}
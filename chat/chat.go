@@ -2,6 +2,8 @@ package chat
 
 import (
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/Rishi-Mishra0704/code-collab-backend/network"
@@ -9,8 +11,18 @@ import (
 
 // ChatService represents the chat service responsible for managing the chat system.
 // It provides methods for sending and receiving messages, as well as managing connections with peers.
+// Messages are pushed to the subscribers of their room as they are sent.
 type ChatService struct {
 	TCPTransport *network.TCPTransport // Reference to the TCPTransport instance
+	Retention    RetentionPolicy       // Bounds of the chat history kept for every room
+	Files        WorkspaceFiles        // Files of the workspaces, nil if snippets cannot reference files
+
+	mutex       sync.Mutex                            // Mutex for safe access to the subscribers map
+	subscribers map[string]map[*Subscription]struct{} // Subscribers of every room, keyed by room ID
+	now         func() time.Time                      // Clock timestamping the messages, replaced in tests
+	reads       map[string]map[string]int             // Last message read, keyed by room ID then peer ID; guarded by the transport mutex
+	indexes     map[string]*roomIndex                 // Search indexes of the rooms, keyed by room ID; guarded by the transport mutex
+	direct      map[string]*conversation              // Direct conversations, keyed by ID; guarded by the transport mutex
 }
 
 // NewChatService creates a new instance of ChatService with the provided transport layer.
@@ -18,38 +30,194 @@ type ChatService struct {
 func NewChatService(transport *network.TCPTransport) *ChatService {
 	return &ChatService{
 		TCPTransport: transport,
+		Retention:    DefaultRetentionPolicy(),
+		subscribers:  make(map[string]map[*Subscription]struct{}),
+		now:          time.Now,
+		reads:        make(map[string]map[string]int),
+		indexes:      make(map[string]*roomIndex),
+		direct:       make(map[string]*conversation),
 	}
 }
 
 // SendMessage sends a chat message to a specific room.
 func (cs *ChatService) Send(roomID string, sender *network.Peer, content string) error {
-	// Create a new chat message with current timestamp
-	timestamp := time.Now().Format("02-01-2006")
+	_, err := cs.post(roomID, 0, textMessage(sender, content))
+	return err
+}
 
-	// Retrieve the room from the TCPTransport
+// textMessage returns a text message to post.
+func textMessage(sender *network.Peer, content string) *network.ChatMessage {
+	return &network.ChatMessage{Sender: sender, Body: content, Kind: network.ChatMessageText}
+}
+
+// post adds a message made of a sender, a body, a kind and the content of its
+// kind to the chat history of the room, as a reply to the parent message if
+// parentID is set, and pushes it to the connected clients.
+func (cs *ChatService) post(roomID string, parentID int, message *network.ChatMessage) (*network.ChatMessage, error) {
 	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+	room, err := cs.room(roomID, message.Sender.ID)
+	if err != nil {
+		return nil, err
+	}
+	message, parent, err := cs.store(roomID, room, parentID, message)
+	if err != nil {
+		return nil, err
+	}
+
+	// Push the message to the connected clients, before the lock is released so
+	// they receive the messages in the order of their IDs
+	cs.publish(&ChatEvent{Type: EventMessage, RoomID: roomID, ID: message.ID, Message: message})
+	if parent != nil {
+		cs.publish(&ChatEvent{Type: EventThread, RoomID: roomID, ID: parent.ID, Message: parent})
+	}
+	if isDirect(roomID) {
+		cs.notify(EventDirect, message, peerIDs(room))
+	} else {
+		cs.notifyMentions(message, message.Mentions)
+	}
+	return message, nil
+}
+
+// store adds a message to the chat history of the room, dropping the oldest ones.
+// It returns the message and, for replies, the parent with its updated thread summary.
+// The caller must hold the transport mutex.
+func (cs *ChatService) store(roomID string, room *network.Room, parentID int, message *network.ChatMessage) (*network.ChatMessage, *network.ChatMessage, error) {
+	author := *message.Sender
+	message.ID = room.LastChatID() + 1
+	message.RoomID = roomID
+	message.Sender = &author
+	message.SentAt = cs.now().UTC()
+	message.Mentions = mentions(room, message.Body)
+	var parent *network.ChatMessage
+	if parentID != 0 {
+		i, err := threadIndex(room, parentID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if room.Chat[i].Deleted() {
+			return nil, nil, ErrMessageDeleted
+		}
+		parent = room.Chat[i].Clone()
+		replies := 0
+		if parent.Thread != nil {
+			replies = parent.Thread.Replies
+		}
+		parent.Thread = &network.ThreadSummary{
+			Replies:      replies + 1,
+			LastReplyID:  message.ID,
+			LastReplyAt:  message.SentAt,
+			LastSenderID: author.ID,
+		}
+		room.Chat[i] = parent
+		message.ParentID = parent.ID
+	}
+	room.Chat = append(room.Chat, message)
+	cs.indexMessage(message)
+	cs.retain(room)
+	return message, parent, nil
+}
+
+// room returns the room or the direct conversation with the ID, if the peer is
+// one of its members. Direct conversations are only found by their participants.
+// The caller must hold the transport mutex.
+func (cs *ChatService) room(roomID, peerID string) (*network.Room, error) {
+	if isDirect(roomID) {
+		conv, ok := cs.direct[roomID]
+		if !ok {
+			return nil, ErrConversationNotFound
+		}
+		if _, ok := conv.Peers[peerID]; !ok {
+			return nil, ErrConversationNotFound
+		}
+		return conv.Room, nil
+	}
+	room, err := cs.lookup(roomID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := room.Peers[peerID]; !ok {
+		return nil, ErrNotRoomMember
+	}
+	return room, nil
+}
+
+// lookup returns the room with the ID, whoever asks. Direct conversations are
+// never found without a participant.
+// The caller must hold the transport mutex.
+func (cs *ChatService) lookup(roomID string) (*network.Room, error) {
+	if isDirect(roomID) {
+		return nil, ErrConversationNotFound
+	}
 	room, ok := cs.TCPTransport.Rooms[roomID]
-	cs.TCPTransport.Mutex.Unlock()
 	if !ok {
-		return fmt.Errorf("room %s does not exist", roomID)
+		return nil, fmt.Errorf("room %s does not exist", roomID)
+	}
+	return room, nil
+}
+
+// peerIDs returns the IDs of the peers of the room.
+// The caller must hold the transport mutex.
+func peerIDs(room *network.Room) []string {
+	ids := make([]string, 0, len(room.Peers))
+	for peerID := range room.Peers {
+		ids = append(ids, peerID)
+	}
+	return ids
+}
+
+// exists reports whether the room or direct conversation still exists.
+// The caller must hold the transport mutex.
+func (cs *ChatService) exists(roomID string) bool {
+	if isDirect(roomID) {
+		_, ok := cs.direct[roomID]
+		return ok
 	}
+	_, ok := cs.TCPTransport.Rooms[roomID]
+	return ok
+}
 
-	// Add the message to the chat history of the room
-	room.Chat = append(room.Chat, fmt.Sprintf("[%s] %s: %s", timestamp, sender.ID, content))
+// roomsOf returns the rooms and the direct conversations the peer is in.
+// The caller must hold the transport mutex.
+func (cs *ChatService) roomsOf(peerID string) []*network.Room {
+	rooms := []*network.Room{}
+	for _, room := range cs.TCPTransport.Rooms {
+		if _, ok := room.Peers[peerID]; ok {
+			rooms = append(rooms, room)
+		}
+	}
+	for _, conv := range cs.direct {
+		if _, ok := conv.Peers[peerID]; ok {
+			rooms = append(rooms, conv.Room)
+		}
+	}
+	return rooms
+}
 
-	return nil
+// messageIndex returns the position of the message in the chat history of the room.
+// The caller must hold the transport mutex.
+func messageIndex(room *network.Room, messageID int) (int, error) {
+	// The IDs are increasing, the message is found by binary search
+	i := sort.Search(len(room.Chat), func(i int) bool { return room.Chat[i].ID >= messageID })
+	if i == len(room.Chat) || room.Chat[i].ID != messageID {
+		return 0, ErrMessageNotFound
+	}
+	return i, nil
 }
 
-// ReceiveMessage receives a chat message from a specific room.
-func (cs *ChatService) Receive(roomID string) ([]string, error) {
+// ReceiveMessage receives the chat history kept for a specific room.
+// Use History to page through long histories.
+func (cs *ChatService) Receive(roomID string) ([]*network.ChatMessage, error) {
 	// Retrieve the room from the TCPTransport
 	cs.TCPTransport.Mutex.Lock()
 	defer cs.TCPTransport.Mutex.Unlock()
-	room, ok := cs.TCPTransport.Rooms[roomID]
-	if !ok {
-		return nil, fmt.Errorf("room %s does not exist", roomID)
+	room, err := cs.lookup(roomID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Return the chat history of the room
-	return room.Chat, nil
+	// Return a copy of the chat history of the room, as it keeps growing
+	history := make([]*network.ChatMessage, len(room.Chat))
+	copy(history, room.Chat)
+	return history, nil
 }
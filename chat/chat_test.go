@@ -3,6 +3,7 @@ package chat
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -30,8 +31,8 @@ func TestSendMessage(t *testing.T) {
 	room := &network.Room{
 		ID:    roomID,
 		Host:  sender,
-		Peers: make(map[string]*network.Peer),
-		Chat:  []string{},
+		Peers: map[string]*network.Peer{sender.ID: sender},
+		Chat:  []*network.ChatMessage{},
 	}
 	transport.Rooms[roomID] = room
 
@@ -44,7 +45,18 @@ func TestSendMessage(t *testing.T) {
 
 	// Check if the message is added to the chat history
 	assert.Len(t, transport.Rooms[roomID].Chat, 1, "Chat history should contain one message")
-	assert.Contains(t, transport.Rooms[roomID].Chat[0], content, "Chat history should contain the sent message")
+	message := transport.Rooms[roomID].Chat[0]
+	assert.Equal(t, 1, message.ID, "The first message should have ID 1")
+	assert.Equal(t, roomID, message.RoomID, "The message should belong to the room")
+	assert.Equal(t, sender.ID, message.Sender.ID, "The message should record its sender")
+	assert.Equal(t, content, message.Body, "Chat history should contain the sent message")
+	assert.Equal(t, network.ChatMessageText, message.Kind, "The message should be a text message")
+	assert.Equal(t, time.UTC, message.SentAt.Location(), "The message should be timestamped in UTC")
+
+	// Peers outside the room cannot post to it
+	err = chatService.Send(roomID, &network.Peer{ID: "stranger"}, content)
+	assert.ErrorIs(t, err, ErrNotRoomMember, "SendMessage should refuse peers outside the room")
+	assert.Len(t, transport.Rooms[roomID].Chat, 1, "Messages of peers outside the room should not be stored")
 }
 
 // TestSendMessageRoomNotExist tests the SendMessage method when the specified room does not exist.
@@ -94,7 +106,11 @@ func TestReceiveMessage(t *testing.T) {
 		ID:    roomID,
 		Host:  peer,
 		Peers: make(map[string]*network.Peer),
-		Chat:  []string{"Message 1", "Message 2", "Message 3"},
+		Chat: []*network.ChatMessage{
+			{ID: 1, RoomID: roomID, Sender: peer, Body: "Message 1", Kind: network.ChatMessageText},
+			{ID: 2, RoomID: roomID, Sender: peer, Body: "Message 2", Kind: network.ChatMessageText},
+			{ID: 3, RoomID: roomID, Sender: peer, Body: "Message 3", Kind: network.ChatMessageText},
+		},
 	}
 	transport.Rooms[roomID] = room
 
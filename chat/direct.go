@@ -0,0 +1,190 @@
+package chat
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// MaxParticipants is the maximum number of participants of a direct conversation.
+const MaxParticipants = 10
+
+// directPrefix starts the IDs of the direct conversations, so they never collide with room IDs.
+const directPrefix = "dm-"
+
+var (
+	ErrConversationNotFound = errors.New("conversation not found")                                             // No conversation has the ID, or the peer does not take part in it
+	ErrInvalidParticipants  = fmt.Errorf("a conversation needs 1 to %d other participants", MaxParticipants-1) // The conversation would be empty or too large
+	ErrNotGroup             = errors.New("only group conversations can be left")                               // One-to-one conversations last as long as the server
+)
+
+// conversation is a direct conversation. Its messages and participants are kept
+// in a room no one can join, so the chat features work the same as in rooms.
+type conversation struct {
+	*network.Room
+	Group     bool      // Started with several other peers, so participants can leave
+	StartedAt time.Time // Time the conversation was started
+}
+
+// DirectConversation describes a direct conversation to its participants.
+type DirectConversation struct {
+	ID           string               `json:"id"`                     // ID to use as room ID to chat in the conversation
+	Group        bool                 `json:"group"`                  // Indicates whether the conversation was started with several peers
+	Participants []*network.Peer      `json:"participants"`           // Peers taking part in the conversation, sorted by ID
+	StartedAt    time.Time            `json:"started_at"`             // Time the conversation was started
+	LastMessage  *network.ChatMessage `json:"last_message,omitempty"` // Last message kept, if any
+}
+
+// isDirect reports whether the room ID is the ID of a direct conversation.
+func isDirect(roomID string) bool {
+	return strings.HasPrefix(roomID, directPrefix)
+}
+
+// StartDirect starts a direct conversation between the creator and the other
+// peers. Conversations between two peers are unique: starting one again returns
+// the existing conversation. Group conversations are always new.
+func (cs *ChatService) StartDirect(creator *network.Peer, others []*network.Peer) (*DirectConversation, error) {
+	participants := map[string]*network.Peer{creator.ID: copyPeer(creator)}
+	for _, peer := range others {
+		if peer.ID != creator.ID {
+			participants[peer.ID] = copyPeer(peer)
+		}
+	}
+	if len(participants) < 2 || len(participants) > MaxParticipants {
+		return nil, ErrInvalidParticipants
+	}
+
+	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+	group := len(participants) > 2
+	if !group {
+		for _, conv := range cs.direct {
+			if !conv.Group && samePeers(conv.Peers, participants) {
+				return conv.describe(), nil
+			}
+		}
+	}
+
+	id, err := directID()
+	if err != nil {
+		return nil, err
+	}
+	conv := &conversation{
+		Room:      &network.Room{ID: id, Peers: participants, Chat: []*network.ChatMessage{}},
+		Group:     group,
+		StartedAt: cs.now().UTC(),
+	}
+	if cs.direct == nil {
+		cs.direct = make(map[string]*conversation)
+	}
+	cs.direct[id] = conv
+	return conv.describe(), nil
+}
+
+// Directs returns the direct conversations of the peer, the most recently active first.
+func (cs *ChatService) Directs(peerID string) []*DirectConversation {
+	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+
+	conversations := []*DirectConversation{}
+	for _, conv := range cs.direct {
+		if _, ok := conv.Peers[peerID]; ok {
+			conversations = append(conversations, conv.describe())
+		}
+	}
+	sort.Slice(conversations, func(i, j int) bool {
+		ai, aj := conversations[i].activity(), conversations[j].activity()
+		if !ai.Equal(aj) {
+			return ai.After(aj)
+		}
+		return conversations[i].ID < conversations[j].ID
+	})
+	return conversations
+}
+
+// LeaveDirect removes the peer from a group conversation, which is deleted
+// with its messages once every participant left.
+func (cs *ChatService) LeaveDirect(conversationID, peerID string) error {
+	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+
+	if _, err := cs.room(conversationID, peerID); err != nil {
+		return err
+	}
+	conv := cs.direct[conversationID]
+	if !conv.Group {
+		return ErrNotGroup
+	}
+	delete(conv.Peers, peerID)
+	if len(conv.Peers) == 0 {
+		delete(cs.direct, conversationID)
+	}
+	cs.prune()
+	return nil
+}
+
+// describe returns the description of the conversation.
+// The caller must hold the transport mutex.
+func (conv *conversation) describe() *DirectConversation {
+	description := &DirectConversation{
+		ID:           conv.ID,
+		Group:        conv.Group,
+		Participants: make([]*network.Peer, 0, len(conv.Peers)),
+		StartedAt:    conv.StartedAt,
+	}
+	for _, peer := range conv.Peers {
+		description.Participants = append(description.Participants, copyPeer(peer))
+	}
+	sort.Slice(description.Participants, func(i, j int) bool {
+		return description.Participants[i].ID < description.Participants[j].ID
+	})
+	if len(conv.Chat) > 0 {
+		description.LastMessage = conv.Chat[len(conv.Chat)-1]
+	}
+	return description
+}
+
+// activity returns the time of the last message of the conversation, or the
+// time it was started if it has none.
+func (d *DirectConversation) activity() time.Time {
+	if d.LastMessage != nil {
+		return d.LastMessage.SentAt
+	}
+	return d.StartedAt
+}
+
+// samePeers reports whether the two sets of peers have the same IDs.
+func samePeers(a, b map[string]*network.Peer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for peerID := range a {
+		if _, ok := b[peerID]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// copyPeer returns a copy of the peer, so the participants never share the
+// peers of the callers.
+func copyPeer(peer *network.Peer) *network.Peer {
+	copied := *peer
+	return &copied
+}
+
+// directID generates a random conversation ID.
+func directID() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := io.ReadFull(rand.Reader, bytes); err != nil {
+		return "", fmt.Errorf("failed to generate conversation ID: %w", err)
+	}
+	return directPrefix + hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,148 @@
+package chat
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+func TestStartDirect(t *testing.T) {
+	chatService := NewChatService(&network.TCPTransport{Rooms: make(map[string]*network.Room)})
+	alice := &network.Peer{ID: "alice", Name: "Alice"}
+	bob := &network.Peer{ID: "bob", Name: "Bob"}
+	carol := &network.Peer{ID: "carol", Name: "Carol"}
+
+	// One-to-one conversations are found again from either side
+	conversation, err := chatService.StartDirect(alice, []*network.Peer{bob})
+	require.NoError(t, err)
+	assert.Regexp(t, `^dm-[0-9a-f]{16}$`, conversation.ID)
+	assert.False(t, conversation.Group)
+	assert.Equal(t, []*network.Peer{alice, bob}, conversation.Participants)
+	again, err := chatService.StartDirect(bob, []*network.Peer{alice, bob})
+	require.NoError(t, err)
+	assert.Equal(t, conversation.ID, again.ID)
+
+	group, err := chatService.StartDirect(alice, []*network.Peer{bob, carol})
+	require.NoError(t, err)
+	assert.True(t, group.Group)
+	other, err := chatService.StartDirect(alice, []*network.Peer{bob, carol})
+	require.NoError(t, err)
+	assert.NotEqual(t, group.ID, other.ID)
+
+	_, err = chatService.StartDirect(alice, []*network.Peer{alice})
+	assert.ErrorIs(t, err, ErrInvalidParticipants)
+	crowd := []*network.Peer{}
+	for _, id := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		crowd = append(crowd, &network.Peer{ID: id})
+	}
+	_, err = chatService.StartDirect(alice, crowd)
+	assert.ErrorIs(t, err, ErrInvalidParticipants)
+
+	// The most recently active conversations come first
+	require.NoError(t, chatService.Send(group.ID, carol, "hi all"))
+	conversations := chatService.Directs("alice")
+	require.Len(t, conversations, 3)
+	assert.Equal(t, group.ID, conversations[0].ID)
+	assert.Equal(t, "hi all", conversations[0].LastMessage.Body)
+	assert.Len(t, chatService.Directs("carol"), 2)
+	assert.Empty(t, chatService.Directs("dave"))
+}
+
+func TestDirect_Access(t *testing.T) {
+	chatService := NewChatService(&network.TCPTransport{Rooms: make(map[string]*network.Room)})
+	alice := &network.Peer{ID: "alice", Name: "Alice"}
+	bob := &network.Peer{ID: "bob", Name: "Bob"}
+	eve := &network.Peer{ID: "eve", Name: "Eve"}
+	conversation, err := chatService.StartDirect(alice, []*network.Peer{bob})
+	require.NoError(t, err)
+	require.NoError(t, chatService.Send(conversation.ID, alice, "ping @bob"))
+
+	page, err := chatService.History(conversation.ID, HistoryQuery{ReaderID: "bob"})
+	require.NoError(t, err)
+	require.Len(t, page.Messages, 1)
+	assert.Equal(t, []string{"bob"}, page.Messages[0].Mentions)
+	_, err = chatService.React(conversation.ID, 1, "bob", "👍")
+	assert.NoError(t, err)
+
+	// Outsiders cannot tell the conversation exists
+	assert.ErrorIs(t, chatService.Send(conversation.ID, eve, "hello"), ErrConversationNotFound)
+	_, err = chatService.History(conversation.ID, HistoryQuery{ReaderID: "eve"})
+	assert.ErrorIs(t, err, ErrConversationNotFound)
+	_, err = chatService.History(conversation.ID, HistoryQuery{})
+	assert.ErrorIs(t, err, ErrConversationNotFound)
+	_, _, err = chatService.Thread(conversation.ID, 1, HistoryQuery{ReaderID: "eve"})
+	assert.ErrorIs(t, err, ErrConversationNotFound)
+	_, err = chatService.Edit(conversation.ID, 1, "eve", "hijacked")
+	assert.ErrorIs(t, err, ErrConversationNotFound)
+	_, _, err = chatService.Subscribe(conversation.ID, "eve", 0)
+	assert.ErrorIs(t, err, ErrConversationNotFound)
+	_, err = chatService.MarkRead(conversation.ID, "eve", 0)
+	assert.ErrorIs(t, err, ErrConversationNotFound)
+	_, err = chatService.Receive(conversation.ID)
+	assert.ErrorIs(t, err, ErrConversationNotFound)
+	_, err = chatService.Search("eve", SearchQuery{Text: "ping", RoomID: conversation.ID})
+	assert.ErrorIs(t, err, ErrConversationNotFound)
+
+	// Participants find the messages among their rooms
+	results, err := chatService.Search("bob", SearchQuery{Text: "ping"})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+	results, err = chatService.Search("eve", SearchQuery{Text: "ping"})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	assert.Equal(t, []*RoomUnread{{RoomID: conversation.ID, Unread: 1, Mentions: 1}}, chatService.Unread("bob"))
+	assert.Empty(t, chatService.Unread("eve"))
+}
+
+func TestDirect_Notifications(t *testing.T) {
+	chatService, server, roomID := setupChatRoom(t)
+	host := &network.Peer{ID: "host", Name: "Host"}
+	guest := &network.Peer{ID: "guest", Name: "Guest"}
+	conversation, err := chatService.StartDirect(host, []*network.Peer{guest})
+	require.NoError(t, err)
+
+	// The guest follows the room only, and is told of the direct message there
+	guestConn, _, err := dialChat(t, server, "room_id="+roomID+"&peer_id=guest")
+	require.NoError(t, err)
+	hostConn, _, err := dialChat(t, server, "room_id="+conversation.ID+"&peer_id=host")
+	require.NoError(t, err)
+	_, resp, err := dialChat(t, server, "room_id="+conversation.ID+"&peer_id=eve")
+	assert.Error(t, err)
+	if resp != nil {
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	require.NoError(t, chatService.Send(conversation.ID, host, "got a minute?"))
+	event := readEvent(t, guestConn)
+	assert.Equal(t, EventDirect, event.Type)
+	assert.Equal(t, conversation.ID, event.RoomID)
+	assert.Equal(t, "got a minute?", event.Message.Body)
+	event = readEvent(t, hostConn)
+	assert.Equal(t, EventMessage, event.Type)
+}
+
+func TestLeaveDirect(t *testing.T) {
+	chatService := NewChatService(&network.TCPTransport{Rooms: make(map[string]*network.Room)})
+	alice := &network.Peer{ID: "alice"}
+	bob := &network.Peer{ID: "bob"}
+	carol := &network.Peer{ID: "carol"}
+	pair, err := chatService.StartDirect(alice, []*network.Peer{bob})
+	require.NoError(t, err)
+	group, err := chatService.StartDirect(alice, []*network.Peer{bob, carol})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, chatService.LeaveDirect(pair.ID, "alice"), ErrNotGroup)
+	require.NoError(t, chatService.LeaveDirect(group.ID, "alice"))
+	assert.ErrorIs(t, chatService.Send(group.ID, alice, "still here?"), ErrConversationNotFound)
+	assert.ErrorIs(t, chatService.LeaveDirect(group.ID, "alice"), ErrConversationNotFound)
+	require.NoError(t, chatService.Send(group.ID, bob, "bye alice"))
+
+	// The conversation is gone once everyone left
+	require.NoError(t, chatService.LeaveDirect(group.ID, "bob"))
+	require.NoError(t, chatService.LeaveDirect(group.ID, "carol"))
+	assert.Len(t, chatService.Directs("bob"), 1)
+}
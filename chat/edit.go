@@ -0,0 +1,173 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// maxReactions is the number of different emojis a message can be reacted with.
+const maxReactions = 20
+
+var (
+	ErrMessageNotFound = errors.New("message not found")                                // No message of the room has the ID
+	ErrNotRoomMember   = errors.New("not a member of the room")                         // Only the peers of the room can read and change its messages
+	ErrNotSender       = errors.New("only the sender can do this")                      // The message belongs to another peer
+	ErrMessageDeleted  = errors.New("message was deleted")                              // Tombstones cannot be changed
+	ErrEmptyMessage    = errors.New("message cannot be empty, delete it instead")       // Edits must keep some content
+	ErrInvalidEmoji    = errors.New("reaction must be a single emoji")                  // The reaction is not an emoji
+	ErrTooManyEmojis   = fmt.Errorf("a message has at most %d reactions", maxReactions) // The message cannot take another emoji
+)
+
+// Edit replaces the body of a message. Peers can only edit their own text messages.
+func (cs *ChatService) Edit(roomID string, messageID int, peerID, body string) (*network.ChatMessage, error) {
+	if body == "" {
+		return nil, ErrEmptyMessage
+	}
+	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+
+	var mentioned []string
+	edited, err := cs.replace(roomID, messageID, peerID, func(room *network.Room, message *network.ChatMessage) error {
+		if message.Kind != network.ChatMessageText || message.Sender == nil || message.Sender.ID != peerID {
+			return ErrNotSender
+		}
+		editedAt := cs.now().UTC()
+		previous := message.Mentions
+		message.Body = body
+		message.EditedAt = &editedAt
+		message.Mentions = mentions(room, body)
+		// Only the peers mentioned by the edit are notified
+		for _, mention := range message.Mentions {
+			if i := sort.SearchStrings(previous, mention); i == len(previous) || previous[i] != mention {
+				mentioned = append(mentioned, mention)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Published under the lock, so the mentions reach the peers after the edit
+	cs.publish(&ChatEvent{Type: EventEdit, RoomID: roomID, ID: edited.ID, Message: edited})
+	cs.notifyMentions(edited, mentioned)
+	return edited, nil
+}
+
+// Delete replaces a message with a tombstone keeping its ID, sender and time.
+// Peers can delete their own messages and the host of the room any message.
+func (cs *ChatService) Delete(roomID string, messageID int, peerID string) (*network.ChatMessage, error) {
+	return cs.update(roomID, messageID, peerID, EventDelete, func(room *network.Room, message *network.ChatMessage) error {
+		isSender := message.Sender != nil && message.Sender.ID == peerID
+		isHost := room.Host != nil && room.Host.ID == peerID
+		if !isSender && !isHost {
+			return ErrNotSender
+		}
+		deletedAt := cs.now().UTC()
+		message.Body = ""
+		message.Reactions = nil
+		message.Mentions = nil
+		message.Snippet = nil
+		message.DeletedAt = &deletedAt
+		message.DeletedBy = peerID
+		return nil
+	})
+}
+
+// React toggles the reaction of the peer to a message with an emoji: it is
+// added if the peer did not react with it yet, removed otherwise.
+func (cs *ChatService) React(roomID string, messageID int, peerID, emoji string) (*network.ChatMessage, error) {
+	if !validEmoji(emoji) {
+		return nil, ErrInvalidEmoji
+	}
+	return cs.update(roomID, messageID, peerID, EventReaction, func(room *network.Room, message *network.ChatMessage) error {
+		peerIDs := message.Reactions[emoji]
+		if i := sort.SearchStrings(peerIDs, peerID); i < len(peerIDs) && peerIDs[i] == peerID {
+			peerIDs = append(peerIDs[:i], peerIDs[i+1:]...)
+		} else {
+			if len(peerIDs) == 0 && len(message.Reactions) >= maxReactions {
+				return ErrTooManyEmojis
+			}
+			peerIDs = append(peerIDs, peerID)
+			sort.Strings(peerIDs)
+		}
+
+		if len(peerIDs) == 0 {
+			delete(message.Reactions, emoji)
+			if len(message.Reactions) == 0 {
+				message.Reactions = nil
+			}
+			return nil
+		}
+		if message.Reactions == nil {
+			message.Reactions = make(map[string][]string)
+		}
+		message.Reactions[emoji] = peerIDs
+		return nil
+	})
+}
+
+// update applies a change made by a member of the room to a message and pushes
+// the updated message to the room.
+func (cs *ChatService) update(roomID string, messageID int, peerID, eventType string, change func(*network.Room, *network.ChatMessage) error) (*network.ChatMessage, error) {
+	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+
+	message, err := cs.replace(roomID, messageID, peerID, change)
+	if err != nil {
+		return nil, err
+	}
+	// Published under the lock, so the changes reach the subscribers in order
+	cs.publish(&ChatEvent{Type: eventType, RoomID: roomID, ID: message.ID, Message: message})
+	return message, nil
+}
+
+// replace applies the change to a clone of the message and stores the clone in
+// its place, so the messages already handed out never change.
+// The caller must hold the transport mutex.
+func (cs *ChatService) replace(roomID string, messageID int, peerID string, change func(*network.Room, *network.ChatMessage) error) (*network.ChatMessage, error) {
+	room, err := cs.room(roomID, peerID)
+	if err != nil {
+		return nil, err
+	}
+	i, err := messageIndex(room, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if room.Chat[i].Deleted() {
+		return nil, ErrMessageDeleted
+	}
+
+	message := room.Chat[i].Clone()
+	if err := change(room, message); err != nil {
+		return nil, err
+	}
+	cs.unindexMessage(room.Chat[i])
+	cs.indexMessage(message)
+	room.Chat[i] = message
+	return message, nil
+}
+
+// validEmoji reports whether the reaction is a single emoji, possibly made of
+// several code points joined together or with modifiers.
+func validEmoji(emoji string) bool {
+	if !utf8.ValidString(emoji) || utf8.RuneCountInString(emoji) > 16 {
+		return false
+	}
+	symbols := 0
+	for _, r := range emoji {
+		switch {
+		case unicode.Is(unicode.So, r):
+			symbols++
+		case unicode.In(r, unicode.Sk, unicode.Mn), r == '\u200d':
+			// Skin tones, variation selectors and zero width joiners
+		default:
+			return false
+		}
+	}
+	return symbols > 0
+}
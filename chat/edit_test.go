@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+func TestEdit(t *testing.T) {
+	chatService, server, roomID := setupChatRoom(t)
+	require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "guest"}, "helo"))
+	conn, _, err := dialChat(t, server, "room_id="+roomID+"&peer_id=host&last_id=1")
+	require.NoError(t, err)
+	sent := chatService.TCPTransport.Rooms[roomID].Chat[0]
+
+	_, err = chatService.Edit(roomID, 1, "host", "hello")
+	assert.ErrorIs(t, err, ErrNotSender)
+	_, err = chatService.Edit(roomID, 1, "guest", "")
+	assert.ErrorIs(t, err, ErrEmptyMessage)
+	_, err = chatService.Edit(roomID, 2, "guest", "hello")
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	_, err = chatService.Edit(roomID, 1, "stranger", "hello")
+	assert.ErrorIs(t, err, ErrNotRoomMember)
+
+	edited, err := chatService.Edit(roomID, 1, "guest", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", edited.Body)
+	assert.NotNil(t, edited.EditedAt)
+	// The stored message is replaced, not modified
+	assert.Equal(t, "helo", sent.Body)
+	assert.Nil(t, sent.EditedAt)
+
+	// Changes to messages already received are pushed
+	event := readEvent(t, conn)
+	assert.Equal(t, EventEdit, event.Type)
+	assert.Equal(t, 1, event.ID)
+	assert.Equal(t, "hello", event.Message.Body)
+}
+
+func TestDelete(t *testing.T) {
+	chatService, _, roomID := setupChatRoom(t)
+	require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "host"}, "mine"))
+	require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "guest"}, "spam"))
+
+	// Guests can only delete their own messages, the host any message
+	_, err := chatService.Delete(roomID, 1, "guest")
+	assert.ErrorIs(t, err, ErrNotSender)
+	_, err = chatService.React(roomID, 2, "host", "👍")
+	require.NoError(t, err)
+
+	deleted, err := chatService.Delete(roomID, 2, "host")
+	require.NoError(t, err)
+	assert.True(t, deleted.Deleted())
+	assert.Equal(t, "host", deleted.DeletedBy)
+	assert.Equal(t, "guest", deleted.Sender.ID)
+	assert.Empty(t, deleted.Body)
+	assert.Nil(t, deleted.Reactions)
+
+	// Tombstones cannot be changed anymore
+	_, err = chatService.Delete(roomID, 2, "guest")
+	assert.ErrorIs(t, err, ErrMessageDeleted)
+	_, err = chatService.React(roomID, 2, "guest", "👍")
+	assert.ErrorIs(t, err, ErrMessageDeleted)
+
+	deleted, err = chatService.Delete(roomID, 1, "host")
+	require.NoError(t, err)
+	assert.Equal(t, "host", deleted.DeletedBy)
+
+	// The code of snippets goes with their message
+	_, err = chatService.SendSnippet(roomID, 0, &network.Peer{ID: "guest"}, "look", network.CodeSnippet{Language: "go", Code: "secret := 42"})
+	require.NoError(t, err)
+	deleted, err = chatService.Delete(roomID, 3, "guest")
+	require.NoError(t, err)
+	assert.Nil(t, deleted.Snippet)
+	page, err := chatService.History(roomID, HistoryQuery{ReaderID: "host"})
+	require.NoError(t, err)
+	assert.Nil(t, page.Messages[len(page.Messages)-1].Snippet)
+}
+
+func TestReact(t *testing.T) {
+	chatService, _, roomID := setupChatRoom(t)
+	require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "host"}, "ship it"))
+
+	message, err := chatService.React(roomID, 1, "host", "👍")
+	require.NoError(t, err)
+	message, err = chatService.React(roomID, 1, "guest", "👍")
+	require.NoError(t, err)
+	message, err = chatService.React(roomID, 1, "guest", "👍🏽")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"👍": {"guest", "host"}, "👍🏽": {"guest"}}, message.Reactions)
+
+	// Reacting again with the same emoji removes the reaction
+	message, err = chatService.React(roomID, 1, "guest", "👍")
+	require.NoError(t, err)
+	message, err = chatService.React(roomID, 1, "guest", "👍🏽")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"👍": {"host"}}, message.Reactions)
+	message, err = chatService.React(roomID, 1, "host", "👍")
+	require.NoError(t, err)
+	assert.Nil(t, message.Reactions)
+
+	for _, emoji := range []string{"", "ok", ":+1:", "👍 👍", "\xff"} {
+		_, err = chatService.React(roomID, 1, "host", emoji)
+		assert.ErrorIs(t, err, ErrInvalidEmoji, emoji)
+	}
+	for _, emoji := range []string{"❤️", "👨‍👩‍👧", "🇫🇷"} {
+		assert.True(t, validEmoji(emoji), emoji)
+	}
+}
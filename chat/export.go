@@ -0,0 +1,333 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// Formats of the exported transcripts.
+const (
+	ExportJSON     = "json"     // Transcript that can be imported back
+	ExportMarkdown = "markdown" // Readable document rendering the snippets as code blocks
+	ExportText     = "text"     // One line per message
+)
+
+// TranscriptVersion is the version of the JSON transcripts written by Export.
+const TranscriptVersion = 1
+
+// maxImportMessages is the maximum number of messages of an imported transcript.
+const maxImportMessages = 10000
+
+var (
+	ErrNotHost           = errors.New("only the host of the room can do this")         // The peer is not the host of the room
+	ErrUnknownFormat     = errors.New("format must be json, markdown or text")         // The export format is not one of the Export* constants
+	ErrInvalidTranscript = errors.New("invalid transcript")                            // The transcript cannot be imported
+	ErrRoomNotEmpty      = errors.New("transcripts can only be imported in new rooms") // The room already has messages
+)
+
+// Transcript is the chat history of a room as exported in JSON.
+type Transcript struct {
+	Version    int                    `json:"version"`     // Version of the format, TranscriptVersion
+	RoomID     string                 `json:"room_id"`     // Room the transcript was exported from
+	ExportedAt time.Time              `json:"exported_at"` // Time the transcript was exported
+	Messages   []*network.ChatMessage `json:"messages"`    // Messages of the room, oldest first
+}
+
+// Export writes the chat history kept for the room in the format.
+// Only the host of the room can export it.
+func (cs *ChatService) Export(roomID, peerID, format string, w io.Writer) error {
+	if format != ExportJSON && format != ExportMarkdown && format != ExportText {
+		return ErrUnknownFormat
+	}
+
+	cs.TCPTransport.Mutex.Lock()
+	room, err := cs.room(roomID, peerID)
+	if err != nil {
+		cs.TCPTransport.Mutex.Unlock()
+		return err
+	}
+	if room.Host == nil || room.Host.ID != peerID {
+		cs.TCPTransport.Mutex.Unlock()
+		return ErrNotHost
+	}
+	// Stored messages never change, so the copy can be rendered unlocked
+	transcript := &Transcript{
+		Version:    TranscriptVersion,
+		RoomID:     roomID,
+		ExportedAt: cs.now().UTC(),
+		Messages:   append([]*network.ChatMessage{}, room.Chat...),
+	}
+	cs.TCPTransport.Mutex.Unlock()
+
+	switch format {
+	case ExportMarkdown:
+		return writeMarkdown(w, transcript)
+	case ExportText:
+		return writeText(w, transcript)
+	default:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(transcript)
+	}
+}
+
+// Import fills the chat history of a new room with the messages of a transcript,
+// keeping their senders and times. The messages are numbered from 1 again and
+// the thread summaries are computed from the replies. Mentions of peers who are
+// not in the room are dropped, and so are the files of the snippets the
+// workspace of the room does not have, keeping their code. The retention policy
+// applies to the imported messages: Import returns the number of messages kept.
+func (cs *ChatService) Import(roomID string, transcript *Transcript) (int, error) {
+	messages, err := transcript.messages(roomID)
+	if err != nil {
+		return 0, err
+	}
+
+	cs.TCPTransport.Mutex.Lock()
+	room, err := cs.lookup(roomID)
+	workspaceID := ""
+	if err == nil {
+		workspaceID = room.WorkspaceID
+	}
+	cs.TCPTransport.Mutex.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	// The files are read unlocked, as for the snippets sent to the room
+	for _, message := range messages {
+		if message.Snippet == nil {
+			continue
+		}
+		err := cs.checkFile(workspaceID, message.Snippet)
+		if errors.Is(err, ErrInvalidSnippet) || errors.Is(err, ErrNoWorkspace) {
+			message.Snippet.Path, message.Snippet.StartLine, message.Snippet.EndLine = "", 0, 0
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+	room, err = cs.lookup(roomID)
+	if err != nil {
+		return 0, err
+	}
+	if len(room.Chat) > 0 {
+		return 0, ErrRoomNotEmpty
+	}
+	room.Chat = messages
+	for _, message := range messages {
+		message.Mentions = roomPeerIDs(room, message.Mentions)
+		cs.indexMessage(message)
+	}
+	cs.retain(room)
+	return len(room.Chat), nil
+}
+
+// roomPeerIDs returns the peer IDs that are IDs of peers of the room, nil if none.
+// The caller must hold the transport mutex.
+func roomPeerIDs(room *network.Room, peerIDs []string) []string {
+	var kept []string
+	for _, peerID := range peerIDs {
+		if _, ok := room.Peers[peerID]; ok {
+			kept = append(kept, peerID)
+		}
+	}
+	return kept
+}
+
+// Validate checks that the transcript can be imported.
+func (t *Transcript) Validate() error {
+	_, err := t.messages("")
+	return err
+}
+
+// messages returns copies of the messages of the transcript to store in the room.
+func (t *Transcript) messages(roomID string) ([]*network.ChatMessage, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidTranscript, fmt.Sprintf(format, args...))
+	}
+	if t.Version != TranscriptVersion {
+		return nil, invalid("version must be %d", TranscriptVersion)
+	}
+	if len(t.Messages) > maxImportMessages {
+		return nil, invalid("at most %d messages can be imported", maxImportMessages)
+	}
+
+	messages := make([]*network.ChatMessage, 0, len(t.Messages))
+	ids := make(map[int]*network.ChatMessage, len(t.Messages)) // Imported messages, keyed by their ID in the transcript
+	var previous *network.ChatMessage
+	for _, original := range t.Messages {
+		if original == nil {
+			return nil, invalid("messages cannot be null")
+		}
+		if previous != nil && original.ID <= previous.ID {
+			return nil, invalid("message IDs must be increasing")
+		}
+		if original.SentAt.IsZero() || (previous != nil && original.SentAt.Before(previous.SentAt)) {
+			return nil, invalid("message %d must be sent after the previous ones", original.ID)
+		}
+		switch original.Kind {
+		case network.ChatMessageText, network.ChatMessageCode:
+			if original.Sender == nil || original.Sender.ID == "" {
+				return nil, invalid("message %d has no sender", original.ID)
+			}
+			if original.Kind == network.ChatMessageCode && original.Snippet == nil && !original.Deleted() {
+				return nil, invalid("code message %d has no snippet", original.ID)
+			}
+		case network.ChatMessageSystem:
+		default:
+			return nil, invalid("message %d has an unknown kind", original.ID)
+		}
+
+		message := original.Clone()
+		message.ID = len(messages) + 1
+		message.RoomID = roomID
+		message.Thread = nil
+		if message.Kind != network.ChatMessageCode || message.Deleted() {
+			message.Snippet = nil
+		} else if err := cleanSnippet(message.Snippet); err != nil {
+			return nil, invalid("message %d: %v", original.ID, err)
+		}
+		if original.ParentID != 0 {
+			parent, ok := ids[original.ParentID]
+			if !ok || parent.ParentID != 0 {
+				return nil, invalid("message %d replies to a message missing before it", original.ID)
+			}
+			message.ParentID = parent.ID
+			replies := 0
+			if parent.Thread != nil {
+				replies = parent.Thread.Replies
+			}
+			parent.Thread = &network.ThreadSummary{Replies: replies + 1, LastReplyID: message.ID, LastReplyAt: message.SentAt}
+			if message.Sender != nil {
+				parent.Thread.LastSenderID = message.Sender.ID
+			}
+		}
+		for emoji, peerIDs := range message.Reactions {
+			if !validEmoji(emoji) || len(peerIDs) == 0 {
+				return nil, invalid("message %d has an invalid reaction", original.ID)
+			}
+			sort.Strings(peerIDs)
+		}
+		sort.Strings(message.Mentions)
+
+		ids[original.ID] = message
+		messages = append(messages, message)
+		previous = original
+	}
+	return messages, nil
+}
+
+// senderName returns the name the message is shown with in the readable transcripts.
+func senderName(message *network.ChatMessage) string {
+	switch {
+	case message.Sender == nil:
+		return "system"
+	case message.Sender.Name != "":
+		return message.Sender.Name
+	default:
+		return message.Sender.ID
+	}
+}
+
+// writeMarkdown writes the transcript as a Markdown document.
+func writeMarkdown(w io.Writer, transcript *Transcript) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Chat of room %s\n\nExported at %s\n", transcript.RoomID, transcript.ExportedAt.Format(time.RFC3339))
+	for _, message := range transcript.Messages {
+		fmt.Fprintf(&b, "\n**%s** · %s · #%d", senderName(message), message.SentAt.Format(time.RFC3339), message.ID)
+		if message.ParentID != 0 {
+			fmt.Fprintf(&b, " · reply to #%d", message.ParentID)
+		}
+		if message.EditedAt != nil {
+			b.WriteString(" · edited")
+		}
+		b.WriteString("\n\n")
+
+		if message.Deleted() {
+			b.WriteString("_deleted_\n")
+			continue
+		}
+		if message.Body != "" {
+			b.WriteString(message.Body + "\n")
+		}
+		if snippet := message.Snippet; snippet != nil {
+			if snippet.Path != "" {
+				fmt.Fprintf(&b, "\n`%s`%s\n", snippet.Path, lineRange(snippet))
+			}
+			// The fence must be longer than any backtick run of the code
+			fence := "```"
+			for strings.Contains(snippet.Code, fence) {
+				fence += "`"
+			}
+			fmt.Fprintf(&b, "\n%s%s\n%s\n%s\n", fence, snippet.Language, strings.TrimSuffix(snippet.Code, "\n"), fence)
+		}
+		if reactions := formatReactions(message); reactions != "" {
+			b.WriteString("\n" + reactions + "\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeText writes the transcript as plain text, one line per message followed
+// by the indented code of the snippets.
+func writeText(w io.Writer, transcript *Transcript) error {
+	var b strings.Builder
+	for _, message := range transcript.Messages {
+		fmt.Fprintf(&b, "[%s] %s", message.SentAt.Format(time.RFC3339), senderName(message))
+		if message.ParentID != 0 {
+			fmt.Fprintf(&b, " (reply to #%d)", message.ParentID)
+		}
+		if message.EditedAt != nil {
+			b.WriteString(" (edited)")
+		}
+		if message.Deleted() {
+			b.WriteString(": [deleted]\n")
+			continue
+		}
+		// Multi-line bodies are indented so every message starts a line
+		fmt.Fprintf(&b, ": %s\n", strings.ReplaceAll(message.Body, "\n", "\n    "))
+		if snippet := message.Snippet; snippet != nil {
+			b.WriteString("    --- " + snippet.Language)
+			if snippet.Path != "" {
+				b.WriteString(" " + snippet.Path + lineRange(snippet))
+			}
+			b.WriteString("\n")
+			for _, line := range strings.Split(strings.TrimSuffix(snippet.Code, "\n"), "\n") {
+				b.WriteString("    " + line + "\n")
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// lineRange formats the lines of the file a snippet comes from, if known.
+func lineRange(snippet *network.CodeSnippet) string {
+	if snippet.StartLine == 0 {
+		return ""
+	}
+	return fmt.Sprintf(":%d-%d", snippet.StartLine, snippet.EndLine)
+}
+
+// formatReactions formats the reaction counts of the message, sorted by emoji.
+func formatReactions(message *network.ChatMessage) string {
+	emojis := make([]string, 0, len(message.Reactions))
+	for emoji := range message.Reactions {
+		emojis = append(emojis, emoji)
+	}
+	sort.Strings(emojis)
+	for i, emoji := range emojis {
+		emojis[i] = fmt.Sprintf("%s %d", emoji, len(message.Reactions[emoji]))
+	}
+	return strings.Join(emojis, " · ")
+}
@@ -0,0 +1,181 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// setupExport creates a chat service with a room hosted by "host" holding a
+// message, a reply to it, a deleted message and a code snippet.
+func setupExport(t *testing.T) (*ChatService, string, time.Time) {
+	transport := &network.TCPTransport{Rooms: make(map[string]*network.Room)}
+	chatService := NewChatService(transport)
+	host := &network.Peer{ID: "host", Name: "Host"}
+	guest := &network.Peer{ID: "guest", Name: "Guest"}
+	roomID := "room1"
+	transport.Rooms[roomID] = &network.Room{ID: roomID, Host: host, Peers: map[string]*network.Peer{"host": host, "guest": guest}}
+
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	clock := start
+	chatService.now = func() time.Time { return clock }
+	require.NoError(t, chatService.Send(roomID, host, "shall we ship it?"))
+	clock = clock.Add(time.Minute)
+	_, err := chatService.Reply(roomID, 1, guest, "yes @Host")
+	require.NoError(t, err)
+	_, err = chatService.React(roomID, 1, "guest", "👍")
+	require.NoError(t, err)
+	clock = clock.Add(time.Minute)
+	require.NoError(t, chatService.Send(roomID, guest, "oops"))
+	_, err = chatService.Delete(roomID, 3, "guest")
+	require.NoError(t, err)
+	clock = clock.Add(time.Minute)
+	_, err = chatService.SendSnippet(roomID, 0, host, "the fix", network.CodeSnippet{Language: "go", Code: "return nil\n"})
+	require.NoError(t, err)
+	return chatService, roomID, start
+}
+
+func TestExport_Formats(t *testing.T) {
+	chatService, roomID, start := setupExport(t)
+
+	var text bytes.Buffer
+	require.NoError(t, chatService.Export(roomID, "host", ExportText, &text))
+	assert.Equal(t, "[2026-10-19T12:00:00Z] Host: shall we ship it?\n"+
+		"[2026-10-19T12:01:00Z] Guest (reply to #1): yes @Host\n"+
+		"[2026-10-19T12:02:00Z] Guest: [deleted]\n"+
+		"[2026-10-19T12:03:00Z] Host: the fix\n"+
+		"    --- go\n"+
+		"    return nil\n", text.String())
+
+	var markdown bytes.Buffer
+	require.NoError(t, chatService.Export(roomID, "host", ExportMarkdown, &markdown))
+	assert.Contains(t, markdown.String(), "# Chat of room room1\n")
+	assert.Contains(t, markdown.String(), "**Host** · 2026-10-19T12:00:00Z · #1\n\nshall we ship it?\n\n👍 1\n")
+	assert.Contains(t, markdown.String(), "**Guest** · 2026-10-19T12:02:00Z · #3\n\n_deleted_\n")
+	assert.Contains(t, markdown.String(), "```go\nreturn nil\n```\n")
+
+	var transcript Transcript
+	var encoded bytes.Buffer
+	require.NoError(t, chatService.Export(roomID, "host", ExportJSON, &encoded))
+	require.NoError(t, json.Unmarshal(encoded.Bytes(), &transcript))
+	assert.Equal(t, TranscriptVersion, transcript.Version)
+	assert.Equal(t, start.Add(3*time.Minute), transcript.ExportedAt)
+	require.Len(t, transcript.Messages, 4)
+	assert.Equal(t, "Guest", transcript.Messages[1].Sender.Name)
+
+	assert.ErrorIs(t, chatService.Export(roomID, "guest", ExportJSON, &encoded), ErrNotHost)
+	assert.ErrorIs(t, chatService.Export(roomID, "host", "pdf", &encoded), ErrUnknownFormat)
+	assert.Error(t, chatService.Export("nonexistent", "host", ExportJSON, &encoded))
+}
+
+func TestImport(t *testing.T) {
+	chatService, roomID, start := setupExport(t)
+	var encoded bytes.Buffer
+	require.NoError(t, chatService.Export(roomID, "host", ExportJSON, &encoded))
+	var transcript Transcript
+	require.NoError(t, json.Unmarshal(encoded.Bytes(), &transcript))
+
+	// IDs are numbered again, the threads follow
+	for i, message := range transcript.Messages {
+		message.ID = 10 + 2*i
+	}
+	transcript.Messages[1].ParentID = 10
+	transcript.Messages[1].Mentions = []string{"guest", "host"}
+	transcript.Messages[3].Snippet.Path = "src/main.go"
+	transcript.Messages[3].Snippet.StartLine, transcript.Messages[3].Snippet.EndLine = 1, 2
+	host := &network.Peer{ID: "host"}
+	room := &network.Room{ID: "room2", Host: host, Peers: map[string]*network.Peer{"host": host}}
+	chatService.TCPTransport.Rooms[room.ID] = room
+	kept, err := chatService.Import(room.ID, &transcript)
+	require.NoError(t, err)
+	assert.Equal(t, 4, kept)
+	require.Len(t, room.Chat, 4)
+	assert.Equal(t, []int{1, 2, 3, 4}, []int{room.Chat[0].ID, room.Chat[1].ID, room.Chat[2].ID, room.Chat[3].ID})
+	assert.Equal(t, "room2", room.Chat[1].RoomID)
+	assert.Equal(t, 1, room.Chat[1].ParentID)
+	assert.Equal(t, &network.ThreadSummary{Replies: 1, LastReplyID: 2, LastReplyAt: start.Add(time.Minute), LastSenderID: "guest"}, room.Chat[0].Thread)
+	assert.Equal(t, "Guest", room.Chat[1].Sender.Name)
+	assert.Equal(t, start.Add(time.Minute), room.Chat[1].SentAt)
+	assert.True(t, room.Chat[2].Deleted())
+
+	// Only the peers of the room stay mentioned, and the files of snippets
+	// the room has no workspace for are dropped
+	assert.Equal(t, []string{"host"}, room.Chat[1].Mentions)
+	assert.Equal(t, &network.CodeSnippet{Language: "go", Code: "return nil\n"}, room.Chat[3].Snippet)
+
+	// The imported messages are searchable and the room keeps going from them
+	results, err := chatService.Search("host", SearchQuery{Text: "ship", RoomID: "room2"})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+	require.NoError(t, chatService.Send("room2", host, "shipped"))
+	assert.Equal(t, 5, room.LastChatID())
+
+	_, err = chatService.Import(room.ID, &transcript)
+	assert.ErrorIs(t, err, ErrRoomNotEmpty)
+}
+
+func TestImport_WorkspaceAndRetention(t *testing.T) {
+	chatService, roomID, start := setupExport(t)
+	var encoded bytes.Buffer
+	require.NoError(t, chatService.Export(roomID, "host", ExportJSON, &encoded))
+	var transcript Transcript
+	require.NoError(t, json.Unmarshal(encoded.Bytes(), &transcript))
+	transcript.Messages[3].Snippet.Path = "src/main.go"
+	transcript.Messages[3].Snippet.StartLine, transcript.Messages[3].Snippet.EndLine = 1, 2
+
+	// Snippets of the files of the workspace of the room keep their file
+	chatService.Files = memoryFiles{"ws1/src/main.go": 40}
+	host := &network.Peer{ID: "host"}
+	room := &network.Room{ID: "room2", Host: host, Peers: map[string]*network.Peer{"host": host}, WorkspaceID: "ws1"}
+	chatService.TCPTransport.Rooms[room.ID] = room
+	_, err := chatService.Import(room.ID, &transcript)
+	require.NoError(t, err)
+	assert.Equal(t, "src/main.go", room.Chat[3].Snippet.Path)
+
+	// The expired messages are not kept, but the last one is so the IDs keep increasing
+	chatService.now = func() time.Time { return start.Add(365 * 24 * time.Hour) }
+	room = &network.Room{ID: "room3", Host: host, Peers: map[string]*network.Peer{"host": host}}
+	chatService.TCPTransport.Rooms[room.ID] = room
+	kept, err := chatService.Import(room.ID, &transcript)
+	require.NoError(t, err)
+	assert.Equal(t, 1, kept)
+	require.Len(t, room.Chat, 1)
+	assert.Equal(t, 4, room.Chat[0].ID)
+	require.NoError(t, chatService.Send(room.ID, host, "back again"))
+	assert.Equal(t, 5, room.LastChatID())
+}
+
+func TestTranscript_Validate(t *testing.T) {
+	sent := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	message := func(id int, at time.Time) *network.ChatMessage {
+		return &network.ChatMessage{ID: id, Sender: &network.Peer{ID: "host"}, SentAt: at, Body: "hi", Kind: network.ChatMessageText}
+	}
+
+	valid := &Transcript{Version: TranscriptVersion, Messages: []*network.ChatMessage{message(1, sent), message(2, sent)}}
+	assert.NoError(t, valid.Validate())
+
+	invalid := []*Transcript{
+		{Version: 2},
+		{Version: TranscriptVersion, Messages: []*network.ChatMessage{nil}},
+		{Version: TranscriptVersion, Messages: []*network.ChatMessage{message(2, sent), message(1, sent)}},
+		{Version: TranscriptVersion, Messages: []*network.ChatMessage{message(1, sent), message(2, sent.Add(-time.Minute))}},
+		{Version: TranscriptVersion, Messages: []*network.ChatMessage{{ID: 1, SentAt: sent, Kind: network.ChatMessageText}}},
+		{Version: TranscriptVersion, Messages: []*network.ChatMessage{{ID: 1, Sender: &network.Peer{ID: "host"}, SentAt: sent, Kind: "video"}}},
+		{Version: TranscriptVersion, Messages: []*network.ChatMessage{{ID: 1, Sender: &network.Peer{ID: "host"}, SentAt: sent, Kind: network.ChatMessageCode}}},
+		{Version: TranscriptVersion, Messages: []*network.ChatMessage{{ID: 1, Sender: &network.Peer{ID: "host"}, SentAt: sent, Kind: network.ChatMessageCode, Snippet: &network.CodeSnippet{Language: "go lang", Code: "x"}}}},
+		{Version: TranscriptVersion, Messages: []*network.ChatMessage{{ID: 1, Sender: &network.Peer{ID: "host"}, SentAt: sent, Kind: network.ChatMessageCode, Snippet: &network.CodeSnippet{Language: "go", Code: strings.Repeat("x", maxSnippetSize+1)}}}},
+		{Version: TranscriptVersion, Messages: []*network.ChatMessage{{ID: 1, Sender: &network.Peer{ID: "host"}, SentAt: sent, Kind: network.ChatMessageCode, Snippet: &network.CodeSnippet{Language: "go", Code: "x", Path: "/.."}}}},
+		{Version: TranscriptVersion, Messages: []*network.ChatMessage{message(1, sent), {ID: 2, Sender: &network.Peer{ID: "host"}, SentAt: sent, Kind: network.ChatMessageText, ParentID: 5}}},
+		{Version: TranscriptVersion, Messages: []*network.ChatMessage{{ID: 1, Sender: &network.Peer{ID: "host"}, SentAt: sent, Kind: network.ChatMessageText, Reactions: map[string][]string{"abc": {"host"}}}}},
+	}
+	for i, transcript := range invalid {
+		assert.ErrorIs(t, transcript.Validate(), ErrInvalidTranscript, "transcript %d", i)
+	}
+}
@@ -0,0 +1,159 @@
+package chat
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// Bounds of the number of messages returned by a history query.
+const (
+	DefaultHistoryLimit = 50  // Messages returned when no limit is given
+	MaxHistoryLimit     = 200 // Maximum number of messages returned at once
+)
+
+// HistoryQuery selects a page of the chat history of a room.
+// Without cursor the latest messages are returned; BeforeID pages towards the
+// oldest messages and AfterID towards the newest. Filters apply before the limit.
+// Replies are only returned with the thread they belong to.
+type HistoryQuery struct {
+	BeforeID int       // Only messages with a lower ID, 0 for no bound
+	AfterID  int       // Only messages with a higher ID, 0 for no bound
+	Limit    int       // Maximum number of messages, DefaultHistoryLimit if 0
+	SenderID string    // Only messages of this peer, if set
+	Since    time.Time // Only messages sent at or after this time, if set
+	Until    time.Time // Only messages sent before this time, if set
+	ThreadID int       // Only the replies to this message, 0 for the messages outside threads
+	ReaderID string    // Peer reading the history, who must be a member of the room
+}
+
+// HistoryPage is a page of the chat history, oldest message first.
+type HistoryPage struct {
+	Messages []*network.ChatMessage `json:"chat_history"` // Messages of the page
+	HasMore  bool                   `json:"has_more"`     // More messages match beyond the page, in the paging direction
+}
+
+// RetentionPolicy bounds the chat history kept for every room.
+// The oldest messages are dropped when a new one is sent.
+type RetentionPolicy struct {
+	MaxMessages int           // Maximum number of messages kept, 0 for no limit
+	MaxAge      time.Duration // Maximum age of the messages kept, 0 for no limit
+}
+
+// DefaultRetentionPolicy returns the retention policy of new chat services:
+// the last 1000 messages of the last 30 days.
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		MaxMessages: 1000,
+		MaxAge:      30 * 24 * time.Hour,
+	}
+}
+
+// History returns a page of the chat history of the room to one of its members.
+func (cs *ChatService) History(roomID string, query HistoryQuery) (*HistoryPage, error) {
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+
+	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+	room, err := cs.room(roomID, query.ReaderID)
+	if err != nil {
+		return nil, err
+	}
+	return query.page(room.Chat), nil
+}
+
+// validate checks the query and sets the default limit.
+func (q *HistoryQuery) validate() error {
+	if q.Limit < 0 || q.Limit > MaxHistoryLimit {
+		return fmt.Errorf("limit must be between 1 and %d", MaxHistoryLimit)
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultHistoryLimit
+	}
+	if q.BeforeID < 0 || q.AfterID < 0 {
+		return fmt.Errorf("message IDs cannot be negative")
+	}
+	if q.BeforeID != 0 && q.AfterID != 0 {
+		return fmt.Errorf("before and after cannot be combined")
+	}
+	return nil
+}
+
+// page selects the messages of the history matching the validated query.
+func (q *HistoryQuery) page(history []*network.ChatMessage) *HistoryPage {
+	matches := []*network.ChatMessage{}
+	for _, message := range history {
+		if q.matches(message) {
+			matches = append(matches, message)
+		}
+	}
+
+	page := &HistoryPage{}
+	if len(matches) > q.Limit {
+		page.HasMore = true
+		if q.AfterID != 0 {
+			matches = matches[:q.Limit]
+		} else {
+			matches = matches[len(matches)-q.Limit:]
+		}
+	}
+	page.Messages = matches
+	return page
+}
+
+// matches reports whether the message is selected by the query, ignoring the limit.
+func (q *HistoryQuery) matches(message *network.ChatMessage) bool {
+	if message.ParentID != q.ThreadID {
+		return false
+	}
+	if q.BeforeID != 0 && message.ID >= q.BeforeID {
+		return false
+	}
+	if q.AfterID != 0 && message.ID <= q.AfterID {
+		return false
+	}
+	if q.SenderID != "" && (message.Sender == nil || message.Sender.ID != q.SenderID) {
+		return false
+	}
+	if !q.Since.IsZero() && message.SentAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !message.SentAt.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// retain drops the messages of the room the retention policy no longer keeps.
+// The caller must hold the transport mutex.
+func (cs *ChatService) retain(room *network.Room) {
+	drop := 0
+	if max := cs.Retention.MaxMessages; max > 0 && len(room.Chat) > max {
+		drop = len(room.Chat) - max
+	}
+	if cs.Retention.MaxAge > 0 {
+		// The history is in the order the messages were sent, so also by time
+		cutoff := cs.now().Add(-cs.Retention.MaxAge)
+		expired := sort.Search(len(room.Chat), func(i int) bool {
+			return !room.Chat[i].SentAt.Before(cutoff)
+		})
+		if expired > drop {
+			drop = expired
+		}
+	}
+	// The last message is kept so the IDs of the next ones keep increasing
+	if drop > 0 && drop == len(room.Chat) {
+		drop--
+	}
+	if drop > 0 {
+		for _, message := range room.Chat[:drop] {
+			cs.unindexMessage(message)
+		}
+		// Copied so the dropped messages can be garbage collected
+		room.Chat = append([]*network.ChatMessage(nil), room.Chat[drop:]...)
+	}
+}
@@ -0,0 +1,128 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// setupHistory creates a chat service with a room holding ten messages sent a
+// minute apart, alternately by the host and the guest.
+func setupHistory(t *testing.T) (*ChatService, string, time.Time) {
+	transport := &network.TCPTransport{Rooms: make(map[string]*network.Room)}
+	chatService := NewChatService(transport)
+	roomID := "room1"
+	transport.Rooms[roomID] = &network.Room{ID: roomID, Peers: map[string]*network.Peer{"host": {ID: "host"}, "guest": {ID: "guest"}}}
+
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	clock := start
+	chatService.now = func() time.Time { return clock }
+	for i := 0; i < 10; i++ {
+		sender := "host"
+		if i%2 == 1 {
+			sender = "guest"
+		}
+		require.NoError(t, chatService.Send(roomID, &network.Peer{ID: sender}, "message"))
+		clock = clock.Add(time.Minute)
+	}
+	return chatService, roomID, start
+}
+
+// ids returns the IDs of the messages of the page.
+func ids(page *HistoryPage) []int {
+	result := []int{}
+	for _, message := range page.Messages {
+		result = append(result, message.ID)
+	}
+	return result
+}
+
+func TestHistory_Pagination(t *testing.T) {
+	chatService, roomID, _ := setupHistory(t)
+
+	page, err := chatService.History(roomID, HistoryQuery{ReaderID: "host", Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []int{8, 9, 10}, ids(page))
+	assert.True(t, page.HasMore)
+
+	page, err = chatService.History(roomID, HistoryQuery{ReaderID: "host", BeforeID: 8, Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []int{5, 6, 7}, ids(page))
+	assert.True(t, page.HasMore)
+
+	page, err = chatService.History(roomID, HistoryQuery{ReaderID: "host", BeforeID: 3, Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, ids(page))
+	assert.False(t, page.HasMore)
+
+	page, err = chatService.History(roomID, HistoryQuery{ReaderID: "host", AfterID: 2, Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 4, 5}, ids(page))
+	assert.True(t, page.HasMore)
+
+	page, err = chatService.History(roomID, HistoryQuery{ReaderID: "host"})
+	require.NoError(t, err)
+	assert.Len(t, page.Messages, 10)
+	assert.False(t, page.HasMore)
+
+	_, err = chatService.History(roomID, HistoryQuery{ReaderID: "host", Limit: MaxHistoryLimit + 1})
+	assert.Error(t, err)
+	_, err = chatService.History(roomID, HistoryQuery{ReaderID: "host", BeforeID: 5, AfterID: 2})
+	assert.Error(t, err)
+	_, err = chatService.History("nonexistent", HistoryQuery{ReaderID: "host"})
+	assert.Error(t, err)
+
+	// Only the members of the room can read it
+	_, err = chatService.History(roomID, HistoryQuery{ReaderID: "stranger"})
+	assert.ErrorIs(t, err, ErrNotRoomMember)
+	_, err = chatService.History(roomID, HistoryQuery{})
+	assert.ErrorIs(t, err, ErrNotRoomMember)
+	assert.ErrorIs(t, chatService.Send(roomID, &network.Peer{ID: "stranger"}, "hi"), ErrNotRoomMember)
+}
+
+func TestHistory_Filters(t *testing.T) {
+	chatService, roomID, start := setupHistory(t)
+
+	page, err := chatService.History(roomID, HistoryQuery{ReaderID: "host", SenderID: "guest", Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []int{8, 10}, ids(page))
+	assert.True(t, page.HasMore)
+
+	page, err = chatService.History(roomID, HistoryQuery{ReaderID: "host", Since: start.Add(2 * time.Minute), Until: start.Add(5 * time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 4, 5}, ids(page))
+
+	page, err = chatService.History(roomID, HistoryQuery{ReaderID: "host", SenderID: "host", AfterID: 5})
+	require.NoError(t, err)
+	assert.Equal(t, []int{7, 9}, ids(page))
+}
+
+func TestRetention(t *testing.T) {
+	chatService, roomID, start := setupHistory(t)
+	room := chatService.TCPTransport.Rooms[roomID]
+
+	// The oldest messages are dropped beyond the maximum count
+	chatService.Retention = RetentionPolicy{MaxMessages: 4}
+	chatService.now = func() time.Time { return start.Add(10 * time.Minute) }
+	require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "host"}, "eleventh"))
+	assert.Len(t, room.Chat, 4)
+	assert.Equal(t, 8, room.Chat[0].ID)
+	assert.Equal(t, 11, room.LastChatID())
+
+	// And once they expire, but the IDs keep increasing
+	chatService.Retention = RetentionPolicy{MaxAge: time.Hour}
+	chatService.now = func() time.Time { return start.Add(2 * time.Hour) }
+	require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "host"}, "twelfth"))
+	require.Len(t, room.Chat, 1)
+	assert.Equal(t, 12, room.Chat[0].ID)
+
+	// Clients resuming from a dropped message get what is left
+	_, backlog, err := chatService.Subscribe(roomID, "host", 3)
+	require.NoError(t, err)
+	require.Len(t, backlog, 1)
+	assert.Equal(t, 12, backlog[0].ID)
+}
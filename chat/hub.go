@@ -0,0 +1,146 @@
+package chat
+
+import (
+	"fmt"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// Event types pushed over the chat websocket.
+const (
+	EventMessage  = "message"  // A message was posted to the room
+	EventEdit     = "edit"     // The body of a message was edited
+	EventDelete   = "delete"   // A message was replaced by a tombstone
+	EventReaction = "reaction" // The reactions to a message changed
+	EventThread   = "thread"   // The thread summary of a message changed after a reply
+	EventMention  = "mention"  // The peer was mentioned in another room
+	EventDirect   = "direct"   // The peer received a direct message outside the conversation followed
+	EventError    = "error"    // The server rejected the connection or a request
+)
+
+// subscriptionBuffer is the number of events buffered for a subscriber before
+// it is considered too slow and dropped.
+const subscriptionBuffer = 64
+
+// ChatEvent is pushed to the subscribers of a room.
+type ChatEvent struct {
+	Type    string               `json:"type"`              // One of the Event* constants
+	RoomID  string               `json:"room_id"`           // Room the event belongs to
+	ID      int                  `json:"id,omitempty"`      // ID of the message the event is about
+	Message *network.ChatMessage `json:"message,omitempty"` // Message as posted or after the change
+	Error   string               `json:"error,omitempty"`   // Reason of an error event
+}
+
+// Subscription receives the events of a room as they happen.
+// The channel is closed when the subscriber is unsubscribed, leaves the room or
+// falls too far behind, in which case it should resume from the last message it received.
+type Subscription struct {
+	RoomID string          // Room the subscription belongs to
+	PeerID string          // Peer receiving the events, also notified of its mentions in other rooms
+	C      chan *ChatEvent // Events of the room
+}
+
+// Subscribe registers a subscriber to the messages of the room and returns the
+// messages posted after afterID, so a reconnecting client misses nothing.
+// The backlog and the live events may overlap: events with an ID already
+// received must be skipped.
+func (cs *ChatService) Subscribe(roomID, peerID string, afterID int) (*Subscription, []*ChatEvent, error) {
+	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+
+	room, err := cs.room(roomID, peerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if afterID < 0 || afterID > room.LastChatID() {
+		return nil, nil, fmt.Errorf("message %d does not exist in room %s", afterID, roomID)
+	}
+	// Messages dropped by the retention policy are lost to the client
+	backlog := []*ChatEvent{}
+	for _, message := range room.Chat {
+		if message.ID > afterID {
+			backlog = append(backlog, &ChatEvent{Type: EventMessage, RoomID: roomID, ID: message.ID, Message: message})
+		}
+	}
+
+	// Registered while holding the transport lock, so no message is stored in between
+	sub := &Subscription{RoomID: roomID, PeerID: peerID, C: make(chan *ChatEvent, subscriptionBuffer)}
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if cs.subscribers == nil {
+		cs.subscribers = make(map[string]map[*Subscription]struct{})
+	}
+	if cs.subscribers[roomID] == nil {
+		cs.subscribers[roomID] = make(map[*Subscription]struct{})
+	}
+	cs.subscribers[roomID][sub] = struct{}{}
+	return sub, backlog, nil
+}
+
+// Unsubscribe stops the subscription and closes its channel.
+func (cs *ChatService) Unsubscribe(sub *Subscription) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.remove(sub)
+}
+
+// PruneSubscriptions closes the subscriptions of the peers who are no longer
+// members of their room, because they left it or were removed from it.
+func (cs *ChatService) PruneSubscriptions() {
+	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+	cs.prune()
+}
+
+// prune closes the subscriptions of the peers who are no longer members of their room.
+// The caller must hold the transport mutex.
+func (cs *ChatService) prune() {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	for roomID, subs := range cs.subscribers {
+		for sub := range subs {
+			if _, err := cs.room(roomID, sub.PeerID); err != nil {
+				cs.remove(sub)
+			}
+		}
+	}
+}
+
+// publish pushes the event to every subscriber of its room.
+// Subscribers whose buffer is full are dropped rather than blocking the sender.
+func (cs *ChatService) publish(event *ChatEvent) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	for sub := range cs.subscribers[event.RoomID] {
+		cs.deliver(sub, event)
+	}
+}
+
+// deliver pushes the event to the subscriber, dropping it if its buffer is full.
+// The caller must hold the mutex.
+func (cs *ChatService) deliver(sub *Subscription, event *ChatEvent) {
+	select {
+	case sub.C <- event:
+	default:
+		cs.remove(sub)
+	}
+}
+
+// remove unregisters the subscription and closes its channel.
+// The caller must hold the mutex.
+func (cs *ChatService) remove(sub *Subscription) {
+	subs, ok := cs.subscribers[sub.RoomID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	close(sub.C)
+	if len(subs) == 0 {
+		delete(cs.subscribers, sub.RoomID)
+	}
+}
@@ -0,0 +1,160 @@
+package chat
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// mentionPattern matches the "@name" mentions of a message body. Names are
+// made of the characters allowed by auth.ValidateName, and the "@" must not
+// follow a character of a name, so email addresses are not mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9._@-])@([A-Za-z0-9][A-Za-z0-9._-]*)`)
+
+// RoomUnread counts the messages of a room a peer has not read yet.
+type RoomUnread struct {
+	RoomID     string `json:"room_id"`      // Room the counts belong to
+	LastReadID int    `json:"last_read_id"` // ID of the last message read by the peer, 0 if none
+	Unread     int    `json:"unread"`       // Messages sent by others after the last one read
+	Mentions   int    `json:"mentions"`     // Unread messages mentioning the peer
+}
+
+// mentions returns the IDs of the peers of the room mentioned in the body, sorted.
+// Names are matched ignoring case; trailing punctuation is ignored when no peer
+// has the name with it, so "@bob." mentions bob.
+// The caller must hold the transport mutex.
+func mentions(room *network.Room, body string) []string {
+	peerIDs := map[string]struct{}{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		name := match[1]
+		for name != "" {
+			if peer := peerByName(room, name); peer != nil {
+				peerIDs[peer.ID] = struct{}{}
+				break
+			}
+			trimmed := strings.TrimRight(name, "._-")
+			if trimmed == name {
+				break
+			}
+			name = trimmed
+		}
+	}
+	if len(peerIDs) == 0 {
+		return nil
+	}
+
+	sorted := make([]string, 0, len(peerIDs))
+	for peerID := range peerIDs {
+		sorted = append(sorted, peerID)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// peerByName returns the peer of the room with the name, ignoring case, or nil.
+func peerByName(room *network.Room, name string) *network.Peer {
+	for _, peer := range room.Peers {
+		if strings.EqualFold(peer.Name, name) {
+			return peer
+		}
+	}
+	return nil
+}
+
+// MarkRead records that the peer read the messages of the room up to messageID,
+// or up to the last message if messageID is 0. Read markers never move back.
+// It returns the ID of the last message read.
+func (cs *ChatService) MarkRead(roomID, peerID string, messageID int) (int, error) {
+	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+
+	room, err := cs.room(roomID, peerID)
+	if err != nil {
+		return 0, err
+	}
+	if messageID == 0 {
+		messageID = room.LastChatID()
+	}
+	if messageID < 0 || messageID > room.LastChatID() {
+		return 0, ErrMessageNotFound
+	}
+
+	if cs.reads[roomID] == nil {
+		cs.reads[roomID] = make(map[string]int)
+	}
+	if messageID > cs.reads[roomID][peerID] {
+		cs.reads[roomID][peerID] = messageID
+	}
+	return cs.reads[roomID][peerID], nil
+}
+
+// Unread returns the unread counts of every room and direct conversation the
+// peer is in, sorted by room ID.
+func (cs *ChatService) Unread(peerID string) []*RoomUnread {
+	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+
+	// The markers of the rooms deleted since are dropped
+	for roomID := range cs.reads {
+		if !cs.exists(roomID) {
+			delete(cs.reads, roomID)
+		}
+	}
+
+	counts := []*RoomUnread{}
+	for _, room := range cs.roomsOf(peerID) {
+		count := &RoomUnread{RoomID: room.ID, LastReadID: cs.reads[room.ID][peerID]}
+		for _, message := range room.Chat {
+			if message.ID <= count.LastReadID || message.Deleted() || (message.Sender != nil && message.Sender.ID == peerID) {
+				continue
+			}
+			count.Unread++
+			if i := sort.SearchStrings(message.Mentions, peerID); i < len(message.Mentions) && message.Mentions[i] == peerID {
+				count.Mentions++
+			}
+		}
+		counts = append(counts, count)
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].RoomID < counts[j].RoomID })
+	return counts
+}
+
+// notifyMentions pushes a mention event about the message to the peers in
+// peerIDs who are online in other rooms only: those following the room of the
+// message already received it.
+func (cs *ChatService) notifyMentions(message *network.ChatMessage, peerIDs []string) {
+	cs.notify(EventMention, message, peerIDs)
+}
+
+// notify pushes an event of the type about the message to the peers in peerIDs
+// but its sender, through their subscriptions to other rooms than the message's.
+func (cs *ChatService) notify(eventType string, message *network.ChatMessage, peerIDs []string) {
+	if len(peerIDs) == 0 {
+		return
+	}
+	targets := make(map[string]bool, len(peerIDs))
+	for _, peerID := range peerIDs {
+		if message.Sender == nil || peerID != message.Sender.ID {
+			targets[peerID] = true
+		}
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	for sub := range cs.subscribers[message.RoomID] {
+		delete(targets, sub.PeerID)
+	}
+	event := &ChatEvent{Type: eventType, RoomID: message.RoomID, ID: message.ID, Message: message}
+	for roomID, subs := range cs.subscribers {
+		if roomID == message.RoomID {
+			continue
+		}
+		for sub := range subs {
+			if targets[sub.PeerID] {
+				cs.deliver(sub, event)
+			}
+		}
+	}
+}
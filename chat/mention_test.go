@@ -0,0 +1,90 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+func TestMentions(t *testing.T) {
+	room := &network.Room{Peers: map[string]*network.Peer{
+		"alice": {ID: "alice", Name: "Alice"},
+		"bob":   {ID: "bob", Name: "bob.smith"},
+		"carol": {ID: "carol", Name: "carol_"},
+	}}
+
+	assert.Equal(t, []string{"alice", "bob"}, mentions(room, "@alice, can @BOB.SMITH. review? cc @alice"))
+	assert.Equal(t, []string{"carol"}, mentions(room, "(@carol_)"))
+	assert.Nil(t, mentions(room, "mail alice@example.com or @dave"))
+	assert.Nil(t, mentions(room, "@@alice"))
+}
+
+func TestUnread(t *testing.T) {
+	chatService, _, roomID := setupChatRoom(t)
+	transport := chatService.TCPTransport
+	require.NoError(t, transport.JoinRoom(roomID, &network.Peer{ID: "bob", Name: "Bob"}))
+	host := &network.Peer{ID: "host", Name: "Host"}
+
+	require.NoError(t, chatService.Send(roomID, host, "hi all"))
+	require.NoError(t, chatService.Send(roomID, host, "@bob please look"))
+	_, err := chatService.Reply(roomID, 1, host, "@Bob in a thread")
+	require.NoError(t, err)
+	require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "bob"}, "on it"))
+
+	assert.Equal(t, []*RoomUnread{{RoomID: roomID, Unread: 3, Mentions: 2}}, chatService.Unread("bob"))
+	assert.Equal(t, []*RoomUnread{{RoomID: roomID, Unread: 1}}, chatService.Unread("host"))
+	assert.Empty(t, chatService.Unread("stranger"))
+
+	lastReadID, err := chatService.MarkRead(roomID, "bob", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, lastReadID)
+	assert.Equal(t, []*RoomUnread{{RoomID: roomID, LastReadID: 2, Unread: 1, Mentions: 1}}, chatService.Unread("bob"))
+
+	// Read markers never move back
+	lastReadID, err = chatService.MarkRead(roomID, "bob", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, lastReadID)
+	lastReadID, err = chatService.MarkRead(roomID, "bob", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 4, lastReadID)
+	assert.Equal(t, []*RoomUnread{{RoomID: roomID, LastReadID: 4}}, chatService.Unread("bob"))
+
+	_, err = chatService.MarkRead(roomID, "bob", 5)
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	_, err = chatService.MarkRead(roomID, "stranger", 1)
+	assert.ErrorIs(t, err, ErrNotRoomMember)
+}
+
+func TestMentions_NotifyOtherRooms(t *testing.T) {
+	chatService, server, roomID := setupChatRoom(t)
+	transport := chatService.TCPTransport
+	bob := &network.Peer{ID: "bob", Name: "Bob", Email: "bob@example.com", Address: "127.0.0.1:9001"}
+	require.NoError(t, transport.JoinRoom(roomID, bob))
+	otherRoomID, err := transport.CreateRoom(bob)
+	require.NoError(t, err)
+	host := &network.Peer{ID: "host", Name: "Host"}
+
+	// Bob only follows the other room, the guest follows the mentioning room
+	bobConn, _, err := dialChat(t, server, "room_id="+otherRoomID+"&peer_id=bob")
+	require.NoError(t, err)
+	guestConn, _, err := dialChat(t, server, "room_id="+roomID+"&peer_id=guest")
+	require.NoError(t, err)
+
+	require.NoError(t, chatService.Send(roomID, host, "@bob ping"))
+	event := readEvent(t, bobConn)
+	assert.Equal(t, EventMention, event.Type)
+	assert.Equal(t, roomID, event.RoomID)
+	assert.Equal(t, "@bob ping", event.Message.Body)
+	assert.Equal(t, EventMessage, readEvent(t, guestConn).Type)
+
+	// Edits only notify the newly mentioned peers
+	_, err = chatService.Edit(roomID, 1, "host", "@bob ping again")
+	require.NoError(t, err)
+	require.NoError(t, chatService.Send(roomID, host, "@Bob last call"))
+	event = readEvent(t, bobConn)
+	assert.Equal(t, EventMention, event.Type)
+	assert.Equal(t, 2, event.ID)
+}
@@ -0,0 +1,257 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// Bounds of the number of messages returned by a search.
+const (
+	DefaultSearchLimit = 20  // Messages returned when no limit is given
+	MaxSearchLimit     = 100 // Maximum number of messages returned at once
+)
+
+var ErrEmptySearch = errors.New("search must contain words") // The search text has nothing to look for
+
+// SearchQuery selects the messages to find in the rooms of a peer.
+// The text is made of words and "quoted phrases", all of which must appear in
+// a message for it to match, ignoring case and punctuation.
+type SearchQuery struct {
+	Text     string    // Words and phrases to find
+	RoomID   string    // Only search this room, if set
+	SenderID string    // Only messages of this peer, if set
+	Since    time.Time // Only messages sent at or after this time, if set
+	Until    time.Time // Only messages sent before this time, if set
+	Limit    int       // Maximum number of messages, DefaultSearchLimit if 0
+}
+
+// roomIndex is an inverted index of the messages of a room.
+type roomIndex struct {
+	postings map[string]map[int][]int // Positions of the tokens in the messages, keyed by token then message ID
+}
+
+// Search returns the messages matching the query in the rooms and direct
+// conversations the peer is in, newest first. Deleted messages are not searchable.
+func (cs *ChatService) Search(peerID string, query SearchQuery) ([]*network.ChatMessage, error) {
+	if query.Limit < 0 || query.Limit > MaxSearchLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", MaxSearchLimit)
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultSearchLimit
+	}
+	phrases := parseSearch(query.Text)
+	if len(phrases) == 0 {
+		return nil, ErrEmptySearch
+	}
+
+	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+
+	if query.RoomID != "" {
+		if _, err := cs.room(query.RoomID, peerID); err != nil {
+			return nil, err
+		}
+	}
+
+	// The indexes of the rooms deleted since the last search are dropped
+	for roomID := range cs.indexes {
+		if !cs.exists(roomID) {
+			delete(cs.indexes, roomID)
+		}
+	}
+
+	results := []*network.ChatMessage{}
+	for _, room := range cs.roomsOf(peerID) {
+		if query.RoomID != "" && room.ID != query.RoomID {
+			continue
+		}
+		for _, messageID := range cs.indexOf(room).find(phrases) {
+			i, err := messageIndex(room, messageID)
+			if err != nil {
+				continue
+			}
+			if message := room.Chat[i]; query.matches(message) {
+				results = append(results, message)
+			}
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].SentAt.Equal(results[j].SentAt) {
+			return results[i].SentAt.After(results[j].SentAt)
+		}
+		if results[i].RoomID != results[j].RoomID {
+			return results[i].RoomID < results[j].RoomID
+		}
+		return results[i].ID > results[j].ID
+	})
+	if len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+	return results, nil
+}
+
+// matches reports whether the message passes the filters of the query.
+func (q *SearchQuery) matches(message *network.ChatMessage) bool {
+	if q.SenderID != "" && (message.Sender == nil || message.Sender.ID != q.SenderID) {
+		return false
+	}
+	if !q.Since.IsZero() && message.SentAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !message.SentAt.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// parseSearch splits the search text into phrases of tokens, a word being a
+// phrase of one token.
+func parseSearch(text string) [][]string {
+	phrases := [][]string{}
+	// Quotes alternate between words and phrases, an unclosed phrase ends the text
+	for i, part := range strings.Split(text, `"`) {
+		tokens := tokenize(part)
+		if i%2 == 1 {
+			if len(tokens) > 0 {
+				phrases = append(phrases, tokens)
+			}
+			continue
+		}
+		for _, token := range tokens {
+			phrases = append(phrases, []string{token})
+		}
+	}
+	return phrases
+}
+
+// tokenize splits the text into lower case words of letters, digits and underscores.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+// searchableText returns the text of the message that can be searched.
+func searchableText(message *network.ChatMessage) string {
+	if message.Snippet != nil {
+		return message.Body + "\n" + message.Snippet.Code
+	}
+	return message.Body
+}
+
+// indexOf returns the index of the room, building it on first use.
+// The caller must hold the transport mutex.
+func (cs *ChatService) indexOf(room *network.Room) *roomIndex {
+	index, ok := cs.indexes[room.ID]
+	if !ok {
+		index = &roomIndex{postings: make(map[string]map[int][]int)}
+		for _, message := range room.Chat {
+			index.add(message)
+		}
+		cs.indexes[room.ID] = index
+	}
+	return index
+}
+
+// indexMessage adds the message to the index of its room, if built.
+// The caller must hold the transport mutex.
+func (cs *ChatService) indexMessage(message *network.ChatMessage) {
+	if index, ok := cs.indexes[message.RoomID]; ok {
+		index.add(message)
+	}
+}
+
+// unindexMessage removes the message from the index of its room, if built.
+// The caller must hold the transport mutex.
+func (cs *ChatService) unindexMessage(message *network.ChatMessage) {
+	if index, ok := cs.indexes[message.RoomID]; ok {
+		index.remove(message)
+	}
+}
+
+// add records the positions of the tokens of the message.
+func (idx *roomIndex) add(message *network.ChatMessage) {
+	if message.Deleted() {
+		return
+	}
+	for position, token := range tokenize(searchableText(message)) {
+		if idx.postings[token] == nil {
+			idx.postings[token] = make(map[int][]int)
+		}
+		idx.postings[token][message.ID] = append(idx.postings[token][message.ID], position)
+	}
+}
+
+// remove forgets the tokens of the message.
+func (idx *roomIndex) remove(message *network.ChatMessage) {
+	for _, token := range tokenize(searchableText(message)) {
+		if messages, ok := idx.postings[token]; ok {
+			delete(messages, message.ID)
+			if len(messages) == 0 {
+				delete(idx.postings, token)
+			}
+		}
+	}
+}
+
+// find returns the IDs of the messages containing every phrase.
+func (idx *roomIndex) find(phrases [][]string) []int {
+	// Start from the rarest token to keep the candidates few
+	var candidates map[int][]int
+	for _, phrase := range phrases {
+		for _, token := range phrase {
+			messages, ok := idx.postings[token]
+			if !ok {
+				return nil
+			}
+			if candidates == nil || len(messages) < len(candidates) {
+				candidates = messages
+			}
+		}
+	}
+
+	ids := []int{}
+	for messageID := range candidates {
+		matched := true
+		for _, phrase := range phrases {
+			if !idx.contains(messageID, phrase) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			ids = append(ids, messageID)
+		}
+	}
+	return ids
+}
+
+// contains reports whether the tokens of the phrase follow each other in the message.
+func (idx *roomIndex) contains(messageID int, phrase []string) bool {
+	for _, start := range idx.postings[phrase[0]][messageID] {
+		matched := true
+		for offset, token := range phrase[1:] {
+			if !containsPosition(idx.postings[token][messageID], start+offset+1) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// containsPosition reports whether the sorted positions contain the position.
+func containsPosition(positions []int, position int) bool {
+	i := sort.SearchInts(positions, position)
+	return i < len(positions) && positions[i] == position
+}
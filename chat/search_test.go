@@ -0,0 +1,114 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// bodies returns the bodies of the messages.
+func bodies(messages []*network.ChatMessage) []string {
+	result := []string{}
+	for _, message := range messages {
+		result = append(result, message.Body)
+	}
+	return result
+}
+
+func TestParseSearch(t *testing.T) {
+	assert.Equal(t, [][]string{{"go"}, {"test", "race"}, {"now"}}, parseSearch(`Go "test -race" now!`))
+	assert.Equal(t, [][]string{{"unclosed", "phrase"}}, parseSearch(`"unclosed phrase`))
+	assert.Empty(t, parseSearch(`"" -- !`))
+}
+
+func TestSearch(t *testing.T) {
+	chatService, _, roomID := setupChatRoom(t)
+	transport := chatService.TCPTransport
+	host := &network.Peer{ID: "host", Name: "Host", Email: "host@example.com", Address: "127.0.0.1:9000"}
+	otherRoomID, err := transport.CreateRoom(host)
+	require.NoError(t, err)
+	privateRoomID, err := transport.CreateRoom(&network.Peer{ID: "other", Name: "Other", Email: "other@example.com", Address: "127.0.0.1:9001"})
+	require.NoError(t, err)
+
+	// Messages are sent a minute apart
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	clock := start
+	chatService.now = func() time.Time { return clock }
+	send := func(roomID string, sender *network.Peer, content string) {
+		clock = clock.Add(time.Minute)
+		require.NoError(t, chatService.Send(roomID, sender, content))
+	}
+	send(roomID, host, "Run go test -race ./... before pushing")
+	send(roomID, &network.Peer{ID: "guest"}, "the race test is flaky")
+	send(otherRoomID, host, "go test passes here")
+	send(privateRoomID, &network.Peer{ID: "other"}, "secret go test")
+
+	results, err := chatService.Search("host", SearchQuery{Text: "TEST race"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"the race test is flaky", "Run go test -race ./... before pushing"}, bodies(results))
+
+	// Phrases must appear in order
+	results, err = chatService.Search("host", SearchQuery{Text: `"go test"`})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go test passes here", "Run go test -race ./... before pushing"}, bodies(results))
+	results, err = chatService.Search("host", SearchQuery{Text: `"race go"`})
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	// Filters narrow the search to the rooms of the peer
+	results, err = chatService.Search("guest", SearchQuery{Text: "go"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Run go test -race ./... before pushing"}, bodies(results))
+	results, err = chatService.Search("host", SearchQuery{Text: "test", RoomID: otherRoomID})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go test passes here"}, bodies(results))
+	results, err = chatService.Search("host", SearchQuery{Text: "test", SenderID: "guest"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"the race test is flaky"}, bodies(results))
+	results, err = chatService.Search("host", SearchQuery{Text: "test", Since: start.Add(2 * time.Minute), Until: start.Add(3 * time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"the race test is flaky"}, bodies(results))
+	results, err = chatService.Search("host", SearchQuery{Text: "test", Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go test passes here"}, bodies(results))
+
+	_, err = chatService.Search("host", SearchQuery{Text: "secret", RoomID: privateRoomID})
+	assert.ErrorIs(t, err, ErrNotRoomMember)
+	_, err = chatService.Search("host", SearchQuery{Text: `"  "`})
+	assert.ErrorIs(t, err, ErrEmptySearch)
+}
+
+func TestSearch_FollowsChanges(t *testing.T) {
+	chatService, _, roomID := setupChatRoom(t)
+	host := &network.Peer{ID: "host"}
+	require.NoError(t, chatService.Send(roomID, host, "deploy with make release"))
+	search := func(text string) []string {
+		results, err := chatService.Search("host", SearchQuery{Text: text})
+		require.NoError(t, err)
+		return bodies(results)
+	}
+	assert.Len(t, search("release"), 1)
+
+	// The index built by the first search is kept up to date
+	_, err := chatService.Edit(roomID, 1, "host", "deploy with make ship")
+	require.NoError(t, err)
+	assert.Empty(t, search("release"))
+	assert.Len(t, search("ship"), 1)
+
+	_, err = chatService.SendSnippet(roomID, 0, host, "the script", network.CodeSnippet{Language: "sh", Code: "make ship VERSION=2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"the script", "deploy with make ship"}, search("make ship"))
+
+	_, err = chatService.Delete(roomID, 1, "host")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"the script"}, search("ship"))
+
+	chatService.Retention = RetentionPolicy{MaxMessages: 1}
+	require.NoError(t, chatService.Send(roomID, host, "unrelated"))
+	assert.Empty(t, search("ship"))
+	assert.Empty(t, chatService.indexes[roomID].postings["ship"])
+}
@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// maxSnippetSize is the maximum size of the code of a snippet, in bytes.
+const maxSnippetSize = 64 * 1024
+
+// languagePattern matches the language names of snippets, like "go", "c++" or "objective-c".
+var languagePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9+#._-]{0,31}$`)
+
+var (
+	ErrInvalidSnippet = errors.New("invalid code snippet")            // The snippet is malformed or references a missing file
+	ErrNoWorkspace    = errors.New("the room has no workspace files") // Only snippets of rooms editing a workspace can reference files
+)
+
+// WorkspaceFiles gives access to the files of the workspaces.
+type WorkspaceFiles interface {
+	// Lines returns the number of lines of a file of the workspace.
+	// The error wraps fs.ErrNotExist if the workspace has no such regular file.
+	Lines(workspaceID, path string) (int, error)
+}
+
+// SendSnippet sends a code message sharing the snippet with a caption, as a
+// reply to the parent message if parentID is set. A snippet referencing a file
+// must come from the workspace of the room and fit in the file.
+func (cs *ChatService) SendSnippet(roomID string, parentID int, sender *network.Peer, caption string, snippet network.CodeSnippet) (*network.ChatMessage, error) {
+	if err := cs.checkSnippet(roomID, sender.ID, &snippet); err != nil {
+		return nil, err
+	}
+	return cs.post(roomID, parentID, &network.ChatMessage{
+		Sender:  sender,
+		Body:    caption,
+		Kind:    network.ChatMessageCode,
+		Snippet: &snippet,
+	})
+}
+
+// checkSnippet checks the peer is a member of the room, then validates the
+// snippet it sent and cleans its path.
+func (cs *ChatService) checkSnippet(roomID, peerID string, snippet *network.CodeSnippet) error {
+	cs.TCPTransport.Mutex.Lock()
+	room, err := cs.room(roomID, peerID)
+	workspaceID := ""
+	if err == nil {
+		workspaceID = room.WorkspaceID
+	}
+	cs.TCPTransport.Mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := cleanSnippet(snippet); err != nil {
+		return err
+	}
+	return cs.checkFile(workspaceID, snippet)
+}
+
+// cleanSnippet validates the code and lines of the snippet and cleans its path.
+func cleanSnippet(snippet *network.CodeSnippet) error {
+	if !languagePattern.MatchString(snippet.Language) {
+		return fmt.Errorf("%w: language must be 1 to 32 letters, digits or +#._- characters", ErrInvalidSnippet)
+	}
+	if snippet.Code == "" || len(snippet.Code) > maxSnippetSize {
+		return fmt.Errorf("%w: code must be 1 to %d bytes long", ErrInvalidSnippet, maxSnippetSize)
+	}
+	if snippet.Path == "" {
+		if snippet.StartLine != 0 || snippet.EndLine != 0 {
+			return fmt.Errorf("%w: lines require a path", ErrInvalidSnippet)
+		}
+		return nil
+	}
+	if snippet.StartLine < 0 || snippet.EndLine < snippet.StartLine || (snippet.StartLine == 0) != (snippet.EndLine == 0) {
+		return fmt.Errorf("%w: lines must be a range starting at 1", ErrInvalidSnippet)
+	}
+
+	// Stored relative to the workspace, as the file services expect it
+	snippet.Path = path.Clean("/" + snippet.Path)[1:]
+	if snippet.Path == "" {
+		return fmt.Errorf("%w: path must be a file", ErrInvalidSnippet)
+	}
+	return nil
+}
+
+// checkFile checks that the file the snippet comes from, if any, is a file of
+// the workspace with the lines of the snippet.
+func (cs *ChatService) checkFile(workspaceID string, snippet *network.CodeSnippet) error {
+	if snippet.Path == "" {
+		return nil
+	}
+	if workspaceID == "" || cs.Files == nil {
+		return ErrNoWorkspace
+	}
+
+	lines, err := cs.Files.Lines(workspaceID, snippet.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s is not a file of the workspace", ErrInvalidSnippet, snippet.Path)
+	}
+	if err != nil {
+		return err
+	}
+	if snippet.EndLine > lines {
+		return fmt.Errorf("%w: %s has %d lines", ErrInvalidSnippet, snippet.Path, lines)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package chat
+
+import (
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// memoryFiles is a WorkspaceFiles holding the line counts of the files, keyed by workspace ID and path.
+type memoryFiles map[string]int
+
+func (f memoryFiles) Lines(workspaceID, path string) (int, error) {
+	lines, ok := f[workspaceID+"/"+path]
+	if !ok {
+		return 0, fmt.Errorf("%s: %w", path, fs.ErrNotExist)
+	}
+	return lines, nil
+}
+
+func TestSendSnippet(t *testing.T) {
+	chatService, _, roomID := setupChatRoom(t)
+	chatService.Files = memoryFiles{"ws1/src/main.go": 40}
+	host := &network.Peer{ID: "host"}
+	snippet := network.CodeSnippet{Language: "go", Code: "func main() {}"}
+
+	// Snippets without file work in any room
+	message, err := chatService.SendSnippet(roomID, 0, host, "look", snippet)
+	require.NoError(t, err)
+	assert.Equal(t, network.ChatMessageCode, message.Kind)
+	assert.Equal(t, "look", message.Body)
+	assert.Equal(t, &snippet, message.Snippet)
+
+	snippet.Path, snippet.StartLine, snippet.EndLine = "src/main.go", 3, 5
+	_, err = chatService.SendSnippet(roomID, 0, host, "", snippet)
+	assert.ErrorIs(t, err, ErrNoWorkspace)
+
+	chatService.TCPTransport.Rooms[roomID].WorkspaceID = "ws1"
+	snippet.Path = "/src/../src/./main.go"
+	message, err = chatService.SendSnippet(roomID, 1, host, "", snippet)
+	require.NoError(t, err)
+	assert.Equal(t, "src/main.go", message.Snippet.Path)
+	assert.Equal(t, 1, message.ParentID)
+
+	for _, invalid := range []network.CodeSnippet{
+		{Language: "", Code: "x"},
+		{Language: "go lang", Code: "x"},
+		{Language: "go"},
+		{Language: "go", Code: "x", StartLine: 1, EndLine: 1},
+		{Language: "go", Code: "x", Path: "src/main.go", StartLine: 5, EndLine: 3},
+		{Language: "go", Code: "x", Path: "src/main.go", StartLine: 0, EndLine: 3},
+		{Language: "go", Code: "x", Path: "src/main.go", StartLine: 40, EndLine: 41},
+		{Language: "go", Code: "x", Path: "src/other.go"},
+		{Language: "go", Code: "x", Path: "/.."},
+	} {
+		_, err = chatService.SendSnippet(roomID, 0, host, "", invalid)
+		assert.ErrorIs(t, err, ErrInvalidSnippet, "%+v", invalid)
+	}
+
+	// Strangers are refused before their snippet is looked at
+	stranger := &network.Peer{ID: "eve"}
+	for _, probe := range []network.CodeSnippet{
+		{Language: "go", Code: "x", Path: "src/main.go", StartLine: 40, EndLine: 41},
+		{Language: "go", Code: "x", Path: "src/other.go"},
+	} {
+		_, err = chatService.SendSnippet(roomID, 0, stranger, "", probe)
+		assert.ErrorIs(t, err, ErrNotRoomMember, "%+v", probe)
+	}
+}
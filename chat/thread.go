@@ -0,0 +1,53 @@
+package chat
+
+import (
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// Reply sends a chat message replying to a message of the room.
+// Replies to a reply join the thread of its parent, so threads stay flat.
+func (cs *ChatService) Reply(roomID string, parentID int, sender *network.Peer, content string) (*network.ChatMessage, error) {
+	if parentID < 1 {
+		return nil, ErrMessageNotFound
+	}
+	return cs.post(roomID, parentID, textMessage(sender, content))
+}
+
+// Thread returns a message and a page of its replies, oldest first, to a member of the room.
+// The replies are selected like the messages of History. Given a reply, the
+// thread it belongs to is returned.
+func (cs *ChatService) Thread(roomID string, parentID int, query HistoryQuery) (*network.ChatMessage, *HistoryPage, error) {
+	if err := query.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+	room, err := cs.room(roomID, query.ReaderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	i, err := threadIndex(room, parentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	parent := room.Chat[i]
+	query.ThreadID = parent.ID
+	return parent, query.page(room.Chat), nil
+}
+
+// threadIndex returns the position of the message a reply to parentID belongs
+// to: the parent itself, or the parent of the thread if it is a reply.
+// The caller must hold the transport mutex.
+func threadIndex(room *network.Room, parentID int) (int, error) {
+	i, err := messageIndex(room, parentID)
+	if err != nil {
+		return 0, err
+	}
+	if root := room.Chat[i].ParentID; root != 0 {
+		if i, err = messageIndex(room, root); err != nil {
+			return 0, err
+		}
+	}
+	return i, nil
+}
@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+func TestReply(t *testing.T) {
+	chatService, server, roomID := setupChatRoom(t)
+	require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "host"}, "bug #1"))
+	require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "host"}, "bug #2"))
+	conn, _, err := dialChat(t, server, "room_id="+roomID+"&peer_id=guest&last_id=2")
+	require.NoError(t, err)
+
+	reply, err := chatService.Reply(roomID, 1, &network.Peer{ID: "guest"}, "fixed #1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, reply.ID)
+	assert.Equal(t, 1, reply.ParentID)
+
+	// The reply is pushed, then the updated summary of its parent
+	event := readEvent(t, conn)
+	assert.Equal(t, EventMessage, event.Type)
+	assert.Equal(t, 3, event.ID)
+	event = readEvent(t, conn)
+	assert.Equal(t, EventThread, event.Type)
+	assert.Equal(t, 1, event.ID)
+	require.NotNil(t, event.Message.Thread)
+	assert.Equal(t, 1, event.Message.Thread.Replies)
+
+	// Replies to a reply join the thread
+	reply, err = chatService.Reply(roomID, 3, &network.Peer{ID: "host"}, "thanks")
+	require.NoError(t, err)
+	assert.Equal(t, 1, reply.ParentID)
+
+	parent, page, err := chatService.Thread(roomID, 3, HistoryQuery{ReaderID: "host"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, parent.ID)
+	assert.Equal(t, &network.ThreadSummary{Replies: 2, LastReplyID: 4, LastReplyAt: reply.SentAt, LastSenderID: "host"}, parent.Thread)
+	assert.Equal(t, []int{3, 4}, ids(page))
+
+	// The room history leaves the replies in their thread
+	page, err = chatService.History(roomID, HistoryQuery{ReaderID: "host"})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, ids(page))
+
+	_, err = chatService.Reply(roomID, 9, &network.Peer{ID: "host"}, "lost")
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	_, _, err = chatService.Thread(roomID, 9, HistoryQuery{ReaderID: "host"})
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	_, _, err = chatService.Thread(roomID, 1, HistoryQuery{ReaderID: "stranger"})
+	assert.ErrorIs(t, err, ErrNotRoomMember)
+	_, err = chatService.Reply(roomID, 1, &network.Peer{ID: "stranger"}, "hi")
+	assert.ErrorIs(t, err, ErrNotRoomMember)
+	_, err = chatService.Delete(roomID, 2, "host")
+	require.NoError(t, err)
+	_, err = chatService.Reply(roomID, 2, &network.Peer{ID: "host"}, "too late")
+	assert.ErrorIs(t, err, ErrMessageDeleted)
+}
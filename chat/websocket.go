@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/auth"
+)
+
+// Configure the WebSocket upgrader
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// HandleChat upgrades the request to a websocket pushing the messages of a room
+// as they are sent. The peer is the one authenticated by the auth websocket
+// middleware and must be a member of the room given by the "room_id" query
+// parameter. Clients reconnecting pass the ID of the last message they received
+// as "last_id" to get the messages they missed first. The backlog holds the
+// messages in their current state, so changes made while disconnected are not replayed.
+// The peer is also notified of the messages mentioning it in the rooms it does not follow.
+func (cs *ChatService) HandleChat(w http.ResponseWriter, r *http.Request) {
+	peer := auth.PeerFromRequest(r)
+	if peer == nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	roomID := r.URL.Query().Get("room_id")
+	lastID := 0
+	if value := r.URL.Query().Get("last_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "last_id must be a message ID", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+	if err := cs.checkMembership(roomID, peer.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// Subscribe before upgrading, so no message is missed in between
+	sub, backlog, err := cs.Subscribe(roomID, peer.ID, lastID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cs.Unsubscribe(sub)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade to WebSocket: %v", err)
+		return
+	}
+	defer conn.Close()
+	// Disconnect as soon as the session is revoked
+	auth.CloseOnRevoke(r, conn)
+
+	// The client does not send anything, reading only detects the disconnection
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	push := func(event *ChatEvent) error {
+		// The backlog and the live messages may overlap, changes to
+		// messages already received are always pushed
+		if event.Type == EventMessage {
+			if event.ID <= lastID {
+				return nil
+			}
+			lastID = event.ID
+		}
+		return conn.WriteJSON(event)
+	}
+	for _, event := range backlog {
+		if err := push(event); err != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				if cs.checkMembership(roomID, peer.ID) != nil {
+					conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "no longer a member of the room"))
+					return
+				}
+				// Dropped for falling behind, the client resumes from lastID
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow, reconnect with last_id"))
+				return
+			}
+			if err := push(event); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// checkMembership returns an error if the peer is not a member of the room.
+func (cs *ChatService) checkMembership(roomID, peerID string) error {
+	if roomID == "" {
+		return fmt.Errorf("room_id is required")
+	}
+
+	cs.TCPTransport.Mutex.Lock()
+	defer cs.TCPTransport.Mutex.Unlock()
+
+	_, err := cs.room(roomID, peerID)
+	return err
+}
@@ -0,0 +1,178 @@
+package chat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/auth"
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// setupChatRoom creates a chat server with a room containing the host and one guest.
+func setupChatRoom(t *testing.T) (*ChatService, *httptest.Server, string) {
+	transport := network.NewTCPTransport()
+	host := &network.Peer{ID: "host", Name: "Host", Email: "host@example.com", Address: "127.0.0.1:9000"}
+	roomID, err := transport.CreateRoom(host)
+	require.NoError(t, err)
+	require.NoError(t, transport.JoinRoom(roomID, &network.Peer{ID: "guest"}))
+
+	chatService := NewChatService(transport)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Stand in for the auth websocket middleware
+		if peerID := r.URL.Query().Get("peer_id"); peerID != "" {
+			r = r.WithContext(auth.WithPeer(r.Context(), &network.Peer{ID: peerID}))
+		}
+		chatService.HandleChat(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return chatService, server, roomID
+}
+
+// dialChat connects a peer to the chat websocket of the room.
+func dialChat(t *testing.T, server *httptest.Server, query string) (*websocket.Conn, *http.Response, error) {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "?" + query
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if conn != nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+// readEvent reads the next event from the connection.
+func readEvent(t *testing.T, conn *websocket.Conn) *ChatEvent {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var event ChatEvent
+	require.NoError(t, conn.ReadJSON(&event))
+	return &event
+}
+
+func TestHandleChat_RejectsNonMembers(t *testing.T) {
+	_, server, roomID := setupChatRoom(t)
+
+	_, resp, err := dialChat(t, server, "room_id="+roomID+"&peer_id=stranger")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	_, resp, err = dialChat(t, server, "room_id="+roomID)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_, resp, err = dialChat(t, server, "room_id="+roomID+"&peer_id=guest&last_id=5")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestHandleChat_PushesMessages(t *testing.T) {
+	chatService, server, roomID := setupChatRoom(t)
+	conn, _, err := dialChat(t, server, "room_id="+roomID+"&peer_id=guest")
+	require.NoError(t, err)
+
+	require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "host"}, "hello"))
+	event := readEvent(t, conn)
+	assert.Equal(t, EventMessage, event.Type)
+	assert.Equal(t, roomID, event.RoomID)
+	assert.Equal(t, 1, event.ID)
+	assert.Equal(t, 1, event.Message.ID)
+	assert.Equal(t, "host", event.Message.Sender.ID)
+	assert.Equal(t, "hello", event.Message.Body)
+
+	require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "guest"}, "hi"))
+	assert.Equal(t, 2, readEvent(t, conn).ID)
+}
+
+func TestHandleChat_ResumesFromLastID(t *testing.T) {
+	chatService, server, roomID := setupChatRoom(t)
+	for _, message := range []string{"one", "two", "three"} {
+		require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "host"}, message))
+	}
+
+	// The messages after the last one received are sent first, then the new ones
+	conn, _, err := dialChat(t, server, "room_id="+roomID+"&peer_id=guest&last_id=1")
+	require.NoError(t, err)
+	assert.Equal(t, "two", readEvent(t, conn).Message.Body)
+	assert.Equal(t, "three", readEvent(t, conn).Message.Body)
+
+	require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "host"}, "four"))
+	event := readEvent(t, conn)
+	assert.Equal(t, 4, event.ID)
+	assert.Equal(t, "four", event.Message.Body)
+}
+
+func TestSubscribe_DropsSlowSubscribers(t *testing.T) {
+	chatService, _, roomID := setupChatRoom(t)
+	sub, backlog, err := chatService.Subscribe(roomID, "guest", 0)
+	require.NoError(t, err)
+	assert.Empty(t, backlog)
+
+	for i := 0; i <= subscriptionBuffer; i++ {
+		require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "host"}, "spam"))
+	}
+	received := 0
+	for range sub.C {
+		received++
+	}
+	assert.Equal(t, subscriptionBuffer, received)
+
+	// Unsubscribing a dropped subscription is harmless
+	chatService.Unsubscribe(sub)
+}
+
+func TestSubscribe_OrderedUnderConcurrentSenders(t *testing.T) {
+	chatService, _, roomID := setupChatRoom(t)
+	sub, _, err := chatService.Subscribe(roomID, "guest", 0)
+	require.NoError(t, err)
+	defer chatService.Unsubscribe(sub)
+
+	// Each subscriber receives the messages in the order of their IDs, none missing
+	var wg sync.WaitGroup
+	for _, peerID := range []string{"host", "guest"} {
+		wg.Add(1)
+		go func(peerID string) {
+			defer wg.Done()
+			for i := 0; i < subscriptionBuffer/2; i++ {
+				assert.NoError(t, chatService.Send(roomID, &network.Peer{ID: peerID}, "race"))
+			}
+		}(peerID)
+	}
+	wg.Wait()
+	for id := 1; id <= subscriptionBuffer; id++ {
+		event := <-sub.C
+		require.Equal(t, id, event.ID)
+	}
+}
+
+func TestSubscribe_ClosedWhenLeaving(t *testing.T) {
+	chatService, server, roomID := setupChatRoom(t)
+	conn, _, err := dialChat(t, server, "room_id="+roomID+"&peer_id=guest")
+	require.NoError(t, err)
+	hostSub, _, err := chatService.Subscribe(roomID, "host", 0)
+	require.NoError(t, err)
+	defer chatService.Unsubscribe(hostSub)
+
+	// The websocket of the peer leaving is closed, the others stay open
+	require.NoError(t, chatService.TCPTransport.LeaveRoom(roomID, "guest"))
+	chatService.PruneSubscriptions()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "unexpected error %v", err)
+
+	require.NoError(t, chatService.Send(roomID, &network.Peer{ID: "host"}, "still here"))
+	assert.Equal(t, "still here", (<-hostSub.C).Message.Body)
+
+	// Leaving a group conversation closes the subscriptions to it as well
+	conversation, err := chatService.StartDirect(&network.Peer{ID: "alice"}, []*network.Peer{{ID: "bob"}, {ID: "carol"}})
+	require.NoError(t, err)
+	sub, _, err := chatService.Subscribe(conversation.ID, "bob", 0)
+	require.NoError(t, err)
+	require.NoError(t, chatService.LeaveDirect(conversation.ID, "bob"))
+	_, open := <-sub.C
+	assert.False(t, open)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gorilla/websocket"
 
+	"github.com/Rishi-Mishra0704/code-collab-backend/auth"
 	models "github.com/Rishi-Mishra0704/code-collab-backend/models"
 )
 
@@ -26,6 +27,8 @@ func HandleCollaborations(w http.ResponseWriter, r *http.Request) {
 		log.Fatal(err)
 	}
 	defer ws.Close()
+	// Disconnect as soon as the session is revoked
+	auth.CloseOnRevoke(r, ws)
 
 	// Register new client
 	clients[ws] = true
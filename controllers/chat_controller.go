@@ -3,11 +3,18 @@
 package controllers
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/Rishi-Mishra0704/code-collab-backend/auth"
 	"github.com/Rishi-Mishra0704/code-collab-backend/chat"
 	"github.com/Rishi-Mishra0704/code-collab-backend/network"
 )
@@ -16,6 +23,8 @@ import (
 type ChatController struct {
 	TCPTransport *network.TCPTransport // Reference to the TCPTransport instance
 	ChatService  *chat.ChatService     // Reference to the ChatService instance
+	Orgs         auth.OrgStore         // Organizations owning rooms, nil if rooms cannot belong to organizations
+	Users        auth.UserStore        // Users direct conversations can be started with, nil if direct messages are disabled
 }
 
 // NewChatController creates a new instance of ChatController.
@@ -27,51 +36,136 @@ func NewChatController(transport *network.TCPTransport, chatService *chat.ChatSe
 }
 
 // CreateRoom handles the creation of a new chat room.
+// The host is the authenticated peer; the request body may override its address
+// and make the room belong to an organization or one of its workspaces, which
+// the host must be a member of.
 func (cc *ChatController) CreateRoom(c *gin.Context) {
-	// Parse request body to get host peer details
-	var host network.Peer
-	if err := c.BindJSON(&host); err != nil {
+	host := callerPeer(c)
+	if host == nil {
+		return
+	}
+
+	// Parse request body to get the host address
+	var request struct {
+		Address     string `json:"address"`      // Host:Port address of the host peer
+		OrgID       string `json:"org_id"`       // Organization owning the room, if any
+		WorkspaceID string `json:"workspace_id"` // Workspace edited in the room, if any
+	}
+	if err := bindOptionalJSON(c, &request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if request.Address != "" {
+		host.Address = request.Address
+	}
+	// The host must be reachable, so its address is required
+	if errs := auth.ValidatePeer(host, true); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, auth.ValidationResponse(errs))
+		return
+	}
 
-	// Create room and get room ID
-	roomID, err := cc.TCPTransport.CreateRoom(&host)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	roomID, ok := cc.newRoom(c, host, request.OrgID, request.WorkspaceID)
+	if !ok {
 		return
 	}
 
+	// Public rooms are advertised to the LAN by node discovery
+	if c.Query("public") == "true" {
+		if err := cc.TCPTransport.SetRoomVisibility(roomID, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"room_id": roomID})
 }
 
-// JoinRoom handles a peer joining an existing chat room.
+// newRoom creates a room hosted by the peer, belonging to the organization or
+// workspace if set. It responds with an error and returns false on failure.
+func (cc *ChatController) newRoom(c *gin.Context, host *network.Peer, orgID, workspaceID string) (string, bool) {
+	orgID, ok := cc.roomOrg(c, host.ID, orgID, workspaceID)
+	if !ok {
+		return "", false
+	}
+
+	// Create room and get room ID
+	roomID, err := cc.TCPTransport.CreateRoom(host)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", false
+	}
+	if orgID != "" {
+		if err := cc.TCPTransport.SetRoomOrg(roomID, orgID, workspaceID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return "", false
+		}
+	}
+	return roomID, true
+}
+
+// JoinRoom handles the authenticated peer joining an existing chat room.
+// Rooms of an organization can only be joined by its members.
 func (cc *ChatController) JoinRoom(c *gin.Context) {
-	// Parse request body to get peer details including room_id
+	peer := callerPeer(c)
+	if peer == nil {
+		return
+	}
+
+	// Parse request body to get the room_id and the peer address
 	var request struct {
-		RoomID string `json:"room_id"`
-		Peer   network.Peer
+		RoomID  string `json:"room_id"`
+		Address string `json:"address"`
 	}
 	if err := c.BindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if request.Address != "" {
+		peer.Address = request.Address
+	}
+	errs := auth.ValidatePeer(peer, false)
+	if err := auth.ValidateRoomID(request.RoomID); err != nil {
+		errs.Add("room_id", err.Error())
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, auth.ValidationResponse(errs))
+		return
+	}
+
+	room, err := cc.TCPTransport.GetRoom(request.RoomID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !cc.canAccess(room, peer.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": auth.ErrNotOrgMember.Error()})
+		return
+	}
 
 	// Join room with peer
-	err := cc.TCPTransport.JoinRoom(request.RoomID, &request.Peer)
+	err = cc.TCPTransport.JoinRoom(request.RoomID, peer)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Peer %s joined room %s", request.Peer.ID, request.RoomID)})
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Peer %s joined room %s", peer.ID, request.RoomID)})
 }
 
 // LeaveRoom handles a peer leaving a chat room.
-// Update the LeaveRoom function to properly extract the peer ID from the request parameters.
+// Peers can only remove themselves from a room.
 func (cc *ChatController) LeaveRoom(c *gin.Context) {
+	caller := callerPeer(c)
+	if caller == nil {
+		return
+	}
+
 	roomID := c.Param("roomID")
 	peerID := c.Param("peerID") // Ensure peerID is correctly extracted
+	if peerID != caller.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "peers can only leave rooms on their own behalf"})
+		return
+	}
 
 	// Leave room
 	err := cc.TCPTransport.LeaveRoom(roomID, peerID)
@@ -79,58 +173,636 @@ func (cc *ChatController) LeaveRoom(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	// Stop pushing the chat of the room to the peer
+	cc.ChatService.PruneSubscriptions()
 
 	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Peer %s left room %s", peerID, roomID)})
 }
 
+// RoomInfo describes a room in the room list. It leaves out the chat history
+// and the contact details of the peers.
+type RoomInfo struct {
+	ID          string     `json:"id"`                     // Unique identifier for the room
+	HostID      string     `json:"host_id"`                // ID of the peer hosting the room
+	Peers       []RoomPeer `json:"peers"`                  // Peers of the room, sorted by ID
+	Public      bool       `json:"public"`                 // Indicates whether the room is advertised on the LAN
+	OrgID       string     `json:"org_id,omitempty"`       // Organization owning the room, empty for personal rooms
+	WorkspaceID string     `json:"workspace_id,omitempty"` // Workspace of the organization the room edits, if any
+}
+
+// RoomPeer names a peer of a room in the room list.
+type RoomPeer struct {
+	ID   string `json:"id"`   // Unique identifier for the peer
+	Name string `json:"name"` // Name of the peer
+}
+
+// GetRooms lists the rooms the authenticated peer is a member of and the public
+// rooms, leaving out those of the organizations it is not a member of.
 func (cc *ChatController) GetRooms(c *gin.Context) {
-	// Get all rooms from the TCPTransport
-	rooms := cc.TCPTransport.GetAllRooms()
+	caller := callerPeer(c)
+	if caller == nil {
+		return
+	}
+
+	// Described under the lock, as the rooms change concurrently
+	cc.TCPTransport.Mutex.Lock()
+	visible := []*RoomInfo{}
+	for _, room := range cc.TCPTransport.GetAllRooms() {
+		if _, member := room.Peers[caller.ID]; member || room.Public {
+			visible = append(visible, describeRoom(room))
+		}
+	}
+	cc.TCPTransport.Mutex.Unlock()
+
+	rooms := make(map[string]*RoomInfo, len(visible))
+	for _, room := range visible {
+		if cc.orgAccess(room.OrgID, caller.ID) {
+			rooms[room.ID] = room
+		}
+	}
 
 	// Return the rooms as JSON response
 	c.JSON(http.StatusOK, gin.H{"rooms": rooms})
 }
 
-// SendChatMessage handles sending a chat message to a room.
+// describeRoom returns the description of the room for the room list.
+// The caller must hold the transport mutex.
+func describeRoom(room *network.Room) *RoomInfo {
+	info := &RoomInfo{
+		ID:          room.ID,
+		Peers:       make([]RoomPeer, 0, len(room.Peers)),
+		Public:      room.Public,
+		OrgID:       room.OrgID,
+		WorkspaceID: room.WorkspaceID,
+	}
+	if room.Host != nil {
+		info.HostID = room.Host.ID
+	}
+	for _, peer := range room.Peers {
+		info.Peers = append(info.Peers, RoomPeer{ID: peer.ID, Name: peer.Name})
+	}
+	sort.Slice(info.Peers, func(i, j int) bool { return info.Peers[i].ID < info.Peers[j].ID })
+	return info
+}
+
+// SendChatMessage handles sending a chat message to a room, or a reply to one of
+// its messages when "parent_id" is set. With a "snippet", the message is a code
+// message and its text the caption. The sender is the authenticated peer.
 func (cc *ChatController) SendChatMessage(c *gin.Context) {
+	sender := callerPeer(c)
+	if sender == nil {
+		return
+	}
 	roomID := c.Param("roomID")
+	if !cc.checkRoomAccess(c, roomID, sender.ID) {
+		return
+	}
 
-	// Parse request body to get sender and message details
+	// Parse request body to get the message details
 	var message struct {
-		SenderID string `json:"sender_id"`
-		Message  string `json:"message"`
+		Message  string               `json:"message"`
+		ParentID int                  `json:"parent_id"` // Message replied to, if any
+		Snippet  *network.CodeSnippet `json:"snippet"`   // Code shared, the message being its caption
 	}
 	if err := c.BindJSON(&message); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Retrieve the sender peer from the request parameters
-	senderID := message.SenderID
+	// Send the message to the room using the ChatService
+	var err error
+	if message.Snippet != nil {
+		_, err = cc.ChatService.SendSnippet(roomID, message.ParentID, sender, message.Message, *message.Snippet)
+	} else if message.ParentID != 0 {
+		_, err = cc.ChatService.Reply(roomID, message.ParentID, sender, message.Message)
+	} else {
+		err = cc.ChatService.Send(roomID, sender, message.Message)
+	}
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Message sent successfully"})
+}
 
-	// Create a new peer with the sender ID
-	sender := &network.Peer{
-		ID: senderID,
+// EditChatMessage handles editing a chat message of the authenticated peer.
+func (cc *ChatController) EditChatMessage(c *gin.Context) {
+	peer, messageID, ok := cc.messageRequest(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		Message string `json:"message"` // New body of the message
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	// Send the message to the room using the ChatService
-	err := cc.ChatService.Send(roomID, sender, message.Message)
+	message, err := cc.ChatService.Edit(c.Param("roomID"), messageID, peer.ID, request.Message)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondChatError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Message sent successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// DeleteChatMessage handles deleting a chat message. Peers can delete their own
+// messages and hosts any message of their room.
+func (cc *ChatController) DeleteChatMessage(c *gin.Context) {
+	peer, messageID, ok := cc.messageRequest(c)
+	if !ok {
+		return
+	}
+
+	message, err := cc.ChatService.Delete(c.Param("roomID"), messageID, peer.ID)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// ReactToChatMessage handles toggling a reaction of the authenticated peer to a chat message.
+func (cc *ChatController) ReactToChatMessage(c *gin.Context) {
+	peer, messageID, ok := cc.messageRequest(c)
+	if !ok {
+		return
+	}
+	var request struct {
+		Emoji string `json:"emoji"` // Emoji to add or remove
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message, err := cc.ChatService.React(c.Param("roomID"), messageID, peer.ID, request.Emoji)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
 }
 
+// GetChatHistory returns a page of the chat history of a room, oldest message first.
+// The query parameters "before" and "after" page from a message ID, "limit"
+// bounds the page size, "sender" keeps the messages of one peer and "since" and
+// "until" (RFC 3339) keep the messages sent in a time range.
 func (cc *ChatController) GetChatHistory(c *gin.Context) {
+	reader := callerPeer(c)
+	if reader == nil {
+		return
+	}
 	roomID := c.Param("roomID")
+	if !cc.checkRoomAccess(c, roomID, reader.ID) {
+		return
+	}
+	query, errs := historyQuery(c)
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, auth.ValidationResponse(errs))
+		return
+	}
 
 	// Retrieve the chat history for the specified room using the ChatService
-	chatHistory, err := cc.ChatService.Receive(roomID)
+	page, err := cc.ChatService.History(roomID, query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondChatError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// historyQuery parses the query parameters of GetChatHistory.
+func historyQuery(c *gin.Context) (chat.HistoryQuery, auth.ValidationErrors) {
+	errs := auth.ValidationErrors{}
+	query := chat.HistoryQuery{
+		BeforeID: queryNumber(c, errs, "before", 0),
+		AfterID:  queryNumber(c, errs, "after", 0),
+		Limit:    queryNumber(c, errs, "limit", chat.MaxHistoryLimit),
+		SenderID: c.Query("sender"),
+		Since:    queryTime(c, errs, "since"),
+		Until:    queryTime(c, errs, "until"),
+	}
+	if peer := auth.CurrentPeer(c); peer != nil {
+		query.ReaderID = peer.ID
+	}
+	if query.BeforeID != 0 && query.AfterID != 0 {
+		errs.Add("after", "cannot be combined with before")
+	}
+	return query, errs
+}
+
+// queryNumber parses a positive number from the query parameters, a message ID
+// if max is 0. It returns 0 if the parameter is missing or invalid, recording the error.
+func queryNumber(c *gin.Context, errs auth.ValidationErrors, name string, max int) int {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || (max > 0 && n > max) {
+		if max > 0 {
+			errs.Add(name, fmt.Sprintf("must be a number between 1 and %d", max))
+		} else {
+			errs.Add(name, "must be a message ID")
+		}
+		return 0
+	}
+	return n
+}
+
+// queryTime parses an RFC 3339 time from the query parameters.
+// It returns the zero time if the parameter is missing or invalid, recording the error.
+func queryTime(c *gin.Context, errs auth.ValidationErrors, name string) time.Time {
+	raw := c.Query(name)
+	if raw == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		errs.Add(name, "must be an RFC 3339 time")
+		return time.Time{}
+	}
+	return t
+}
+
+// SearchChat finds the messages of the rooms of the authenticated peer containing
+// the words and "quoted phrases" of the "q" query parameter, newest first.
+// The "room_id", "sender", "since" and "until" query parameters narrow the search
+// and "limit" bounds the number of messages returned.
+func (cc *ChatController) SearchChat(c *gin.Context) {
+	peer := callerPeer(c)
+	if peer == nil {
+		return
+	}
+	errs := auth.ValidationErrors{}
+	query := chat.SearchQuery{
+		Text:     c.Query("q"),
+		RoomID:   c.Query("room_id"),
+		SenderID: c.Query("sender"),
+		Since:    queryTime(c, errs, "since"),
+		Until:    queryTime(c, errs, "until"),
+		Limit:    queryNumber(c, errs, "limit", chat.MaxSearchLimit),
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, auth.ValidationResponse(errs))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"chat_history": chatHistory})
+	results, err := cc.ChatService.Search(peer.ID, query)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// GetChatThread returns a message and a page of its replies, oldest first.
+// The replies are paged and filtered with the query parameters of GetChatHistory.
+func (cc *ChatController) GetChatThread(c *gin.Context) {
+	_, messageID, ok := cc.messageRequest(c)
+	if !ok {
+		return
+	}
+	query, errs := historyQuery(c)
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, auth.ValidationResponse(errs))
+		return
+	}
+
+	parent, page, err := cc.ChatService.Thread(c.Param("roomID"), messageID, query)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"parent": parent, "chat_history": page.Messages, "has_more": page.HasMore})
+}
+
+// MarkChatRead handles recording the last message of a room read by the
+// authenticated peer, the last message of the room if "message_id" is omitted.
+func (cc *ChatController) MarkChatRead(c *gin.Context) {
+	peer := callerPeer(c)
+	if peer == nil {
+		return
+	}
+	var request struct {
+		MessageID int `json:"message_id"` // Last message read
+	}
+	if err := bindOptionalJSON(c, &request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !cc.checkRoomAccess(c, c.Param("roomID"), peer.ID) {
+		return
+	}
+	lastReadID, err := cc.ChatService.MarkRead(c.Param("roomID"), peer.ID, request.MessageID)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"last_read_id": lastReadID})
+}
+
+// GetUnreadCounts returns the unread message and mention counts of every room
+// of the authenticated peer.
+func (cc *ChatController) GetUnreadCounts(c *gin.Context) {
+	peer := callerPeer(c)
+	if peer == nil {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rooms": cc.ChatService.Unread(peer.ID)})
+}
+
+// StartDirectConversation starts a direct conversation between the authenticated
+// peer and the users in "peer_ids", or returns the existing one-to-one
+// conversation with the user. The conversation ID is used as room ID to chat in
+// the conversation, whose messages only its participants can access.
+func (cc *ChatController) StartDirectConversation(c *gin.Context) {
+	creator := callerPeer(c)
+	if creator == nil {
+		return
+	}
+	if cc.Users == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "direct messages are disabled"})
+		return
+	}
+
+	var request struct {
+		PeerIDs []string `json:"peer_ids"` // Users to talk to
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	errs := auth.ValidationErrors{}
+	if len(request.PeerIDs) == 0 || len(request.PeerIDs) >= chat.MaxParticipants {
+		errs.Add("peer_ids", fmt.Sprintf("must list 1 to %d users", chat.MaxParticipants-1))
+	}
+	others := []*network.Peer{}
+	for _, peerID := range request.PeerIDs {
+		if len(errs) > 0 {
+			break
+		}
+		if err := auth.ValidatePeerID(peerID); err != nil {
+			errs.Add("peer_ids", err.Error())
+			break
+		}
+		user, err := cc.Users.GetByID(peerID)
+		if errors.Is(err, auth.ErrUserNotFound) {
+			errs.Add("peer_ids", fmt.Sprintf("user %s does not exist", peerID))
+			break
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		others = append(others, user.Peer())
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, auth.ValidationResponse(errs))
+		return
+	}
+
+	conversation, err := cc.ChatService.StartDirect(creator, others)
+	if err != nil {
+		respondChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"conversation": conversation})
+}
+
+// GetDirectConversations lists the direct conversations of the authenticated
+// peer, the most recently active first.
+func (cc *ChatController) GetDirectConversations(c *gin.Context) {
+	peer := callerPeer(c)
+	if peer == nil {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"conversations": cc.ChatService.Directs(peer.ID)})
+}
+
+// LeaveDirectConversation handles the authenticated peer leaving a group conversation.
+func (cc *ChatController) LeaveDirectConversation(c *gin.Context) {
+	peer := callerPeer(c)
+	if peer == nil {
+		return
+	}
+	if err := cc.ChatService.LeaveDirect(c.Param("conversationID"), peer.ID); err != nil {
+		respondChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Peer %s left conversation %s", peer.ID, c.Param("conversationID"))})
+}
+
+// maxTranscriptSize is the maximum size of an imported transcript, in bytes.
+const maxTranscriptSize = 32 << 20
+
+// transcriptTypes are the content types and file extensions of the export formats.
+var transcriptTypes = map[string][2]string{
+	chat.ExportJSON:     {"application/json; charset=utf-8", "json"},
+	chat.ExportMarkdown: {"text/markdown; charset=utf-8", "md"},
+	chat.ExportText:     {"text/plain; charset=utf-8", "txt"},
+}
+
+// ExportChat downloads the chat transcript of a room in the "format" query
+// parameter, json by default. Only the host of the room can export it.
+func (cc *ChatController) ExportChat(c *gin.Context) {
+	peer := callerPeer(c)
+	if peer == nil {
+		return
+	}
+	roomID := c.Param("roomID")
+	if !cc.checkRoomAccess(c, roomID, peer.ID) {
+		return
+	}
+	format := c.DefaultQuery("format", chat.ExportJSON)
+
+	var transcript bytes.Buffer
+	if err := cc.ChatService.Export(roomID, peer.ID, format, &transcript); err != nil {
+		respondChatError(c, err)
+		return
+	}
+	contentType := transcriptTypes[format]
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="chat-%s.%s"`, roomID, contentType[1]))
+	c.Data(http.StatusOK, contentType[0], transcript.Bytes())
+}
+
+// ImportChat creates a room hosted by the authenticated peer holding the
+// messages of a JSON transcript exported by ExportChat. Like for CreateRoom, the
+// request may override the host address and make the room belong to an
+// organization or workspace. It responds with the number of messages kept by
+// the retention policy.
+func (cc *ChatController) ImportChat(c *gin.Context) {
+	host := callerPeer(c)
+	if host == nil {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxTranscriptSize)
+	var request struct {
+		Address     string           `json:"address"`      // Host:Port address of the host peer
+		OrgID       string           `json:"org_id"`       // Organization owning the room, if any
+		WorkspaceID string           `json:"workspace_id"` // Workspace edited in the room, if any
+		Transcript  *chat.Transcript `json:"transcript"`   // Messages to import
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Address != "" {
+		host.Address = request.Address
+	}
+	errs := auth.ValidatePeer(host, true)
+	if request.Transcript == nil {
+		errs.Add("transcript", "transcript is required")
+	} else if err := request.Transcript.Validate(); err != nil {
+		errs.Add("transcript", err.Error())
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, auth.ValidationResponse(errs))
+		return
+	}
+
+	roomID, ok := cc.newRoom(c, host, request.OrgID, request.WorkspaceID)
+	if !ok {
+		return
+	}
+	kept, err := cc.ChatService.Import(roomID, request.Transcript)
+	if err != nil {
+		// The room was only created to hold the transcript
+		cc.TCPTransport.LeaveRoom(roomID, host.ID)
+		respondChatError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room_id": roomID, "messages": kept})
+}
+
+// roomOrg checks the organization and workspace requested for a new room and
+// returns the organization the room belongs to, empty for personal rooms.
+// The organization is deduced from the workspace if omitted.
+// It responds with an error and returns false if the host cannot use them.
+func (cc *ChatController) roomOrg(c *gin.Context, hostID, orgID, workspaceID string) (string, bool) {
+	if orgID == "" && workspaceID == "" {
+		return "", true
+	}
+	if cc.Orgs == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rooms cannot belong to organizations"})
+		return "", false
+	}
+	if workspaceID != "" {
+		workspace, err := auth.CheckWorkspaceAccess(cc.Orgs, workspaceID, hostID)
+		if err != nil {
+			auth.RespondOrgError(c, err)
+			return "", false
+		}
+		if orgID != "" && orgID != workspace.OrgID {
+			c.JSON(http.StatusBadRequest, auth.ValidationResponse(auth.ValidationErrors{"workspace_id": "does not belong to the organization"}))
+			return "", false
+		}
+		return workspace.OrgID, true
+	}
+	if _, err := auth.CheckOrgMember(cc.Orgs, orgID, hostID); err != nil {
+		auth.RespondOrgError(c, err)
+		return "", false
+	}
+	return orgID, true
+}
+
+// canAccess reports whether the peer can see and join the room: personal rooms
+// are open to everyone, rooms of an organization to its members.
+func (cc *ChatController) canAccess(room *network.Room, peerID string) bool {
+	cc.TCPTransport.Mutex.Lock()
+	orgID := room.OrgID
+	cc.TCPTransport.Mutex.Unlock()
+	return cc.orgAccess(orgID, peerID)
+}
+
+// orgAccess reports whether the peer can access the rooms of the organization,
+// always true for personal rooms, whose orgID is empty.
+func (cc *ChatController) orgAccess(orgID, peerID string) bool {
+	if orgID == "" {
+		return true
+	}
+	if cc.Orgs == nil {
+		return false
+	}
+	_, err := auth.CheckOrgMember(cc.Orgs, orgID, peerID)
+	return err == nil
+}
+
+// checkRoomAccess responds with 403 Forbidden and returns false if the room
+// belongs to an organization the peer is not a member of, in case the peer was
+// not removed from its rooms yet. The chat service checks the other cases.
+func (cc *ChatController) checkRoomAccess(c *gin.Context, roomID, peerID string) bool {
+	room, err := cc.TCPTransport.GetRoom(roomID)
+	if err == nil && !cc.canAccess(room, peerID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": auth.ErrNotOrgMember.Error()})
+		return false
+	}
+	return true
+}
+
+// messageRequest returns the authenticated peer and the message ID of a request
+// about a chat message. It responds with an error and returns false if either is
+// missing or the peer cannot access the room.
+func (cc *ChatController) messageRequest(c *gin.Context) (*network.Peer, int, bool) {
+	peer := callerPeer(c)
+	if peer == nil {
+		return nil, 0, false
+	}
+	messageID, err := strconv.Atoi(c.Param("messageID"))
+	if err != nil || messageID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return nil, 0, false
+	}
+	if !cc.checkRoomAccess(c, c.Param("roomID"), peer.ID) {
+		return nil, 0, false
+	}
+	return peer, messageID, true
+}
+
+// respondChatError maps the chat errors to responses.
+func respondChatError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, chat.ErrMessageNotFound), errors.Is(err, chat.ErrConversationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, chat.ErrNotRoomMember), errors.Is(err, chat.ErrNotSender), errors.Is(err, chat.ErrNotHost):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, chat.ErrMessageDeleted), errors.Is(err, chat.ErrTooManyEmojis), errors.Is(err, chat.ErrRoomNotEmpty),
+		errors.Is(err, chat.ErrNotGroup):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, chat.ErrEmptyMessage), errors.Is(err, chat.ErrInvalidEmoji),
+		errors.Is(err, chat.ErrInvalidSnippet), errors.Is(err, chat.ErrNoWorkspace), errors.Is(err, chat.ErrEmptySearch),
+		errors.Is(err, chat.ErrUnknownFormat), errors.Is(err, chat.ErrInvalidTranscript), errors.Is(err, chat.ErrInvalidParticipants):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// callerPeer returns the authenticated peer of the request.
+// It responds with 401 Unauthorized and returns nil if there is none.
+func callerPeer(c *gin.Context) *network.Peer {
+	peer := auth.CurrentPeer(c)
+	if peer == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return nil
+	}
+	copied := *peer
+	return &copied
+}
+
+// bindOptionalJSON binds the request body if there is one.
+func bindOptionalJSON(c *gin.Context, obj interface{}) error {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return nil
+	}
+	if err := c.ShouldBindJSON(obj); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
 }
@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/Rishi-Mishra0704/code-collab-backend/auth"
 	"github.com/Rishi-Mishra0704/code-collab-backend/chat"
 	"github.com/Rishi-Mishra0704/code-collab-backend/network"
 	"github.com/gin-gonic/gin"
@@ -25,8 +26,9 @@ func TestCreateRoom(t *testing.T) {
 	// Create a new Gin router instance
 	router := gin.Default()
 
-	// Define the route for CreateRoom
-	router.POST("/rooms", chatController.CreateRoom)
+	// Define the route for CreateRoom, authenticated as the current caller
+	var caller *network.Peer
+	router.POST("/rooms", func(c *gin.Context) { auth.SetCurrentPeer(c, caller) }, chatController.CreateRoom)
 
 	// Test case 1: Successful room creation
 	t.Run("SuccessfulRoomCreation", func(t *testing.T) {
@@ -38,15 +40,10 @@ func TestCreateRoom(t *testing.T) {
 			Address: "127.0.0.1:8082",
 			Online:  true,
 		}
+		caller = host
 
-		// Marshal the host peer into JSON
-		hostJSON, err := json.Marshal(host)
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		// Create a new HTTP request with the host JSON as the request body
-		req, err := http.NewRequest("POST", "/rooms", bytes.NewBuffer(hostJSON))
+		// Create a new HTTP request without body, the host is the authenticated peer
+		req, err := http.NewRequest("POST", "/rooms", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -72,6 +69,7 @@ func TestCreateRoom(t *testing.T) {
 
 	// Test case 2: Error handling when binding JSON fails
 	t.Run("BindingJSONError", func(t *testing.T) {
+		caller = &network.Peer{ID: "host123", Name: "Host", Email: "host@user.com", Address: "127.0.0.1:8082"}
 		// Create a new HTTP request with an invalid JSON payload
 		req, err := http.NewRequest("POST", "/rooms", bytes.NewBuffer([]byte("invalid JSON")))
 		if err != nil {
@@ -99,14 +97,10 @@ func TestCreateRoom(t *testing.T) {
 
 		// Check if the error is not nil
 		assert.Error(t, err)
+		caller = host
 
-		hostJSON, err := json.Marshal(host)
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		// Create a new HTTP request with the host JSON as the request body
-		req, err := http.NewRequest("POST", "/rooms", bytes.NewBuffer(hostJSON))
+		// Create a new HTTP request without body, the host is the authenticated peer
+		req, err := http.NewRequest("POST", "/rooms", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -119,10 +113,23 @@ func TestCreateRoom(t *testing.T) {
 		router.ServeHTTP(w, req)
 
 		// Check the HTTP status code
-		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
 
-		// Assert that the response body contains the error message
-		assert.Contains(t, w.Body.String(), "host peer must have ID, Name, Email and Address fields")
+		// Assert that the response body reports every invalid field
+		var responseBody struct {
+			Error  string            `json:"error"`
+			Fields map[string]string `json:"fields"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &responseBody); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "validation failed", responseBody.Error)
+		assert.Equal(t, map[string]string{
+			"id":      "is required",
+			"name":    "is required",
+			"email":   "is required",
+			"address": "is required",
+		}, responseBody.Fields)
 	})
 
 }
@@ -147,10 +154,9 @@ func TestSendChatMessage(t *testing.T) {
 		t.Fatalf("failed to create room: %v", err)
 	}
 
-	// Create a request body with sender ID and message
+	// Create a request body with the message, the sender is the authenticated peer
 	requestBody := map[string]string{
-		"sender_id": "sender123",
-		"message":   "Test message",
+		"message": "Test message",
 	}
 	requestBodyBytes, _ := json.Marshal(requestBody)
 
@@ -171,6 +177,7 @@ func TestSendChatMessage(t *testing.T) {
 
 	// Bind request body to context
 	context.Request = req
+	auth.SetCurrentPeer(context, host)
 
 	// Call the controller method
 	chatController.SendChatMessage(context)
@@ -195,3 +202,568 @@ func TestSendChatMessage(t *testing.T) {
 	assert.True(t, ok)
 	assert.NotEmpty(t, chatHistory)
 }
+
+func TestRoomEndpoints_RequireAuthenticatedPeer(t *testing.T) {
+	transport := network.NewTCPTransport()
+	chatController := NewChatController(transport, chat.NewChatService(transport))
+
+	router := gin.New()
+	router.POST("/create-room", chatController.CreateRoom)
+	router.POST("/leave-room/:roomID/:peerID", func(c *gin.Context) {
+		auth.SetCurrentPeer(c, &network.Peer{ID: "guest"})
+	}, chatController.LeaveRoom)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/create-room", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Peers cannot remove someone else from a room
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/leave-room/room1/host", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestJoinRoom_Validation(t *testing.T) {
+	transport := network.NewTCPTransport()
+	chatController := NewChatController(transport, chat.NewChatService(transport))
+	host := &network.Peer{ID: "host123", Name: "Host", Email: "host@user.com", Address: "127.0.0.1:8082"}
+	roomID, err := transport.CreateRoom(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.POST("/join-room/", func(c *gin.Context) {
+		auth.SetCurrentPeer(c, &network.Peer{ID: "guest1", Name: "guest", Email: "guest@user.com"})
+	}, chatController.JoinRoom)
+
+	join := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/join-room/", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := join(`{"room_id": "not-a-room", "address": "localhost"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"room_id":"must be a 16 character hexadecimal room ID"`)
+	assert.Contains(t, w.Body.String(), `"address":"must be a host:port address"`)
+
+	w = join(`{"room_id": "` + roomID + `"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRooms_Organizations(t *testing.T) {
+	transport := network.NewTCPTransport()
+	chatService := chat.NewChatService(transport)
+	chatController := NewChatController(transport, chatService)
+	orgs := auth.NewMemoryOrgStore()
+	chatController.Orgs = orgs
+	assert.NoError(t, orgs.CreateOrg(&auth.Organization{ID: "org1", Name: "acme", Members: map[string]string{"host123": auth.OrgRoleAdmin, "member1": auth.OrgRoleMember}}))
+	assert.NoError(t, orgs.CreateOrg(&auth.Organization{ID: "org2", Name: "other", Members: map[string]string{"outsider1": auth.OrgRoleAdmin}}))
+	assert.NoError(t, orgs.CreateWorkspace(&auth.Workspace{ID: "ws1", OrgID: "org1", Name: "backend"}))
+	assert.NoError(t, orgs.CreateWorkspace(&auth.Workspace{ID: "ws2", OrgID: "org2", Name: "backend"}))
+
+	peers := map[string]*network.Peer{
+		"host123":   {ID: "host123", Name: "Host", Email: "host@user.com", Address: "127.0.0.1:8082"},
+		"member1":   {ID: "member1", Name: "Member", Email: "member@user.com"},
+		"outsider1": {ID: "outsider1", Name: "Outsider", Email: "outsider@user.com"},
+	}
+	var caller *network.Peer
+	router := gin.New()
+	authenticate := func(c *gin.Context) { auth.SetCurrentPeer(c, caller) }
+	router.POST("/create-room", authenticate, chatController.CreateRoom)
+	router.POST("/join-room/", authenticate, chatController.JoinRoom)
+	router.GET("/rooms", authenticate, chatController.GetRooms)
+	perform := func(peerID, method, path, body string) *httptest.ResponseRecorder {
+		caller = peers[peerID]
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Rooms can only be created in the host's organizations and their workspaces
+	w := perform("host123", "POST", "/create-room", `{"org_id": "org2"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = perform("host123", "POST", "/create-room", `{"workspace_id": "ws2"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = perform("host123", "POST", "/create-room", `{"org_id": "org1", "workspace_id": "ws2"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = perform("host123", "POST", "/create-room", `{"workspace_id": "ws1"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var created struct {
+		RoomID string `json:"room_id"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	room, err := transport.GetRoom(created.RoomID)
+	assert.NoError(t, err)
+	assert.Equal(t, "org1", room.OrgID)
+	assert.Equal(t, "ws1", room.WorkspaceID)
+
+	// Only organization members join the room, and see it once they did
+	w = perform("outsider1", "POST", "/join-room/", `{"room_id": "`+created.RoomID+`"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = perform("member1", "GET", "/rooms", "")
+	assert.NotContains(t, w.Body.String(), created.RoomID)
+	w = perform("member1", "POST", "/join-room/", `{"room_id": "`+created.RoomID+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = perform("member1", "GET", "/rooms", "")
+	assert.Contains(t, w.Body.String(), created.RoomID)
+	assert.NoError(t, transport.SetRoomVisibility(created.RoomID, true))
+	w = perform("outsider1", "GET", "/rooms", "")
+	assert.NotContains(t, w.Body.String(), created.RoomID)
+
+	// Personal rooms are listed to everyone once public, without their chat
+	// nor the contact details of their peers
+	w = perform("host123", "POST", "/create-room", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NoError(t, chatService.Send(created.RoomID, peers["host123"], "secret"))
+	w = perform("outsider1", "GET", "/rooms", "")
+	assert.NotContains(t, w.Body.String(), created.RoomID)
+	assert.NoError(t, transport.SetRoomVisibility(created.RoomID, true))
+	w = perform("outsider1", "GET", "/rooms", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var listed struct {
+		Rooms map[string]*RoomInfo `json:"rooms"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	assert.Equal(t, &RoomInfo{ID: created.RoomID, HostID: "host123", Peers: []RoomPeer{{ID: "host123", Name: "Host"}}, Public: true}, listed.Rooms[created.RoomID])
+	assert.NotContains(t, w.Body.String(), "secret")
+	assert.NotContains(t, w.Body.String(), "host@user.com")
+}
+
+func TestGetChatHistory_Query(t *testing.T) {
+	transport := network.NewTCPTransport()
+	chatService := chat.NewChatService(transport)
+	chatController := NewChatController(transport, chatService)
+	host := &network.Peer{ID: "host123", Name: "Host", Email: "host@user.com", Address: "127.0.0.1:8082"}
+	roomID, err := transport.CreateRoom(host)
+	assert.NoError(t, err)
+	for _, message := range []string{"one", "two", "three"} {
+		assert.NoError(t, chatService.Send(roomID, host, message))
+	}
+
+	router := gin.New()
+	router.GET("/rooms/:roomID/chats", func(c *gin.Context) { auth.SetCurrentPeer(c, host) }, chatController.GetChatHistory)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/rooms/"+roomID+"/chats"+query, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("?before=3&limit=1&sender=host123")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page struct {
+		ChatHistory []network.ChatMessage `json:"chat_history"`
+		HasMore     bool                  `json:"has_more"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	if assert.Len(t, page.ChatHistory, 1) {
+		assert.Equal(t, 2, page.ChatHistory[0].ID)
+		assert.Equal(t, "two", page.ChatHistory[0].Body)
+	}
+	assert.True(t, page.HasMore)
+
+	w = get("?limit=1000&after=x&since=yesterday")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"limit":"must be a number between 1 and 200"`)
+	assert.Contains(t, w.Body.String(), `"after":"must be a message ID"`)
+	assert.Contains(t, w.Body.String(), `"since":"must be an RFC 3339 time"`)
+
+	w = get("?before=3&after=1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestChatRooms_MembersOnly(t *testing.T) {
+	transport := network.NewTCPTransport()
+	chatService := chat.NewChatService(transport)
+	chatController := NewChatController(transport, chatService)
+	orgs := auth.NewMemoryOrgStore()
+	chatController.Orgs = orgs
+	assert.NoError(t, orgs.CreateOrg(&auth.Organization{ID: "org1", Name: "acme", Members: map[string]string{"host123": auth.OrgRoleAdmin, "member1": auth.OrgRoleMember}}))
+	host := &network.Peer{ID: "host123", Name: "Host", Email: "host@user.com", Address: "127.0.0.1:8082"}
+	member := &network.Peer{ID: "member1", Name: "Member", Email: "member@user.com"}
+	stranger := &network.Peer{ID: "stranger1", Name: "Stranger", Email: "stranger@user.com"}
+	roomID, err := transport.CreateRoom(host)
+	assert.NoError(t, err)
+	assert.NoError(t, chatService.Send(roomID, host, "secret"))
+
+	var caller *network.Peer
+	router := gin.New()
+	authenticate := func(c *gin.Context) { auth.SetCurrentPeer(c, caller) }
+	router.GET("/rooms/:roomID/chats", authenticate, chatController.GetChatHistory)
+	router.POST("/rooms/:roomID/send-message", authenticate, chatController.SendChatMessage)
+	router.GET("/rooms/:roomID/messages/:messageID/thread", authenticate, chatController.GetChatThread)
+	perform := func(peer *network.Peer, method, path, body string) *httptest.ResponseRecorder {
+		caller = peer
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/rooms/"+roomID+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Peers outside the room can neither read nor post
+	w := perform(stranger, "GET", "/chats", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+	w = perform(stranger, "POST", "/send-message", `{"message": "hi"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = perform(stranger, "GET", "/messages/1/thread", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = perform(host, "GET", "/chats", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "secret")
+
+	// Peers removed from the organization of a room lose access to it
+	assert.NoError(t, transport.SetRoomOrg(roomID, "org1", ""))
+	assert.NoError(t, transport.JoinRoom(roomID, member))
+	w = perform(member, "GET", "/chats", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, err = orgs.UpdateOrg("org1", func(org *auth.Organization) error {
+		delete(org.Members, "member1")
+		return nil
+	})
+	assert.NoError(t, err)
+	w = perform(member, "GET", "/chats", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = perform(member, "POST", "/send-message", `{"message": "hi"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestChatMessageEndpoints(t *testing.T) {
+	transport := network.NewTCPTransport()
+	chatService := chat.NewChatService(transport)
+	chatController := NewChatController(transport, chatService)
+	host := &network.Peer{ID: "host123", Name: "Host", Email: "host@user.com", Address: "127.0.0.1:8082"}
+	guest := &network.Peer{ID: "guest1", Name: "Guest", Email: "guest@user.com"}
+	roomID, err := transport.CreateRoom(host)
+	assert.NoError(t, err)
+	assert.NoError(t, transport.JoinRoom(roomID, guest))
+	assert.NoError(t, chatService.Send(roomID, guest, "helo"))
+
+	var caller *network.Peer
+	router := gin.New()
+	authenticate := func(c *gin.Context) { auth.SetCurrentPeer(c, caller) }
+	router.PATCH("/rooms/:roomID/messages/:messageID", authenticate, chatController.EditChatMessage)
+	router.DELETE("/rooms/:roomID/messages/:messageID", authenticate, chatController.DeleteChatMessage)
+	router.POST("/rooms/:roomID/messages/:messageID/reactions", authenticate, chatController.ReactToChatMessage)
+	perform := func(peer *network.Peer, method, path, body string) *httptest.ResponseRecorder {
+		caller = peer
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/rooms/"+roomID+"/messages/"+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := perform(host, "PATCH", "1", `{"message": "hello"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = perform(guest, "PATCH", "x", `{"message": "hello"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = perform(guest, "PATCH", "2", `{"message": "hello"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = perform(guest, "PATCH", "1", `{"message": "hello"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"body":"hello"`)
+	assert.Contains(t, w.Body.String(), `"edited_at"`)
+
+	w = perform(host, "POST", "1/reactions", `{"emoji": "nope"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = perform(host, "POST", "1/reactions", `{"emoji": "🎉"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"reactions":{"🎉":["host123"]}`)
+
+	w = perform(host, "DELETE", "1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"deleted_by":"host123"`)
+	w = perform(guest, "DELETE", "1", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestChatThreads(t *testing.T) {
+	transport := network.NewTCPTransport()
+	chatService := chat.NewChatService(transport)
+	chatController := NewChatController(transport, chatService)
+	host := &network.Peer{ID: "host123", Name: "Host", Email: "host@user.com", Address: "127.0.0.1:8082"}
+	roomID, err := transport.CreateRoom(host)
+	assert.NoError(t, err)
+	assert.NoError(t, chatService.Send(roomID, host, "bug report"))
+
+	router := gin.New()
+	authenticate := func(c *gin.Context) { auth.SetCurrentPeer(c, host) }
+	router.POST("/rooms/:roomID/send-message", authenticate, chatController.SendChatMessage)
+	router.GET("/rooms/:roomID/messages/:messageID/thread", authenticate, chatController.GetChatThread)
+	perform := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/rooms/"+roomID+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := perform("POST", "/send-message", `{"message": "reproduced", "parent_id": 1}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = perform("POST", "/send-message", `{"message": "lost", "parent_id": 7}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = perform("GET", "/messages/1/thread", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var thread struct {
+		Parent      network.ChatMessage   `json:"parent"`
+		ChatHistory []network.ChatMessage `json:"chat_history"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &thread))
+	assert.Equal(t, "bug report", thread.Parent.Body)
+	if assert.NotNil(t, thread.Parent.Thread) {
+		assert.Equal(t, 1, thread.Parent.Thread.Replies)
+	}
+	if assert.Len(t, thread.ChatHistory, 1) {
+		assert.Equal(t, "reproduced", thread.ChatHistory[0].Body)
+	}
+
+	w = perform("GET", "/messages/7/thread", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestUnreadCounts(t *testing.T) {
+	transport := network.NewTCPTransport()
+	chatService := chat.NewChatService(transport)
+	chatController := NewChatController(transport, chatService)
+	host := &network.Peer{ID: "host123", Name: "Host", Email: "host@user.com", Address: "127.0.0.1:8082"}
+	guest := &network.Peer{ID: "guest1", Name: "Guest", Email: "guest@user.com"}
+	roomID, err := transport.CreateRoom(host)
+	assert.NoError(t, err)
+	assert.NoError(t, transport.JoinRoom(roomID, guest))
+	assert.NoError(t, chatService.Send(roomID, host, "hello @guest"))
+	assert.NoError(t, chatService.Send(roomID, host, "anyone?"))
+
+	router := gin.New()
+	authenticate := func(c *gin.Context) { auth.SetCurrentPeer(c, guest) }
+	router.POST("/rooms/:roomID/read", authenticate, chatController.MarkChatRead)
+	router.GET("/chats/unread", authenticate, chatController.GetUnreadCounts)
+	perform := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := perform("GET", "/chats/unread", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"unread":2`)
+	assert.Contains(t, w.Body.String(), `"mentions":1`)
+
+	w = perform("POST", "/rooms/"+roomID+"/read", `{"message_id": 1}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"last_read_id":1`)
+	w = perform("GET", "/chats/unread", "")
+	assert.Contains(t, w.Body.String(), `"unread":1`)
+	assert.Contains(t, w.Body.String(), `"mentions":0`)
+
+	w = perform("POST", "/rooms/"+roomID+"/read", `{"message_id": 9}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = perform("POST", "/rooms/"+roomID+"/read", "")
+	assert.Contains(t, w.Body.String(), `"last_read_id":2`)
+}
+
+func TestSendChatMessage_Snippet(t *testing.T) {
+	transport := network.NewTCPTransport()
+	chatService := chat.NewChatService(transport)
+	chatController := NewChatController(transport, chatService)
+	host := &network.Peer{ID: "host123", Name: "Host", Email: "host@user.com", Address: "127.0.0.1:8082"}
+	roomID, err := transport.CreateRoom(host)
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/rooms/:roomID/send-message", func(c *gin.Context) { auth.SetCurrentPeer(c, host) }, chatController.SendChatMessage)
+	send := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/rooms/"+roomID+"/send-message", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(`{"message": "the fix", "snippet": {"language": "go", "code": "return nil"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	history, err := chatService.Receive(roomID)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, network.ChatMessageCode, history[0].Kind)
+		assert.Equal(t, "return nil", history[0].Snippet.Code)
+	}
+
+	// Personal rooms have no workspace files to reference
+	w = send(`{"snippet": {"language": "go", "code": "return nil", "path": "main.go", "start_line": 1, "end_line": 1}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = send(`{"snippet": {"language": "", "code": "return nil"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSearchChat(t *testing.T) {
+	transport := network.NewTCPTransport()
+	chatService := chat.NewChatService(transport)
+	chatController := NewChatController(transport, chatService)
+	host := &network.Peer{ID: "host123", Name: "Host", Email: "host@user.com", Address: "127.0.0.1:8082"}
+	roomID, err := transport.CreateRoom(host)
+	assert.NoError(t, err)
+	assert.NoError(t, chatService.Send(roomID, host, "run make lint first"))
+
+	router := gin.New()
+	router.GET("/chats/search", func(c *gin.Context) { auth.SetCurrentPeer(c, host) }, chatController.SearchChat)
+	search := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/chats/search?"+query, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := search(`q=%22make+lint%22&room_id=` + roomID)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"body":"run make lint first"`)
+	w = search(`q=deploy`)
+	assert.JSONEq(t, `{"results": []}`, w.Body.String())
+
+	w = search(`q=`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = search(`q=lint&limit=500`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExportImportChat(t *testing.T) {
+	transport := network.NewTCPTransport()
+	chatService := chat.NewChatService(transport)
+	chatController := NewChatController(transport, chatService)
+	host := &network.Peer{ID: "host123", Name: "Host", Email: "host@user.com", Address: "127.0.0.1:8082"}
+	roomID, err := transport.CreateRoom(host)
+	assert.NoError(t, err)
+	assert.NoError(t, chatService.Send(roomID, host, "hello"))
+
+	router := gin.New()
+	authenticate := func(c *gin.Context) { auth.SetCurrentPeer(c, host) }
+	router.GET("/rooms/:roomID/export", authenticate, chatController.ExportChat)
+	router.POST("/rooms/import", authenticate, chatController.ImportChat)
+	export := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/rooms/"+roomID+"/export"+query, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := export("?format=text")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="chat-`+roomID+`.txt"`, w.Header().Get("Content-Disposition"))
+	assert.Contains(t, w.Body.String(), "] Host: hello\n")
+	assert.Equal(t, http.StatusBadRequest, export("?format=pdf").Code)
+
+	w = export("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := fmt.Sprintf(`{"transcript": %s}`, w.Body.String())
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/rooms/import", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		RoomID   string `json:"room_id"`
+		Messages int    `json:"messages"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotEqual(t, roomID, response.RoomID)
+	assert.Equal(t, 1, response.Messages)
+	room, err := transport.GetRoom(response.RoomID)
+	if assert.NoError(t, err) && assert.Len(t, room.Chat, 1) {
+		assert.Equal(t, "hello", room.Chat[0].Body)
+		assert.Equal(t, "host123", room.Host.ID)
+	}
+
+	// Only the messages kept by the retention policy are counted
+	body = `{"transcript": {"version": 1, "messages": [
+		{"id": 1, "sender": {"id": "host123"}, "sent_at": "2020-01-01T00:00:00Z", "body": "old", "kind": "text"},
+		{"id": 2, "sender": {"id": "host123"}, "sent_at": "2020-01-02T00:00:00Z", "body": "older", "kind": "text"}
+	]}}`
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/rooms/import", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.Messages)
+
+	// Invalid transcripts create no room
+	rooms := len(transport.GetAllRooms())
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/rooms/import", bytes.NewBufferString(`{"transcript": {"version": 7}}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Len(t, transport.GetAllRooms(), rooms)
+}
+
+func TestDirectConversations(t *testing.T) {
+	transport := network.NewTCPTransport()
+	chatService := chat.NewChatService(transport)
+	chatController := NewChatController(transport, chatService)
+	users := auth.NewMemoryUserStore()
+	chatController.Users = users
+	alice := &auth.User{ID: "alice1", Name: "alice", Email: "alice@user.com"}
+	bob := &auth.User{ID: "bob1", Name: "bob", Email: "bob@user.com"}
+	assert.NoError(t, users.Create(alice))
+	assert.NoError(t, users.Create(bob))
+
+	caller := alice.Peer()
+	router := gin.New()
+	authenticate := func(c *gin.Context) { auth.SetCurrentPeer(c, caller) }
+	router.POST("/direct", authenticate, chatController.StartDirectConversation)
+	router.GET("/direct", authenticate, chatController.GetDirectConversations)
+	router.POST("/rooms/:roomID/send-message", authenticate, chatController.SendChatMessage)
+	router.GET("/rooms/:roomID/chats", authenticate, chatController.GetChatHistory)
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("POST", "/direct", `{"peer_ids": ["bob1"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Conversation chat.DirectConversation `json:"conversation"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	conversationID := response.Conversation.ID
+	assert.Len(t, response.Conversation.Participants, 2)
+
+	w = send("POST", "/rooms/"+conversationID+"/send-message", `{"message": "ping"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = send("GET", "/rooms/"+conversationID+"/chats", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"body":"ping"`)
+	w = send("GET", "/direct", "")
+	assert.Contains(t, w.Body.String(), `"id":"`+conversationID+`"`)
+
+	// Only the participants can access the conversation
+	caller = &network.Peer{ID: "eve1", Name: "eve"}
+	w = send("GET", "/rooms/"+conversationID+"/chats", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = send("POST", "/rooms/"+conversationID+"/send-message", `{"message": "hi"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = send("GET", "/direct", "")
+	assert.JSONEq(t, `{"conversations": []}`, w.Body.String())
+
+	w = send("POST", "/direct", `{"peer_ids": ["nobody"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = send("POST", "/direct", `{"peer_ids": []}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// DiscoveryController represents the controller for LAN discovery endpoints.
+type DiscoveryController struct {
+	Discovery *network.Discovery // Reference to the Discovery instance
+}
+
+// NewDiscoveryController creates a new instance of DiscoveryController.
+func NewDiscoveryController(discovery *network.Discovery) *DiscoveryController {
+	return &DiscoveryController{
+		Discovery: discovery,
+	}
+}
+
+// GetNodes returns the backend nodes discovered on the local network and their public rooms.
+func (dc *DiscoveryController) GetNodes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"node_id": dc.Discovery.NodeID, "nodes": dc.Discovery.Nodes()})
+}
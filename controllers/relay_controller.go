@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// RelayController represents the controller for the relay endpoints.
+type RelayController struct {
+	TCPTransport *network.TCPTransport // Reference to the TCPTransport instance acting as a relay
+}
+
+// NewRelayController creates a new instance of RelayController.
+func NewRelayController(transport *network.TCPTransport) *RelayController {
+	return &RelayController{
+		TCPTransport: transport,
+	}
+}
+
+// GetTraffic returns the traffic forwarded by the relay, per route.
+func (rc *RelayController) GetTraffic(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"routes": rc.TCPTransport.RelayTraffic()})
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/Rishi-Mishra0704/code-collab-backend/auth"
 	"github.com/Rishi-Mishra0704/code-collab-backend/console"
 	"github.com/gorilla/websocket"
 )
@@ -26,6 +27,8 @@ func ExecuteCommand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer conn.Close()
+	// Disconnect as soon as the session is revoked
+	auth.CloseOnRevoke(r, conn)
 
 	for {
 		// Read message from client
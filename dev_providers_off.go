@@ -0,0 +1,9 @@
+//go:build !devauth
+
+package main
+
+import "github.com/Rishi-Mishra0704/code-collab-backend/auth"
+
+// registerDevProviders registers no provider: the fake provider of development
+// builds is left out unless built with the devauth build tag.
+func registerDevProviders(authService *auth.AuthService) {}
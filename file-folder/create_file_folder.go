@@ -8,12 +8,13 @@ import (
 )
 
 // CreateFileOrFolder handles HTTP requests to create a file or folder.
-// It accepts a POST request with a JSON body containing the path and type of file/folder to be created.
+// It accepts a POST request with a JSON body containing the workspace, path and type of file/folder to be created.
 // The request body should have the following structure:
 //
 //	{
-//	    "path": "string",     // Path to the file or folder to be created
-//	    "isFolder": "bool"    // Indicates whether the request is to create a folder
+//	    "workspace_id": "string", // Workspace the file or folder belongs to
+//	    "path": "string",         // Path to the file or folder to be created, relative to the workspace
+//	    "isFolder": "bool"        // Indicates whether the request is to create a folder
 //	}
 //
 // If 'isFolder' is true, it will create a folder at the specified path.
@@ -21,11 +22,12 @@ import (
 // Upon successful creation, it returns a JSON response with HTTP status 201 (Created) and a success message.
 // In case of any errors during the creation process, it returns a JSON response with HTTP status 500 (Internal Server Error)
 // and an error message.
-func CreateFileOrFolder(c *gin.Context) {
+func (fs *FileService) CreateFileOrFolder(c *gin.Context) {
 	// Define a struct to hold request parameters.
 	var req struct {
-		Path     string `json:"path"`     // Path to the file or folder to be created
-		IsFolder bool   `json:"isFolder"` // Indicates whether the request is to create a folder
+		WorkspaceID string `json:"workspace_id"` // Workspace the file or folder belongs to
+		Path        string `json:"path"`         // Path to the file or folder to be created
+		IsFolder    bool   `json:"isFolder"`     // Indicates whether the request is to create a folder
 	}
 
 	// Bind request body to the req struct.
@@ -33,16 +35,20 @@ func CreateFileOrFolder(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	path, ok := fs.resolve(c, req.WorkspaceID, req.Path)
+	if !ok {
+		return
+	}
 
 	// Declare an error variable.
 	var err error
 
 	// If IsFolder is true, create a folder with the specified path.
 	if req.IsFolder {
-		err = os.MkdirAll(req.Path, 0755)
+		err = os.MkdirAll(path, 0755)
 	} else {
 		// If IsFolder is false, create a file with the specified path.
-		_, err = os.Create(req.Path)
+		_, err = os.Create(path)
 	}
 
 	// If an error occurred during file or folder creation, return an internal server error response.
@@ -13,7 +13,8 @@ import (
 // The request body should have the following structure:
 //
 //	{
-//	    "path": "string"  // Path to the directory whose files or folders are to be listed
+//	    "workspace_id": "string", // Workspace the directory belongs to
+//	    "path": "string"          // Path to the directory whose files or folders are to be listed, relative to the workspace
 //	}
 //
 // Upon receiving the request, it reads the contents of the specified directory and returns a JSON response with HTTP status 200 (OK)
@@ -21,10 +22,11 @@ import (
 // 'name' represents the name of the file or folder, and 'type' indicates whether it is a file or a folder.
 // In case of any errors during the process, it returns a JSON response with HTTP status 500 (Internal Server Error)
 // and an error message.
-func ListFilesOrFolder(c *gin.Context) {
+func (fs *FileService) ListFilesOrFolder(c *gin.Context) {
 	// Define a struct to hold request parameters.
 	var req struct {
-		Path string `json:"path"` // Path to the directory whose files or folders are to be listed
+		WorkspaceID string `json:"workspace_id"` // Workspace the directory belongs to
+		Path        string `json:"path"`         // Path to the directory whose files or folders are to be listed
 	}
 
 	// Bind request body to the req struct.
@@ -35,9 +37,13 @@ func ListFilesOrFolder(c *gin.Context) {
 
 	// Log the received path for debugging.
 	fmt.Println("Received path:", req.Path)
+	path, ok := fs.resolve(c, req.WorkspaceID, req.Path)
+	if !ok {
+		return
+	}
 
 	// Read directory contents.
-	files, err := os.ReadDir(req.Path)
+	files, err := os.ReadDir(path)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
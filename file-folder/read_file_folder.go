@@ -12,17 +12,19 @@ import (
 // The request body should have the following structure:
 //
 //	{
-//	    "path": "string"  // Path to the file whose content is to be read
+//	    "workspace_id": "string", // Workspace the file belongs to
+//	    "path": "string"          // Path to the file whose content is to be read, relative to the workspace
 //	}
 //
 // Upon receiving the request, it reads the content of the specified file and returns a JSON response with HTTP status 200 (OK)
 // containing the content of the file as a string.
 // In case of any errors during the process, it returns a JSON response with HTTP status 500 (Internal Server Error)
 // along with an error message providing details of the encountered error.
-func ReadFileContent(c *gin.Context) {
+func (fs *FileService) ReadFileContent(c *gin.Context) {
 	// Define a struct to hold request parameters.
 	var req struct {
-		Path string `json:"path"` // Path to the file whose content is to be read
+		WorkspaceID string `json:"workspace_id"` // Workspace the file belongs to
+		Path        string `json:"path"`         // Path to the file whose content is to be read
 	}
 
 	// Bind request body to the req struct.
@@ -30,9 +32,13 @@ func ReadFileContent(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	path, ok := fs.resolve(c, req.WorkspaceID, req.Path)
+	if !ok {
+		return
+	}
 
 	// Read the content of the file.
-	fileContent, err := os.ReadFile(req.Path)
+	fileContent, err := os.ReadFile(path)
 	if err != nil {
 		// If an error occurred while reading the file, return an internal server error response.
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading file content", "detail": err.Error()})
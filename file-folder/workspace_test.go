@@ -0,0 +1,85 @@
+package filefolder
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/auth"
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+func TestFileService_Workspaces(t *testing.T) {
+	orgs := auth.NewMemoryOrgStore()
+	assert.NoError(t, orgs.CreateOrg(&auth.Organization{ID: "org1", Name: "acme", Members: map[string]string{"member1": auth.OrgRoleMember}}))
+	assert.NoError(t, orgs.CreateWorkspace(&auth.Workspace{ID: "ws1", OrgID: "org1", Name: "backend"}))
+	root := t.TempDir()
+	service := NewFileService(root, orgs)
+
+	var caller *network.Peer
+	router := gin.New()
+	authenticate := func(c *gin.Context) { auth.SetCurrentPeer(c, caller) }
+	router.POST("/create", authenticate, service.CreateFileOrFolder)
+	router.POST("/list", authenticate, service.ListFilesOrFolder)
+	router.POST("/read", authenticate, service.ReadFileContent)
+	perform := func(peerID, path, body string) *httptest.ResponseRecorder {
+		caller = &network.Peer{ID: peerID}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Members work inside the workspace directory
+	w := perform("member1", "/create", `{"workspace_id": "ws1", "path": "src", "isFolder": true}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "ws1", "src", "main.go"), []byte("package main"), 0644))
+	w = perform("member1", "/list", `{"workspace_id": "ws1", "path": "src"}`)
+	assert.JSONEq(t, `{"files": [{"name": "main.go", "type": "file"}]}`, w.Body.String())
+	w = perform("member1", "/read", `{"workspace_id": "ws1", "path": "/src/main.go"}`)
+	assert.JSONEq(t, `{"content": "package main"}`, w.Body.String())
+
+	// Paths cannot leave the workspace
+	w = perform("member1", "/create", `{"workspace_id": "ws1", "path": "../../escaped"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.FileExists(t, filepath.Join(root, "ws1", "escaped"))
+	assert.NoFileExists(t, filepath.Join(filepath.Dir(root), "escaped"))
+
+	// Other users and unknown workspaces are rejected
+	w = perform("outsider1", "/read", `{"workspace_id": "ws1", "path": "src/main.go"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = perform("member1", "/list", `{"workspace_id": "missing", "path": ""}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestFileService_Lines(t *testing.T) {
+	orgs := auth.NewMemoryOrgStore()
+	assert.NoError(t, orgs.CreateOrg(&auth.Organization{ID: "org1", Name: "acme", Members: map[string]string{"member1": auth.OrgRoleMember}}))
+	assert.NoError(t, orgs.CreateWorkspace(&auth.Workspace{ID: "ws1", OrgID: "org1", Name: "backend"}))
+	root := t.TempDir()
+	service := NewFileService(root, orgs)
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "ws1", "src"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "ws1", "src", "main.go"), []byte("package main\n\nfunc main() {}"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "ws1", "go.mod"), []byte("module example\n"), 0644))
+
+	lines, err := service.Lines("ws1", "src/main.go")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, lines)
+	lines, err = service.Lines("ws1", "../go.mod")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, lines)
+
+	_, err = service.Lines("ws1", "src")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = service.Lines("ws1", "src/other.go")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = service.Lines("missing", "go.mod")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"crypto/rand"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/Rishi-Mishra0704/code-collab-backend/auth"
 	"github.com/Rishi-Mishra0704/code-collab-backend/chat"
 	"github.com/Rishi-Mishra0704/code-collab-backend/collab"
 	"github.com/Rishi-Mishra0704/code-collab-backend/compiler"
 	"github.com/Rishi-Mishra0704/code-collab-backend/controllers"
 	filefolder "github.com/Rishi-Mishra0704/code-collab-backend/file-folder"
 	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+	"github.com/Rishi-Mishra0704/code-collab-backend/ratelimit"
+	"github.com/Rishi-Mishra0704/code-collab-backend/signaling"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/handlers"
@@ -19,26 +27,165 @@ func main() {
 	// Initialize TCP transport
 	transport := network.NewTCPTransport()
 	chatService := chat.NewChatService(transport)
+	authService := auth.NewAuthService(auth.NewMemoryUserStore(), auth.NewTokenIssuer(jwtSecret()))
+	configureMail(authService)
+	signalingServer := signaling.NewServer(transport)
 
 	// Initialize ChatController with ChatService
 	chatController := controllers.NewChatController(transport, chatService)
+	chatController.Orgs = authService.Orgs
+	chatController.Users = authService.Users
+	fileService := filefolder.NewFileService(workspaceRoot(), authService.Orgs)
+	chatService.Files = fileService
+	authService.OnOrgMemberRemoved = func(orgID, userID string) {
+		transport.LeaveOrgRooms(orgID, userID)
+		chatService.PruneSubscriptions()
+	}
+
+	// Gossip membership is optional, for multi-node deployments
+	if address := os.Getenv("GOSSIP_ADDRESS"); address != "" {
+		membership := network.NewMembership(address, transport, strings.Split(os.Getenv("GOSSIP_SEEDS"), ","))
+		membership.OnChange = func(member network.Member) {
+			transport.ApplyMemberState(member)
+			// Peers of dead members were removed from their rooms
+			chatService.PruneSubscriptions()
+		}
+
+		// Act as a relay for peers that cannot reach each other directly.
+		// Nodes prove they belong to the cluster with the shared relay secret.
+		transport.RelayEnabled = os.Getenv("RELAY_ENABLED") == "true"
+		transport.RelaySecret = []byte(os.Getenv("RELAY_SECRET"))
+		transport.IsMember = membership.Knows
+		relay := os.Getenv("RELAY_ADDRESS")
+		if (transport.RelayEnabled || relay != "") && len(transport.RelaySecret) == 0 {
+			log.Fatal("RELAY_SECRET must be set to act as a relay or to connect to one")
+		}
+		if err := transport.Listen(address); err != nil {
+			log.Fatalf("Failed to start node transport: %v", err)
+		}
+		defer transport.Close()
+
+		if relay != "" {
+			if err := transport.ConnectRelay(relay, address); err != nil {
+				log.Fatalf("Failed to connect to relay: %v", err)
+			}
+		}
+
+		// The node messages are dispatched to the layers by type
+		router := network.NewRouter(transport)
+		router.Handle(network.MessageGossip, membership.HandleMessage)
+		go router.Run(make(chan struct{}))
+		go membership.Run(make(chan struct{}))
+	}
 
 	// Initialize Gin router for REST API
 	apiRouter := gin.Default()
-	apiRouter.Use(cors.Default())
+	// The rate limiters rely on the client IP, only taken from headers set by trusted proxies
+	if err := apiRouter.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowAllOrigins = true
+	corsConfig.AddAllowHeaders("Authorization")
+	apiRouter.Use(cors.New(corsConfig))
+
+	// Authentication
+	apiRouter.POST("/signup", authService.SignupHandler)
+	// Failed logins are also throttled per account by the handlers
+	loginLimiter := ratelimit.Middleware(ratelimit.NewLimiter(10, time.Minute, 10), ratelimit.ClientIP)
+	apiRouter.POST("/login", loginLimiter, authService.LoginHandler)
+	apiRouter.POST("/login/2fa", loginLimiter, authService.LoginTwoFactorHandler)
+	apiRouter.POST("/refresh", authService.RefreshHandler)
+	// Account recovery. The endpoints sending emails are limited per IP, so the
+	// mailer cannot be used to flood an address.
+	mailLimiter := ratelimit.Middleware(ratelimit.NewLimiter(5, 15*time.Minute, 3), ratelimit.ClientIP)
+	apiRouter.POST("/verify-email", authService.VerifyEmailHandler)
+	apiRouter.POST("/forgot-password", mailLimiter, authService.ForgotPasswordHandler)
+	apiRouter.POST("/reset-password", authService.ResetPasswordHandler)
+	// Login with an external identity provider
+	apiRouter.GET("/auth/:provider/login", authService.ProviderLoginHandler)
+	apiRouter.GET("/auth/:provider/callback", authService.ProviderCallbackHandler)
+	registerIdentityProviders(authService)
+
+	// Endpoints below require an access token or an API token with the right scope
+	authorized := apiRouter.Group("/", authService.Middleware())
+
+	// Session management
+	sessions := authorized.Group("/", auth.RequireSession())
+	sessions.GET("/sessions", authService.ListSessionsHandler)
+	sessions.DELETE("/sessions/:sessionID", authService.RevokeSessionHandler)
+	sessions.DELETE("/sessions", authService.RevokeAllSessionsHandler)
+	sessions.POST("/resend-verification", mailLimiter, authService.ResendVerificationHandler)
+	// Two-factor authentication
+	sessions.POST("/2fa/enroll", authService.EnrollTOTPHandler)
+	sessions.POST("/2fa/confirm", authService.ConfirmTOTPHandler)
+	sessions.POST("/2fa/disable", authService.DisableTwoFactorHandler)
+	sessions.POST("/2fa/recovery-codes", authService.RegenerateRecoveryCodesHandler)
+	// Personal API tokens
+	sessions.POST("/tokens", authService.CreateAPITokenHandler)
+	sessions.GET("/tokens", authService.ListAPITokensHandler)
+	sessions.DELETE("/tokens/:tokenID", authService.RevokeAPITokenHandler)
+
+	// Traffic forwarded by this node, when it acts as a relay
+	if transport.RelayEnabled {
+		relayController := controllers.NewRelayController(transport)
+		sessions.GET("/relay/traffic", relayController.GetTraffic)
+	}
+
 	// Define API endpoints using the ChatController methods
 
 	// Room operations
-	apiRouter.GET("/rooms", chatController.GetRooms)
-	apiRouter.POST("/create-room", chatController.CreateRoom)
-	apiRouter.POST("/join-room/", chatController.JoinRoom)
-	apiRouter.POST("/leave-room/:roomID/:peerID", chatController.LeaveRoom)
-	apiRouter.POST("/rooms/:roomID/send-message", chatController.SendChatMessage)
-	apiRouter.GET("/rooms/:roomID/chats", chatController.GetChatHistory)
-	// File and folder operations
-	apiRouter.POST("create", filefolder.CreateFileOrFolder)
-	apiRouter.POST("list", filefolder.ListFilesOrFolder)
-	apiRouter.POST("read", filefolder.ReadFileContent)
+	authorized.GET("/rooms", auth.RequireScope(auth.ScopeRoomsRead), chatController.GetRooms)
+	authorized.POST("/create-room", auth.RequireScope(auth.ScopeRoomsWrite), ratelimit.Middleware(ratelimit.NewLimiter(10, time.Minute, 5), auth.RateLimitKey), chatController.CreateRoom)
+	authorized.POST("/join-room/", auth.RequireScope(auth.ScopeRoomsWrite), chatController.JoinRoom)
+	authorized.POST("/leave-room/:roomID/:peerID", auth.RequireScope(auth.ScopeRoomsWrite), chatController.LeaveRoom)
+	authorized.POST("/rooms/:roomID/send-message", auth.RequireScope(auth.ScopeChatWrite), chatController.SendChatMessage)
+	authorized.GET("/rooms/:roomID/chats", auth.RequireScope(auth.ScopeChatRead), chatController.GetChatHistory)
+	authorized.GET("/rooms/:roomID/messages/:messageID/thread", auth.RequireScope(auth.ScopeChatRead), chatController.GetChatThread)
+	authorized.POST("/rooms/:roomID/read", auth.RequireScope(auth.ScopeChatRead), chatController.MarkChatRead)
+	authorized.GET("/chats/unread", auth.RequireScope(auth.ScopeChatRead), chatController.GetUnreadCounts)
+	authorized.GET("/chats/search", auth.RequireScope(auth.ScopeChatRead), chatController.SearchChat)
+	authorized.POST("/direct", auth.RequireScope(auth.ScopeChatWrite), chatController.StartDirectConversation)
+	authorized.GET("/direct", auth.RequireScope(auth.ScopeChatRead), chatController.GetDirectConversations)
+	authorized.POST("/direct/:conversationID/leave", auth.RequireScope(auth.ScopeChatWrite), chatController.LeaveDirectConversation)
+	authorized.GET("/rooms/:roomID/export", auth.RequireScope(auth.ScopeChatRead), chatController.ExportChat)
+	authorized.POST("/rooms/import", auth.RequireScope(auth.ScopeRoomsWrite), auth.RequireScope(auth.ScopeChatWrite), chatController.ImportChat)
+	authorized.PATCH("/rooms/:roomID/messages/:messageID", auth.RequireScope(auth.ScopeChatWrite), chatController.EditChatMessage)
+	authorized.DELETE("/rooms/:roomID/messages/:messageID", auth.RequireScope(auth.ScopeChatWrite), chatController.DeleteChatMessage)
+	authorized.POST("/rooms/:roomID/messages/:messageID/reactions", auth.RequireScope(auth.ScopeChatWrite), chatController.ReactToChatMessage)
+	// File and folder operations, in the workspaces of the caller's organizations
+	authorized.POST("create", auth.RequireScope(auth.ScopeFilesWrite), fileService.CreateFileOrFolder)
+	authorized.POST("list", auth.RequireScope(auth.ScopeFilesRead), fileService.ListFilesOrFolder)
+	authorized.POST("read", auth.RequireScope(auth.ScopeFilesRead), fileService.ReadFileContent)
+	// Organizations, their members and workspaces
+	authorized.POST("/orgs", auth.RequireScope(auth.ScopeOrgsWrite), authService.CreateOrgHandler)
+	authorized.GET("/orgs", auth.RequireScope(auth.ScopeOrgsRead), authService.ListOrgsHandler)
+	authorized.GET("/orgs/:orgID", auth.RequireScope(auth.ScopeOrgsRead), authService.GetOrgHandler)
+	authorized.PATCH("/orgs/:orgID", auth.RequireScope(auth.ScopeOrgsWrite), authService.UpdateOrgHandler)
+	authorized.DELETE("/orgs/:orgID", auth.RequireScope(auth.ScopeOrgsWrite), authService.DeleteOrgHandler)
+	authorized.POST("/orgs/:orgID/members", auth.RequireScope(auth.ScopeOrgsWrite), authService.AddOrgMemberHandler)
+	authorized.PATCH("/orgs/:orgID/members/:userID", auth.RequireScope(auth.ScopeOrgsWrite), authService.UpdateOrgMemberHandler)
+	authorized.DELETE("/orgs/:orgID/members/:userID", auth.RequireScope(auth.ScopeOrgsWrite), authService.RemoveOrgMemberHandler)
+	authorized.POST("/orgs/:orgID/workspaces", auth.RequireScope(auth.ScopeOrgsWrite), authService.CreateWorkspaceHandler)
+	authorized.GET("/orgs/:orgID/workspaces", auth.RequireScope(auth.ScopeOrgsRead), authService.ListWorkspacesHandler)
+	authorized.DELETE("/orgs/:orgID/workspaces/:workspaceID", auth.RequireScope(auth.ScopeOrgsWrite), authService.DeleteWorkspaceHandler)
+
+	// LAN discovery is optional, for offline sessions without a central URL
+	if os.Getenv("LAN_DISCOVERY") == "true" {
+		address := os.Getenv("NODE_ADDRESS")
+		if address == "" {
+			address = ":8080"
+		}
+		discovery := network.NewDiscovery(transport, address)
+		if err := discovery.Start(); err != nil {
+			log.Fatalf("Failed to start LAN discovery: %v", err)
+		}
+		defer discovery.Stop()
+
+		discoveryController := controllers.NewDiscoveryController(discovery)
+		apiRouter.GET("/discovery/nodes", discoveryController.GetNodes)
+	}
+
 	// Start Gin server for REST API
 	go func() {
 		if err := apiRouter.Run(":8080"); err != nil {
@@ -49,17 +196,22 @@ func main() {
 	// Initialize WebSocket router
 	wsRouter := http.NewServeMux()
 	// handle Collaborations
-	wsRouter.HandleFunc("/collab", collab.HandleCollaborations)
+	wsRouter.HandleFunc("/collab", authService.WebsocketMiddleware(collab.HandleCollaborations, auth.ScopeFilesWrite))
 	// Execute terminal commands
-	wsRouter.HandleFunc("/execute", controllers.ExecuteCommand)
+	wsRouter.HandleFunc("/execute", authService.WebsocketMiddleware(controllers.ExecuteCommand, auth.ScopeTerminalRun))
 	// Execute code
-	wsRouter.HandleFunc("/compile", compiler.ExecuteCodeHandler)
+	compileLimiter := ratelimit.NewLimiter(30, time.Minute, 10)
+	wsRouter.HandleFunc("/compile", authService.WebsocketMiddleware(ratelimit.Handler(compileLimiter, auth.RequestRateLimitKey, compiler.ExecuteCodeHandler), auth.ScopeCompileRun))
+	// Push room chat messages as they are sent
+	wsRouter.HandleFunc("/chat", authService.WebsocketMiddleware(chatService.HandleChat, auth.ScopeChatRead))
+	// Relay WebRTC signaling for audio/video calls
+	wsRouter.HandleFunc("/signal", authService.WebsocketMiddleware(signalingServer.HandleSignaling))
 	// Apply CORS middleware to the WebSocket server
 	wsHandler := handlers.CORS(
 
 		handlers.AllowedOrigins([]string{"*"}),
 		handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"Content-Type"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
 	)(wsRouter)
 
 	// Start WebSocket server
@@ -67,3 +219,75 @@ func main() {
 		log.Fatalf("Failed to start WebSocket server: %v", err)
 	}
 }
+
+// jwtSecret returns the key signing access tokens, read from JWT_SECRET.
+// A random key is generated if none is set, which logs everyone out on restart.
+func jwtSecret() []byte {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	log.Println("JWT_SECRET is not set, using a random secret")
+	secret := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		log.Fatalf("Failed to generate JWT secret: %v", err)
+	}
+	return secret
+}
+
+// trustedProxies returns the proxies whose X-Forwarded-For headers are trusted,
+// read from TRUSTED_PROXIES as a comma-separated list of IPs or CIDRs.
+// No proxy is trusted if it is not set.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// workspaceRoot returns the directory holding the workspace files, read from WORKSPACE_ROOT.
+func workspaceRoot() string {
+	if root := os.Getenv("WORKSPACE_ROOT"); root != "" {
+		return root
+	}
+	return "workspaces"
+}
+
+// registerIdentityProviders registers the identity providers configured in the environment.
+// OIDC_CLIENT_ID enables the company OIDC provider. Development builds may add a
+// fake provider, see registerDevProviders.
+func registerIdentityProviders(authService *auth.AuthService) {
+	if clientID := os.Getenv("OIDC_CLIENT_ID"); clientID != "" {
+		name := os.Getenv("OIDC_PROVIDER")
+		if name == "" {
+			name = "oidc"
+		}
+		authService.RegisterProvider(auth.NewOIDCProvider(auth.OIDCConfig{
+			Name:         name,
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			AuthURL:      os.Getenv("OIDC_AUTH_URL"),
+			TokenURL:     os.Getenv("OIDC_TOKEN_URL"),
+			UserInfoURL:  os.Getenv("OIDC_USERINFO_URL"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		}))
+	}
+	registerDevProviders(authService)
+}
+
+// configureMail sets where the emails go and the base URL of their links.
+// MAIL_DIR stores every email as a file, otherwise they are written to the log.
+func configureMail(authService *auth.AuthService) {
+	if url := os.Getenv("PUBLIC_URL"); url != "" {
+		authService.LinkBaseURL = strings.TrimSuffix(url, "/")
+	}
+	if dir := os.Getenv("MAIL_DIR"); dir != "" {
+		mailer, err := auth.NewFileMailer(dir)
+		if err != nil {
+			log.Fatalf("Failed to create mail directory: %v", err)
+		}
+		authService.Mailer = mailer
+	}
+}
@@ -0,0 +1,203 @@
+package network
+
+import (
+	"encoding/json"
+	"regexp"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+// Kinds of chat messages.
+const (
+	ChatMessageText   = "text"   // Message written by a peer
+	ChatMessageCode   = "code"   // Code snippet shared by a peer, the body is its caption
+	ChatMessageSystem = "system" // Notice generated by the server
+)
+
+// ChatMessage is a message of the chat history of a room.
+// Messages are never modified once stored: changes replace them with an updated clone.
+type ChatMessage struct {
+	ID        int                 `json:"id"`                   // Position of the message in the room, starting at 1
+	RoomID    string              `json:"room_id"`              // Room the message was sent to
+	Sender    *Peer               `json:"sender"`               // Peer who sent the message, nil for system messages
+	SentAt    time.Time           `json:"sent_at"`              // Time the message was sent, in UTC
+	Body      string              `json:"body"`                 // Content of the message, empty once deleted
+	Kind      string              `json:"kind"`                 // One of the ChatMessage* kinds
+	EditedAt  *time.Time          `json:"edited_at,omitempty"`  // Time the body was last edited, if ever
+	DeletedAt *time.Time          `json:"deleted_at,omitempty"` // Time the message was deleted, leaving a tombstone
+	DeletedBy string              `json:"deleted_by,omitempty"` // Peer who deleted the message, the sender or the host
+	Reactions map[string][]string `json:"reactions,omitempty"`  // IDs of the peers who reacted, keyed by emoji
+	ParentID  int                 `json:"parent_id,omitempty"`  // Message the message replies to, 0 outside threads
+	Thread    *ThreadSummary      `json:"thread,omitempty"`     // Summary of the replies to the message, if any
+	Mentions  []string            `json:"mentions,omitempty"`   // IDs of the peers of the room mentioned in the body, sorted
+	Snippet   *CodeSnippet        `json:"snippet,omitempty"`    // Code shared by a code message
+}
+
+// CodeSnippet is a piece of code shared in the chat, optionally taken from a
+// file of the workspace of the room so clients can open it in the editor.
+type CodeSnippet struct {
+	Language  string `json:"language"`             // Language used for syntax highlighting
+	Code      string `json:"code"`                 // Shared code
+	Path      string `json:"path,omitempty"`       // File of the room workspace the code comes from, if any
+	StartLine int    `json:"start_line,omitempty"` // First line of the code in the file, starting at 1
+	EndLine   int    `json:"end_line,omitempty"`   // Last line of the code in the file, included
+}
+
+// ThreadSummary sums up the replies to a message.
+type ThreadSummary struct {
+	Replies      int       `json:"replies"`        // Number of replies, including the deleted ones
+	LastReplyID  int       `json:"last_reply_id"`  // ID of the last reply
+	LastReplyAt  time.Time `json:"last_reply_at"`  // Time the last reply was sent, in UTC
+	LastSenderID string    `json:"last_sender_id"` // Peer who sent the last reply
+}
+
+// Deleted reports whether the message is a tombstone.
+func (m *ChatMessage) Deleted() bool {
+	return m.DeletedAt != nil
+}
+
+// Clone returns a deep copy of the message, to be modified and stored in its place.
+func (m *ChatMessage) Clone() *ChatMessage {
+	cloned := *m
+	if m.Sender != nil {
+		sender := *m.Sender
+		cloned.Sender = &sender
+	}
+	cloned.Mentions = append([]string(nil), m.Mentions...)
+	if m.Snippet != nil {
+		snippet := *m.Snippet
+		cloned.Snippet = &snippet
+	}
+	if m.Thread != nil {
+		thread := *m.Thread
+		cloned.Thread = &thread
+	}
+	if m.Reactions != nil {
+		cloned.Reactions = make(map[string][]string, len(m.Reactions))
+		for emoji, peerIDs := range m.Reactions {
+			cloned.Reactions[emoji] = append([]string(nil), peerIDs...)
+		}
+	}
+	return &cloned
+}
+
+// legacyChatMessage matches the "[date] sender: content" strings the chat
+// history was made of before messages were structured.
+var legacyChatMessage = regexp.MustCompile(`(?s)^\[(\d{2}-\d{2}-\d{4})\] ([^:]+): (.*)$`)
+
+// ParseLegacyChatMessage converts a chat message formatted as a string by older
+// nodes. Those only recorded the date and the ID of the sender, and strings that
+// cannot be parsed are kept whole as system messages.
+func ParseLegacyChatMessage(roomID string, id int, line string) *ChatMessage {
+	message := &ChatMessage{ID: id, RoomID: roomID, Body: line, Kind: ChatMessageSystem}
+	match := legacyChatMessage.FindStringSubmatch(line)
+	if match == nil {
+		return message
+	}
+	sentAt, err := time.Parse("02-01-2006", match[1])
+	if err != nil {
+		return message
+	}
+	message.Sender = &Peer{ID: match[2]}
+	message.SentAt = sentAt.UTC()
+	message.Body = match[3]
+	message.Kind = ChatMessageText
+	return message
+}
+
+// chatMessage has the fields of ChatMessage without its decoding methods.
+type chatMessage ChatMessage
+
+// UnmarshalJSON decodes a message, accepting the strings of older nodes.
+// The ID and room of those are set by the room holding them.
+func (m *ChatMessage) UnmarshalJSON(data []byte) error {
+	var line string
+	if err := json.Unmarshal(data, &line); err == nil {
+		*m = *ParseLegacyChatMessage("", 0, line)
+		return nil
+	}
+	if err := json.Unmarshal(data, (*chatMessage)(m)); err != nil {
+		return err
+	}
+	m.inUTC()
+	return nil
+}
+
+// DecodeMsgpack decodes a message, accepting the strings of older nodes.
+// The ID and room of those are set by the room holding them.
+func (m *ChatMessage) DecodeMsgpack(dec *msgpack.Decoder) error {
+	code, err := dec.PeekCode()
+	if err != nil {
+		return err
+	}
+	if msgpcode.IsString(code) {
+		line, err := dec.DecodeString()
+		if err != nil {
+			return err
+		}
+		*m = *ParseLegacyChatMessage("", 0, line)
+		return nil
+	}
+	// Times are decoded in the local time zone
+	if err := dec.Decode((*chatMessage)(m)); err != nil {
+		return err
+	}
+	m.inUTC()
+	return nil
+}
+
+// inUTC converts the times of the message to UTC.
+func (m *ChatMessage) inUTC() {
+	m.SentAt = m.SentAt.UTC()
+	if m.Thread != nil {
+		m.Thread.LastReplyAt = m.Thread.LastReplyAt.UTC()
+	}
+	for _, t := range []*time.Time{m.EditedAt, m.DeletedAt} {
+		if t != nil {
+			*t = t.UTC()
+		}
+	}
+}
+
+// room has the fields of Room without its decoding methods.
+type room Room
+
+// UnmarshalJSON decodes a room, migrating the chat history of older nodes.
+func (r *Room) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*room)(r)); err != nil {
+		return err
+	}
+	r.migrateChat()
+	return nil
+}
+
+// DecodeMsgpack decodes a room, migrating the chat history of older nodes.
+func (r *Room) DecodeMsgpack(dec *msgpack.Decoder) error {
+	if err := dec.Decode((*room)(r)); err != nil {
+		return err
+	}
+	r.migrateChat()
+	return nil
+}
+
+// LastChatID returns the ID of the last message sent to the room, 0 if none.
+// The last message is never dropped from the history, so IDs keep increasing.
+func (r *Room) LastChatID() int {
+	if len(r.Chat) == 0 {
+		return 0
+	}
+	return r.Chat[len(r.Chat)-1].ID
+}
+
+// migrateChat numbers the messages converted from strings, whose ID was their
+// position in the history.
+func (r *Room) migrateChat() {
+	for i, message := range r.Chat {
+		if message != nil && message.ID == 0 {
+			message.ID = i + 1
+			message.RoomID = r.ID
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes and decodes the messages exchanged between nodes.
+// The codec used on a connection is negotiated during the handshake.
+type Codec interface {
+	// Name returns the name used to negotiate the codec during the handshake.
+	Name() string
+
+	// Marshal encodes a value into its wire format.
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal decodes data produced by Marshal into the value pointed to by v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// DefaultCodecs lists the codecs supported by default, in order of preference.
+var DefaultCodecs = []Codec{MsgpackCodec{}, JSONCodec{}}
+
+// JSONCodec encodes messages as JSON. It is verbose but easy to debug.
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string { return "json" }
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// MsgpackCodec encodes messages as MessagePack, a compact binary format.
+// Struct fields are named after their json tags so both codecs share the same schema.
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Name() string { return "msgpack" }
+
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// negotiateCodec picks the first of the supported codecs offered by the remote node.
+// The offer is the comma separated list of codec names sent during the handshake.
+func negotiateCodec(supported []Codec, offer string) (Codec, error) {
+	offered := make(map[string]bool)
+	for _, name := range strings.Split(offer, ",") {
+		offered[strings.TrimSpace(name)] = true
+	}
+
+	for _, codec := range supported {
+		if offered[codec.Name()] {
+			return codec, nil
+		}
+	}
+	return nil, fmt.Errorf("no common codec in offer %q", offer)
+}
+
+// codecByName returns the supported codec with the given name.
+func codecByName(supported []Codec, name string) (Codec, error) {
+	for _, codec := range supported {
+		if codec.Name() == name {
+			return codec, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported codec %q", name)
+}
+
+// codecOffer returns the comma separated list of codec names sent during the handshake.
+func codecOffer(supported []Codec) string {
+	names := make([]string, len(supported))
+	for i, codec := range supported {
+		names[i] = codec.Name()
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,167 @@
+package network
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sampleRoomSync returns a room sync message with a few peers and some chat history.
+func sampleRoomSync() RoomSync {
+	room := &Room{
+		ID:    "3f2a9c1d7e6b5a40",
+		Host:  &Peer{ID: "host1", Name: "Host Peer", Email: "host@example.com", Address: "10.0.0.1:8080", Online: true},
+		Peers: make(map[string]*Peer),
+		Chat:  []*ChatMessage{},
+	}
+	for i := 0; i < 8; i++ {
+		id := fmt.Sprintf("peer%d", i)
+		room.Peers[id] = &Peer{ID: id, Name: "Peer " + id, Email: id + "@example.com", Address: fmt.Sprintf("10.0.0.%d:8080", i+2), Online: true}
+	}
+	for i := 0; i < 50; i++ {
+		room.Chat = append(room.Chat, &ChatMessage{
+			ID:     i + 1,
+			RoomID: room.ID,
+			Sender: room.Peers[fmt.Sprintf("peer%d", i%8)],
+			SentAt: time.Date(2026, 10, 19, 12, 0, i, 0, time.UTC),
+			Body:   fmt.Sprintf("message number %d", i),
+			Kind:   ChatMessageText,
+		})
+	}
+	return RoomSync{Room: room}
+}
+
+// sampleEdit returns a typical single-keystroke edit message.
+func sampleEdit() Edit {
+	return Edit{RoomID: "3f2a9c1d7e6b5a40", PeerID: "peer3", Path: "src/main.go", Offset: 1024, Length: 0, Text: "x", Version: 4211}
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	for _, codec := range DefaultCodecs {
+		t.Run(codec.Name(), func(t *testing.T) {
+			sync := sampleRoomSync()
+			data, err := encodeMessage(codec, NewMessage(MessageRoomSync, "10.0.0.1:7000", sync))
+			require.NoError(t, err)
+			msg, err := decodeMessage(codec, data)
+			require.NoError(t, err)
+			assert.Equal(t, MessageRoomSync, msg.Type)
+			assert.Equal(t, "10.0.0.1:7000", msg.From)
+
+			var decodedSync RoomSync
+			require.NoError(t, msg.Decode(&decodedSync))
+			assert.Equal(t, sync, decodedSync)
+
+			edit := sampleEdit()
+			data, err = encodeMessage(codec, NewMessage(MessageEdit, "10.0.0.1:7000", edit))
+			require.NoError(t, err)
+			msg, err = decodeMessage(codec, data)
+			require.NoError(t, err)
+
+			var decodedEdit Edit
+			require.NoError(t, msg.Decode(&decodedEdit))
+			assert.Equal(t, edit, decodedEdit)
+
+			_, err = decodeMessage(codec, []byte("\xc1garbage"))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCodecs_MigrateLegacyChat(t *testing.T) {
+	// Rooms sent by older nodes have their chat history as strings
+	legacy := map[string]interface{}{
+		"room": map[string]interface{}{
+			"id":    "3f2a9c1d7e6b5a40",
+			"peers": map[string]interface{}{},
+			"chat":  []string{"[19-10-2026] peer1: hello: world", "garbage"},
+		},
+	}
+	for _, codec := range DefaultCodecs {
+		t.Run(codec.Name(), func(t *testing.T) {
+			data, err := encodeMessage(codec, NewMessage(MessageRoomSync, "10.0.0.1:7000", legacy))
+			require.NoError(t, err)
+			msg, err := decodeMessage(codec, data)
+			require.NoError(t, err)
+
+			var sync RoomSync
+			require.NoError(t, msg.Decode(&sync))
+			require.Len(t, sync.Room.Chat, 2)
+			assert.Equal(t, &ChatMessage{
+				ID:     1,
+				RoomID: "3f2a9c1d7e6b5a40",
+				Sender: &Peer{ID: "peer1"},
+				SentAt: time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+				Body:   "hello: world",
+				Kind:   ChatMessageText,
+			}, sync.Room.Chat[0])
+			assert.Equal(t, &ChatMessage{ID: 2, RoomID: "3f2a9c1d7e6b5a40", Body: "garbage", Kind: ChatMessageSystem}, sync.Room.Chat[1])
+		})
+	}
+}
+
+func TestMsgpackCodec_IsSmallerThanJSON(t *testing.T) {
+	msg := NewMessage(MessageRoomSync, "10.0.0.1:7000", sampleRoomSync())
+	jsonData, err := encodeMessage(JSONCodec{}, msg)
+	require.NoError(t, err)
+	msgpackData, err := encodeMessage(MsgpackCodec{}, msg)
+	require.NoError(t, err)
+	assert.Less(t, len(msgpackData), len(jsonData))
+}
+
+func TestNegotiateCodec(t *testing.T) {
+	codec, err := negotiateCodec(DefaultCodecs, "json, msgpack")
+	require.NoError(t, err)
+	assert.Equal(t, "msgpack", codec.Name()) // The local preference wins
+
+	codec, err = negotiateCodec(DefaultCodecs, "protobuf,json")
+	require.NoError(t, err)
+	assert.Equal(t, "json", codec.Name())
+
+	_, err = negotiateCodec(DefaultCodecs, "protobuf")
+	assert.Error(t, err)
+
+	_, err = codecByName(DefaultCodecs, "protobuf")
+	assert.Error(t, err)
+	assert.Equal(t, "msgpack,json", codecOffer(DefaultCodecs))
+}
+
+// benchmarkCodec measures encoding and decoding a message body with every codec.
+func benchmarkCodec(b *testing.B, msgType string, body interface{}, decoded func() interface{}) {
+	for _, codec := range DefaultCodecs {
+		b.Run(codec.Name(), func(b *testing.B) {
+			msg := NewMessage(msgType, "10.0.0.1:7000", body)
+			data, err := encodeMessage(codec, msg)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				data, err := encodeMessage(codec, msg)
+				if err != nil {
+					b.Fatal(err)
+				}
+				received, err := decodeMessage(codec, data)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := received.Decode(decoded()); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes/msg")
+		})
+	}
+}
+
+func BenchmarkCodec_RoomSync(b *testing.B) {
+	benchmarkCodec(b, MessageRoomSync, sampleRoomSync(), func() interface{} { return new(RoomSync) })
+}
+
+func BenchmarkCodec_Edit(b *testing.B) {
+	benchmarkCodec(b, MessageEdit, sampleEdit(), func() interface{} { return new(Edit) })
+}
@@ -0,0 +1,286 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultDiscoveryGroup is the multicast group used for LAN discovery.
+const DefaultDiscoveryGroup = "239.255.42.99:9999"
+
+// Discovery message types.
+const (
+	discoveryAnnounce = "announce" // A node advertises itself and its public rooms
+	discoveryQuery    = "query"    // A node or client asks every node to announce itself
+)
+
+// maxDiscoveryPacket is the largest announcement accepted from the network.
+const maxDiscoveryPacket = 8192
+
+// RoomSummary describes a public room advertised by a node.
+type RoomSummary struct {
+	ID       string `json:"id"`        // Unique identifier for the room
+	HostName string `json:"host_name"` // Name of the peer hosting the room
+	Peers    int    `json:"peers"`     // Number of peers connected to the room
+}
+
+// DiscoveredNode is a backend node found on the local network.
+type DiscoveredNode struct {
+	NodeID   string        `json:"node_id"`   // Unique identifier for the node
+	Address  string        `json:"address"`   // Host:Port address of the node
+	Rooms    []RoomSummary `json:"rooms"`     // Public rooms hosted by the node
+	LastSeen time.Time     `json:"last_seen"` // Time the last announcement was received
+}
+
+// discoveryMessage is the datagram exchanged on the multicast group.
+type discoveryMessage struct {
+	Type    string        `json:"type"`
+	NodeID  string        `json:"node_id"`
+	Address string        `json:"address,omitempty"`
+	Rooms   []RoomSummary `json:"rooms,omitempty"`
+}
+
+// Discovery announces this node on a multicast group and keeps track of the
+// other nodes announcing themselves on the same LAN. It lets offline sessions
+// find each other without a central URL.
+type Discovery struct {
+	NodeID       string        // Unique identifier of this node
+	Address      string        // Host:Port address advertised to other nodes
+	Group        string        // Multicast group address (host:port)
+	Interval     time.Duration // Interval between announcements
+	TTL          time.Duration // Time after which a silent node is forgotten
+	TCPTransport *TCPTransport // Source of the public rooms to advertise
+
+	mutex    sync.Mutex
+	nodes    map[string]*DiscoveredNode
+	listener *net.UDPConn
+	sender   *net.UDPConn
+	done     chan struct{}
+	now      func() time.Time
+}
+
+// NewDiscovery creates a new Discovery for the node reachable at address.
+// The node ID is generated randomly and the default group and timings are used.
+func NewDiscovery(transport *TCPTransport, address string) *Discovery {
+	return &Discovery{
+		NodeID:       generateRoomID(),
+		Address:      address,
+		Group:        DefaultDiscoveryGroup,
+		Interval:     5 * time.Second,
+		TTL:          15 * time.Second,
+		TCPTransport: transport,
+		nodes:        make(map[string]*DiscoveredNode),
+		now:          time.Now,
+	}
+}
+
+// Start joins the multicast group, answers queries and announces the node periodically.
+func (d *Discovery) Start() error {
+	if d.listener != nil {
+		return nil // Discovery already started
+	}
+
+	group, err := net.ResolveUDPAddr("udp4", d.Group)
+	if err != nil {
+		return err
+	}
+	listener, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return err
+	}
+	sender, err := net.DialUDP("udp4", nil, group)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	d.listener = listener
+	d.sender = sender
+	d.done = make(chan struct{})
+
+	go d.readLoop(listener)
+	go d.announceLoop(sender, d.done)
+
+	// Ask the nodes already running to announce themselves right away
+	return d.send(sender, nil, discoveryMessage{Type: discoveryQuery, NodeID: d.NodeID})
+}
+
+// Stop leaves the multicast group and stops announcing the node.
+func (d *Discovery) Stop() error {
+	if d.listener == nil {
+		return nil // Discovery already stopped
+	}
+
+	close(d.done)
+	err := errors.Join(d.listener.Close(), d.sender.Close())
+	d.listener = nil
+	d.sender = nil
+	return err
+}
+
+// Nodes returns the nodes currently known on the LAN, sorted by node ID.
+// Nodes that have not announced themselves within the TTL are dropped.
+func (d *Discovery) Nodes() []DiscoveredNode {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.expire()
+	nodes := make([]DiscoveredNode, 0, len(d.nodes))
+	for _, node := range d.nodes {
+		nodes = append(nodes, *node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].NodeID < nodes[j].NodeID })
+	return nodes
+}
+
+// announceLoop sends an announcement every interval until done is closed.
+func (d *Discovery) announceLoop(sender *net.UDPConn, done chan struct{}) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.send(sender, nil, d.announcement()); err != nil {
+			log.Printf("discovery: failed to announce: %v", err)
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// readLoop handles incoming datagrams until the listener is closed.
+func (d *Discovery) readLoop(listener *net.UDPConn) {
+	buf := make([]byte, maxDiscoveryPacket)
+	for {
+		n, from, err := listener.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("discovery: failed to read: %v", err)
+			continue
+		}
+
+		reply, err := d.handleMessage(buf[:n], from)
+		if err != nil {
+			log.Printf("discovery: ignoring packet from %s: %v", from, err)
+			continue
+		}
+		if reply != nil {
+			// Queries are answered directly to the sender
+			if err := d.send(listener, from, *reply); err != nil {
+				log.Printf("discovery: failed to answer %s: %v", from, err)
+			}
+		}
+	}
+}
+
+// handleMessage processes a datagram and returns the reply to send back, if any.
+func (d *Discovery) handleMessage(data []byte, from *net.UDPAddr) (*discoveryMessage, error) {
+	var msg discoveryMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	if msg.NodeID == "" {
+		return nil, errors.New("missing node ID")
+	}
+	if msg.NodeID == d.NodeID {
+		return nil, nil // Our own multicast loopback
+	}
+
+	switch msg.Type {
+	case discoveryQuery:
+		reply := d.announcement()
+		return &reply, nil
+	case discoveryAnnounce:
+		address, err := announcedAddress(msg.Address, from)
+		if err != nil {
+			return nil, err
+		}
+		d.mutex.Lock()
+		d.nodes[msg.NodeID] = &DiscoveredNode{
+			NodeID:   msg.NodeID,
+			Address:  address,
+			Rooms:    msg.Rooms,
+			LastSeen: d.now(),
+		}
+		d.mutex.Unlock()
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported message type %q", msg.Type)
+	}
+}
+
+// announcement builds the announcement for this node with its public rooms.
+func (d *Discovery) announcement() discoveryMessage {
+	msg := discoveryMessage{Type: discoveryAnnounce, NodeID: d.NodeID, Address: d.Address}
+	if d.TCPTransport == nil {
+		return msg
+	}
+
+	d.TCPTransport.Mutex.Lock()
+	defer d.TCPTransport.Mutex.Unlock()
+	for _, room := range d.TCPTransport.Rooms {
+		// Rooms of an organization are private to its members
+		if !room.Public || room.OrgID != "" {
+			continue
+		}
+		summary := RoomSummary{ID: room.ID, Peers: len(room.Peers)}
+		if room.Host != nil {
+			summary.HostName = room.Host.Name
+		}
+		msg.Rooms = append(msg.Rooms, summary)
+	}
+	sort.Slice(msg.Rooms, func(i, j int) bool { return msg.Rooms[i].ID < msg.Rooms[j].ID })
+	return msg
+}
+
+// expire drops the nodes that have been silent for longer than the TTL.
+// The caller must hold the mutex.
+func (d *Discovery) expire() {
+	now := d.now()
+	for id, node := range d.nodes {
+		if now.Sub(node.LastSeen) > d.TTL {
+			delete(d.nodes, id)
+		}
+	}
+}
+
+// send writes a discovery message to the given address, or to the group if to is nil.
+func (d *Discovery) send(conn *net.UDPConn, to *net.UDPAddr, msg discoveryMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if to == nil {
+		_, err = conn.Write(data)
+	} else {
+		_, err = conn.WriteToUDP(data, to)
+	}
+	return err
+}
+
+// announcedAddress completes the address advertised by a node.
+// Nodes usually listen on all interfaces (":8080"), in which case the
+// host is taken from the source of the datagram.
+func announcedAddress(address string, from *net.UDPAddr) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %v", address, err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		if from == nil {
+			return "", fmt.Errorf("cannot resolve host for address %q", address)
+		}
+		host = from.IP.String()
+	}
+	return net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,86 @@
+package network
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscovery_HandleAnnouncement(t *testing.T) {
+	discovery := NewDiscovery(NewTCPTransport(), ":8080")
+	from := &net.UDPAddr{IP: net.ParseIP("192.168.1.20"), Port: 9999}
+
+	data, _ := json.Marshal(discoveryMessage{
+		Type:    discoveryAnnounce,
+		NodeID:  "node2",
+		Address: ":8080",
+		Rooms:   []RoomSummary{{ID: "room1", HostName: "Host", Peers: 2}},
+	})
+	reply, err := discovery.handleMessage(data, from)
+	require.NoError(t, err)
+	assert.Nil(t, reply)
+
+	nodes := discovery.Nodes()
+	require.Len(t, nodes, 1)
+	assert.Equal(t, "node2", nodes[0].NodeID)
+	assert.Equal(t, "192.168.1.20:8080", nodes[0].Address) // Host taken from the datagram source
+	assert.Equal(t, "room1", nodes[0].Rooms[0].ID)
+
+	// Our own announcements are ignored
+	data, _ = json.Marshal(discoveryMessage{Type: discoveryAnnounce, NodeID: discovery.NodeID, Address: ":8080"})
+	_, err = discovery.handleMessage(data, from)
+	require.NoError(t, err)
+	assert.Len(t, discovery.Nodes(), 1)
+
+	// Malformed packets are rejected
+	_, err = discovery.handleMessage([]byte("garbage"), from)
+	assert.Error(t, err)
+	data, _ = json.Marshal(discoveryMessage{Type: discoveryAnnounce, NodeID: "node3", Address: "no-port"})
+	_, err = discovery.handleMessage(data, from)
+	assert.Error(t, err)
+}
+
+func TestDiscovery_QueryAdvertisesPublicRooms(t *testing.T) {
+	transport := NewTCPTransport()
+	host := &Peer{ID: "host1", Name: "Host Peer", Email: "host@example.com", Address: "localhost:9000"}
+	publicRoom, err := transport.CreateRoom(host)
+	require.NoError(t, err)
+	_, err = transport.CreateRoom(host)
+	require.NoError(t, err)
+	require.NoError(t, transport.SetRoomVisibility(publicRoom, true))
+
+	discovery := NewDiscovery(transport, "10.0.0.1:8080")
+	data, _ := json.Marshal(discoveryMessage{Type: discoveryQuery, NodeID: "client"})
+	reply, err := discovery.handleMessage(data, nil)
+	require.NoError(t, err)
+	require.NotNil(t, reply)
+
+	assert.Equal(t, discoveryAnnounce, reply.Type)
+	assert.Equal(t, "10.0.0.1:8080", reply.Address)
+	require.Len(t, reply.Rooms, 1)
+	assert.Equal(t, publicRoom, reply.Rooms[0].ID)
+	assert.Equal(t, "Host Peer", reply.Rooms[0].HostName)
+}
+
+func TestDiscovery_ExpiresSilentNodes(t *testing.T) {
+	discovery := NewDiscovery(nil, ":8080")
+	now := time.Now()
+	discovery.now = func() time.Time { return now }
+
+	data, _ := json.Marshal(discoveryMessage{Type: discoveryAnnounce, NodeID: "node2", Address: "10.0.0.2:8080"})
+	_, err := discovery.handleMessage(data, nil)
+	require.NoError(t, err)
+	assert.Len(t, discovery.Nodes(), 1)
+
+	now = now.Add(discovery.TTL + time.Second)
+	assert.Empty(t, discovery.Nodes())
+}
+
+func TestSetRoomVisibility_Error(t *testing.T) {
+	transport := NewTCPTransport()
+	assert.Error(t, transport.SetRoomVisibility("nonexistent", true))
+}
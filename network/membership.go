@@ -0,0 +1,347 @@
+package network
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MessageGossip is the message type carrying a membership digest.
+const MessageGossip = "gossip"
+
+// MemberState is the liveness state of a member as seen by the local node.
+type MemberState int
+
+const (
+	MemberAlive   MemberState = iota // The member sent a heartbeat recently
+	MemberSuspect                    // The member missed heartbeats and may have failed
+	MemberDead                       // The member missed heartbeats for too long and is considered failed
+)
+
+// String returns the name of the member state.
+func (s MemberState) String() string {
+	switch s {
+	case MemberAlive:
+		return "alive"
+	case MemberSuspect:
+		return "suspect"
+	case MemberDead:
+		return "dead"
+	default:
+		return fmt.Sprintf("MemberState(%d)", int(s))
+	}
+}
+
+// MarshalText encodes the member state as its name.
+func (s MemberState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a member state from its name.
+func (s *MemberState) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "alive":
+		*s = MemberAlive
+	case "suspect":
+		*s = MemberSuspect
+	case "dead":
+		*s = MemberDead
+	default:
+		return fmt.Errorf("unknown member state %q", text)
+	}
+	return nil
+}
+
+// Member is a node or peer tracked by the membership layer, identified by its address.
+// A node picks a new incarnation every time it starts, so its heartbeats restarting
+// from 0 are not mistaken for stale ones.
+type Member struct {
+	Address     string      `json:"address"`     // Host:Port address of the member
+	State       MemberState `json:"state"`       // Liveness state as seen by the local node
+	Incarnation uint64      `json:"incarnation"` // Incarnation of the member, increasing across restarts
+	Heartbeat   uint64      `json:"heartbeat"`   // Latest heartbeat counter of the member within its incarnation
+	LastUpdate  time.Time   `json:"last_update"` // Local time the heartbeat last increased
+}
+
+// newer reports whether the member information is more recent than the other's.
+func (m *Member) newer(other *Member) bool {
+	if m.Incarnation != other.Incarnation {
+		return m.Incarnation > other.Incarnation
+	}
+	return m.Heartbeat > other.Heartbeat
+}
+
+// Clock abstracts the passing of time so failure detection can be tested deterministically.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock backed by the system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// MembershipConfig holds the timings of the membership protocol.
+type MembershipConfig struct {
+	Interval       time.Duration // Time between two gossip rounds
+	Fanout         int           // Number of members gossiped to per round
+	SuspectTimeout time.Duration // Silence after which a member becomes suspect
+	DeadTimeout    time.Duration // Silence after which a member is declared dead
+	PruneTimeout   time.Duration // Silence after which a dead member is forgotten, unless it is a seed
+}
+
+// DefaultMembershipConfig returns the timings used by NewMembership.
+func DefaultMembershipConfig() MembershipConfig {
+	return MembershipConfig{
+		Interval:       time.Second,
+		Fanout:         3,
+		SuspectTimeout: 5 * time.Second,
+		DeadTimeout:    15 * time.Second,
+		PruneTimeout:   10 * time.Minute,
+	}
+}
+
+// Membership implements a SWIM-style gossip layer over a Transport.
+// Every round, the local node increments its heartbeat and sends its view of
+// the cluster to a few random members. Members whose heartbeat stops
+// increasing become suspect and then dead; a member that resumes sending
+// heartbeats is considered alive again.
+type Membership struct {
+	Address   string           // Host:Port address of the local node
+	Transport Transport        // Transport used to exchange digests
+	Clock     Clock            // Clock used for failure detection
+	Config    MembershipConfig // Timings of the protocol
+
+	// OnChange is called whenever a member changes state.
+	// It is called without holding any lock.
+	OnChange func(Member)
+
+	mutex       sync.Mutex
+	members     map[string]*Member
+	seeds       map[string]bool // Members never pruned, so the node can always rejoin the cluster
+	incarnation uint64          // Incarnation of the local node
+	heartbeat   uint64
+	rand        *rand.Rand
+}
+
+// NewMembership creates the membership layer for the node at address.
+// The seeds are the addresses of the members known at startup.
+// The incarnation of the node is the start time, so it increases across restarts.
+func NewMembership(address string, transport Transport, seeds []string) *Membership {
+	m := &Membership{
+		Address:     address,
+		Transport:   transport,
+		Clock:       systemClock{},
+		Config:      DefaultMembershipConfig(),
+		members:     make(map[string]*Member),
+		seeds:       make(map[string]bool),
+		incarnation: uint64(time.Now().UnixNano()),
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, seed := range seeds {
+		if seed != "" && seed != address {
+			m.seeds[seed] = true
+		}
+		m.Track(seed)
+	}
+	return m
+}
+
+// Track starts monitoring the member at the given address.
+// It is a no-op if the member is already known.
+func (m *Membership) Track(address string) {
+	if address == "" || address == m.Address {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.members[address]; !ok {
+		m.members[address] = &Member{Address: address, State: MemberAlive, LastUpdate: m.Clock.Now()}
+	}
+}
+
+// Knows reports whether the address is a member known to the local node and not
+// declared dead. Relays only forward messages to such members.
+func (m *Membership) Knows(address string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	member, ok := m.members[address]
+	return ok && member.State != MemberDead
+}
+
+// Members returns the members known to the local node, sorted by address.
+func (m *Membership) Members() []Member {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	members := make([]Member, 0, len(m.members))
+	for _, member := range m.members {
+		members = append(members, *member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Address < members[j].Address })
+	return members
+}
+
+// Run executes gossip rounds until done is closed.
+// The digests received are handled by HandleMessage, registered on the Router
+// of the transport for MessageGossip.
+func (m *Membership) Run(done <-chan struct{}) {
+	ticker := time.NewTicker(m.Config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			m.Tick()
+		}
+	}
+}
+
+// Tick executes a single gossip round: it increments the local heartbeat,
+// updates the state of silent members and sends the digest to random members.
+func (m *Membership) Tick() {
+	m.mutex.Lock()
+	m.heartbeat++
+	changes := m.detectFailures()
+	targets := m.pickTargets()
+	digest := m.digest()
+	m.mutex.Unlock()
+
+	m.notify(changes)
+
+	for _, address := range targets {
+		msg := NewMessage(MessageGossip, m.Address, digest)
+		if err := m.Transport.Send(address, msg); err != nil {
+			// Unreachable members are caught by the failure detector
+			log.Printf("membership: failed to gossip to %s: %v", address, err)
+		}
+	}
+}
+
+// HandleMessage merges a digest received from another node into the local view.
+// A member whose heartbeat increased, or that restarted with a new incarnation,
+// is refreshed and becomes alive again.
+func (m *Membership) HandleMessage(msg *Message) error {
+	var digest []Member
+	if err := msg.Decode(&digest); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	now := m.Clock.Now()
+	var changes []Member
+	for _, remote := range digest {
+		if remote.Address == "" || remote.Address == m.Address {
+			continue
+		}
+
+		local, ok := m.members[remote.Address]
+		if !ok {
+			if remote.State == MemberDead {
+				continue // Never learn about members that are already gone
+			}
+			local = &Member{Address: remote.Address, State: MemberAlive, Incarnation: remote.Incarnation, Heartbeat: remote.Heartbeat, LastUpdate: now}
+			m.members[remote.Address] = local
+			changes = append(changes, *local)
+			continue
+		}
+
+		if !remote.newer(local) {
+			continue // Stale information
+		}
+		local.Incarnation = remote.Incarnation
+		local.Heartbeat = remote.Heartbeat
+		local.LastUpdate = now
+		if local.State != MemberAlive {
+			local.State = MemberAlive
+			changes = append(changes, *local)
+		}
+	}
+	m.mutex.Unlock()
+
+	m.notify(changes)
+	return nil
+}
+
+// detectFailures marks silent members as suspect or dead, and forgets the
+// members dead for long enough.
+// The caller must hold the mutex.
+func (m *Membership) detectFailures() []Member {
+	now := m.Clock.Now()
+	var changes []Member
+	for address, member := range m.members {
+		silence := now.Sub(member.LastUpdate)
+		switch {
+		case member.State == MemberDead && silence > m.Config.PruneTimeout && !m.seeds[address]:
+			delete(m.members, address)
+			continue
+		case member.State != MemberDead && silence > m.Config.DeadTimeout:
+			member.State = MemberDead
+		case member.State == MemberAlive && silence > m.Config.SuspectTimeout:
+			member.State = MemberSuspect
+		default:
+			continue
+		}
+		changes = append(changes, *member)
+	}
+	return changes
+}
+
+// pickTargets selects up to Fanout random members that are not dead, plus one
+// random dead member so that the cluster heals after a partition.
+// The caller must hold the mutex.
+func (m *Membership) pickTargets() []string {
+	var alive, dead []string
+	for address, member := range m.members {
+		if member.State == MemberDead {
+			dead = append(dead, address)
+		} else {
+			alive = append(alive, address)
+		}
+	}
+	// Map order is random, sort first to keep rounds reproducible
+	sort.Strings(alive)
+	sort.Strings(dead)
+
+	m.rand.Shuffle(len(alive), func(i, j int) {
+		alive[i], alive[j] = alive[j], alive[i]
+	})
+	if len(alive) > m.Config.Fanout {
+		alive = alive[:m.Config.Fanout]
+	}
+	if len(dead) > 0 {
+		alive = append(alive, dead[m.rand.Intn(len(dead))])
+	}
+	return alive
+}
+
+// digest returns the local view of the cluster, including the local node.
+// Dead members are left out so that stale heartbeats cannot revive them.
+// The caller must hold the mutex.
+func (m *Membership) digest() []Member {
+	digest := []Member{{Address: m.Address, State: MemberAlive, Incarnation: m.incarnation, Heartbeat: m.heartbeat}}
+	for _, member := range m.members {
+		if member.State == MemberDead {
+			continue
+		}
+		digest = append(digest, Member{Address: member.Address, State: member.State, Incarnation: member.Incarnation, Heartbeat: member.Heartbeat})
+	}
+	return digest
+}
+
+// notify calls OnChange for every state change.
+func (m *Membership) notify(changes []Member) {
+	if m.OnChange == nil {
+		return
+	}
+	for _, member := range changes {
+		m.OnChange(member)
+	}
+}
@@ -0,0 +1,272 @@
+package network
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a Clock controlled by the test.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// memoryNetwork delivers messages between in-memory transports synchronously.
+type memoryNetwork struct {
+	mutex sync.Mutex
+	nodes map[string]*Membership
+	down  map[string]bool
+}
+
+// memoryTransport is the Transport of a single node of a memoryNetwork.
+type memoryTransport struct {
+	network *memoryNetwork
+	msgs    chan *Message
+}
+
+func (t *memoryTransport) Listen(address string) error { return nil }
+func (t *memoryTransport) Close() error                { return nil }
+func (t *memoryTransport) Consume() <-chan *Message    { return t.msgs }
+
+// Send encodes the message and hands it to the target node, unless one of the nodes is down.
+func (t *memoryTransport) Send(address string, msg *Message) error {
+	t.network.mutex.Lock()
+	target, ok := t.network.nodes[address]
+	unreachable := t.network.down[address] || t.network.down[msg.From]
+	t.network.mutex.Unlock()
+
+	if !ok || unreachable {
+		return errors.New("connection refused")
+	}
+	data, err := encodeMessage(JSONCodec{}, msg)
+	if err != nil {
+		return err
+	}
+	received, err := decodeMessage(JSONCodec{}, data)
+	if err != nil {
+		return err
+	}
+	return target.HandleMessage(received)
+}
+
+// newTestCluster creates nodes sharing a fake clock, each seeded with the first node.
+func newTestCluster(clock *fakeClock, addresses ...string) (*memoryNetwork, []*Membership) {
+	net := &memoryNetwork{nodes: make(map[string]*Membership), down: make(map[string]bool)}
+	var nodes []*Membership
+	for i, address := range addresses {
+		var seeds []string
+		if i > 0 {
+			seeds = []string{addresses[0]}
+		}
+		node := NewMembership(address, &memoryTransport{network: net}, nil)
+		node.Clock = clock
+		node.rand = rand.New(rand.NewSource(int64(i)))
+		for _, seed := range seeds {
+			node.Track(seed)
+		}
+		net.nodes[address] = node
+		nodes = append(nodes, node)
+	}
+	return net, nodes
+}
+
+// tick runs a gossip round on every node that is up.
+func tick(net *memoryNetwork, clock *fakeClock, nodes []*Membership) {
+	clock.Advance(time.Second)
+	for _, node := range nodes {
+		if !net.down[node.Address] {
+			node.Tick()
+		}
+	}
+}
+
+// stateOf returns the state of a member as seen by a node.
+func stateOf(t *testing.T, node *Membership, address string) MemberState {
+	for _, member := range node.Members() {
+		if member.Address == address {
+			return member.State
+		}
+	}
+	t.Fatalf("%s does not know %s", node.Address, address)
+	return MemberDead
+}
+
+func TestMembership_Converges(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	net, nodes := newTestCluster(clock, "a:1", "b:1", "c:1")
+
+	for i := 0; i < 3; i++ {
+		tick(net, clock, nodes)
+	}
+
+	// Every node learned about every other node through the seed
+	for _, node := range nodes {
+		members := node.Members()
+		assert.Len(t, members, 2, "node %s", node.Address)
+		for _, member := range members {
+			assert.Equal(t, MemberAlive, member.State)
+		}
+	}
+}
+
+func TestMembership_SuspectDeadAndRecovery(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	net, nodes := newTestCluster(clock, "a:1", "b:1", "c:1")
+	a := nodes[0]
+
+	var changes []Member
+	a.OnChange = func(member Member) { changes = append(changes, member) }
+
+	for i := 0; i < 3; i++ {
+		tick(net, clock, nodes)
+	}
+	changes = nil
+
+	// c stops sending heartbeats
+	net.down["c:1"] = true
+	for i := 0; i < 6; i++ {
+		tick(net, clock, nodes)
+	}
+	assert.Equal(t, MemberSuspect, stateOf(t, a, "c:1"))
+
+	for i := 0; i < 10; i++ {
+		tick(net, clock, nodes)
+	}
+	assert.Equal(t, MemberDead, stateOf(t, a, "c:1"))
+	assert.Equal(t, MemberAlive, stateOf(t, a, "b:1"))
+	require.Len(t, changes, 2)
+	assert.Equal(t, MemberSuspect, changes[0].State)
+	assert.Equal(t, MemberDead, changes[1].State)
+
+	// c comes back and gossips its newer heartbeat
+	net.down["c:1"] = false
+	for i := 0; i < 3; i++ {
+		tick(net, clock, nodes)
+	}
+	assert.Equal(t, MemberAlive, stateOf(t, a, "c:1"))
+	assert.Equal(t, MemberAlive, changes[len(changes)-1].State)
+}
+
+func TestMembership_RestartAndPrune(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	net, nodes := newTestCluster(clock, "a:1", "b:1", "c:1")
+	a := nodes[0]
+	for i := 0; i < 20; i++ {
+		tick(net, clock, nodes)
+	}
+
+	net.down["c:1"] = true
+	for i := 0; i < 20; i++ {
+		tick(net, clock, nodes)
+	}
+	require.Equal(t, MemberDead, stateOf(t, a, "c:1"))
+
+	// c restarts with its heartbeat back to 0 but a new incarnation
+	restarted := NewMembership("c:1", &memoryTransport{network: net}, []string{"a:1"})
+	restarted.Clock = clock
+	restarted.incarnation = nodes[2].incarnation + 1
+	net.mutex.Lock()
+	net.nodes["c:1"] = restarted
+	net.down["c:1"] = false
+	net.mutex.Unlock()
+	nodes[2] = restarted
+	for i := 0; i < 3; i++ {
+		tick(net, clock, nodes)
+	}
+	assert.Equal(t, MemberAlive, stateOf(t, a, "c:1"))
+
+	// Members dead for long are forgotten, but not the seeds
+	a.Config.PruneTimeout = time.Minute
+	restarted.Config.PruneTimeout = time.Minute
+	net.down["a:1"], net.down["b:1"] = true, true
+	for i := 0; i < 90; i++ {
+		tick(net, clock, nodes)
+	}
+	assert.Equal(t, []Member{}, membersBut(restarted, "a:1"))
+	assert.Equal(t, MemberDead, stateOf(t, restarted, "a:1"))
+
+	net.down["a:1"], net.down["c:1"] = false, true
+	for i := 0; i < 90; i++ {
+		tick(net, clock, nodes)
+	}
+	assert.Empty(t, a.Members())
+}
+
+// membersBut returns the members known to the node but the one at address.
+func membersBut(node *Membership, address string) []Member {
+	members := []Member{}
+	for _, member := range node.Members() {
+		if member.Address != address {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// roundTrip encodes and decodes a message as if it was received from the network.
+func roundTrip(t *testing.T, msg *Message) *Message {
+	data, err := encodeMessage(JSONCodec{}, msg)
+	require.NoError(t, err)
+	received, err := decodeMessage(JSONCodec{}, data)
+	require.NoError(t, err)
+	return received
+}
+
+func TestMembership_HandleMessageErrors(t *testing.T) {
+	node := NewMembership("a:1", NewTCPTransport(), nil)
+
+	// Messages that were not received from the network cannot be decoded
+	assert.Error(t, node.HandleMessage(NewMessage(MessageGossip, "b:1", []Member{})))
+
+	// Malformed digest
+	assert.Error(t, node.HandleMessage(roundTrip(t, NewMessage(MessageGossip, "b:1", "garbage"))))
+
+	// Dead members are not learned from digests
+	digest := []Member{{Address: "c:1", State: MemberDead, Heartbeat: 4}}
+	require.NoError(t, node.HandleMessage(roundTrip(t, NewMessage(MessageGossip, "b:1", digest))))
+	assert.Empty(t, node.Members())
+}
+
+func TestApplyMemberState(t *testing.T) {
+	transport := NewTCPTransport()
+	host := &Peer{ID: "host1", Name: "Host", Email: "host@example.com", Address: "host:1", Online: true}
+	roomID, err := transport.CreateRoom(host)
+	require.NoError(t, err)
+	guest := &Peer{ID: "guest1", Address: "guest:1", Online: true}
+	require.NoError(t, transport.JoinRoom(roomID, guest))
+
+	transport.ApplyMemberState(Member{Address: "guest:1", State: MemberSuspect})
+	assert.False(t, guest.Online)
+	assert.Contains(t, transport.Rooms[roomID].Peers, "guest1")
+
+	transport.ApplyMemberState(Member{Address: "guest:1", State: MemberAlive})
+	assert.True(t, guest.Online)
+
+	transport.ApplyMemberState(Member{Address: "guest:1", State: MemberDead})
+	assert.NotContains(t, transport.Rooms[roomID].Peers, "guest1")
+
+	// The room is deleted once its last peer is dead
+	transport.ApplyMemberState(Member{Address: "host:1", State: MemberDead})
+	assert.NotContains(t, transport.Rooms, roomID)
+}
+
+func TestMemberState_Text(t *testing.T) {
+	for _, state := range []MemberState{MemberAlive, MemberSuspect, MemberDead} {
+		text, err := state.MarshalText()
+		require.NoError(t, err)
+		var decoded MemberState
+		require.NoError(t, decoded.UnmarshalText(text))
+		assert.Equal(t, state, decoded)
+	}
+	var state MemberState
+	assert.Error(t, state.UnmarshalText([]byte("zombie")))
+}
@@ -0,0 +1,103 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// maxFrameSize is the largest frame accepted from a remote node.
+const maxFrameSize = 4 << 20
+
+// Message is the envelope exchanged between nodes over a Transport.
+// The payload is encoded with the codec negotiated for the connection it was
+// first sent on, and is interpreted according to the message type. Relays
+// forward the payload untouched, so the envelope records its encoding.
+type Message struct {
+	Type     string `json:"type"`               // Type of the message, e.g. "gossip"
+	From     string `json:"from"`               // Host:Port address of the sending node
+	To       string `json:"to,omitempty"`       // Host:Port address of the target node when sent through a relay
+	Encoding string `json:"encoding,omitempty"` // Name of the codec the payload is encoded with
+	Payload  []byte `json:"payload"`            // Encoded message body
+
+	body  interface{} // Body to encode when the message is sent
+	codec Codec       // Codec the payload was encoded with when the message was received
+}
+
+// NewMessage creates a message whose body is encoded when it is sent,
+// using the codec negotiated with the remote node.
+func NewMessage(msgType, from string, body interface{}) *Message {
+	return &Message{Type: msgType, From: from, body: body}
+}
+
+// Decode decodes the payload of a received message into the value pointed to by v.
+func (m *Message) Decode(v interface{}) error {
+	if m.codec == nil {
+		return fmt.Errorf("message %s was not received from the network", m.Type)
+	}
+	return m.codec.Unmarshal(m.Payload, v)
+}
+
+// encodeMessage encodes a message and its body with the codec.
+func encodeMessage(codec Codec, msg *Message) ([]byte, error) {
+	envelope := *msg
+	if msg.body != nil {
+		payload, err := codec.Marshal(msg.body)
+		if err != nil {
+			return nil, err
+		}
+		envelope.Payload = payload
+		envelope.Encoding = codec.Name()
+	}
+	return codec.Marshal(&envelope)
+}
+
+// decodeMessage decodes a message encoded with the codec.
+func decodeMessage(codec Codec, data []byte) (*Message, error) {
+	msg := new(Message)
+	if err := codec.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	msg.codec = codec
+	if msg.Encoding != "" && msg.Encoding != codec.Name() {
+		payloadCodec, err := codecByName(DefaultCodecs, msg.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		msg.codec = payloadCodec
+	}
+	return msg, nil
+}
+
+// writeFrame writes a length-prefixed frame to the writer.
+func writeFrame(w io.Writer, data []byte) error {
+	if len(data) > maxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds the maximum of %d bytes", len(data), maxFrameSize)
+	}
+
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readFrame reads a length-prefixed frame from the reader.
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the maximum of %d bytes", size, maxFrameSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
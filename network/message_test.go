@@ -0,0 +1,24 @@
+package network
+
+// Message types of the sample bodies the transport and codec tests exchange.
+const (
+	MessageRoomSync = "room-sync" // Full state of a room replicated to another node
+	MessageEdit     = "edit"      // Single change to a file of a room
+)
+
+// RoomSync carries the full state of a room replicated between nodes.
+type RoomSync struct {
+	Room *Room `json:"room"` // Room to replicate, including its peers and chat history
+}
+
+// Edit is a single change to a file edited collaboratively in a room.
+// It replaces Length characters at Offset with Text.
+type Edit struct {
+	RoomID  string `json:"room_id"` // Room the file belongs to
+	PeerID  string `json:"peer_id"` // Peer that made the change
+	Path    string `json:"path"`    // Path of the edited file in the workspace
+	Offset  int    `json:"offset"`  // Position of the change in the file
+	Length  int    `json:"length"`  // Number of characters replaced
+	Text    string `json:"text"`    // Inserted text
+	Version uint64 `json:"version"` // Version of the file the change applies to
+}
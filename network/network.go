@@ -14,4 +14,12 @@ type Transport interface {
 	// It stops listening for incoming connections and cleans up any resources used by the transport.
 	// Returns an error if closing the transport fails.
 	Close() error
+
+	// Send delivers a message to the node listening on the specified address.
+	// It takes the address (host:port) of the remote node and the message to deliver.
+	// Returns an error if connecting to the node or writing the message fails.
+	Send(address string, msg *Message) error
+
+	// Consume returns a read-only channel of the messages received from remote nodes.
+	Consume() <-chan *Message
 }
@@ -15,9 +15,13 @@ type Peer struct {
 
 // Room represents a collaborative editing room in the network.
 // It contains information about the room ID, host, connected peers, and chat history.
+// Rooms belonging to an organization can only be listed and joined by its members.
 type Room struct {
-	ID    string           `json:"id"`    // Unique identifier for the room
-	Host  *Peer            `json:"host"`  // Peer representing the host of the room
-	Peers map[string]*Peer `json:"peers"` // Map of connected peers in the room, keyed by peer ID
-	Chat  []string         `json:"chat"`  // Chat history within the room
+	ID          string           `json:"id"`                     // Unique identifier for the room
+	Host        *Peer            `json:"host"`                   // Peer representing the host of the room
+	Peers       map[string]*Peer `json:"peers"`                  // Map of connected peers in the room, keyed by peer ID
+	Chat        []*ChatMessage   `json:"chat"`                   // Chat history within the room, oldest first
+	Public      bool             `json:"public"`                 // Indicates whether the room is advertised on the LAN
+	OrgID       string           `json:"org_id,omitempty"`       // Organization owning the room, empty for personal rooms
+	WorkspaceID string           `json:"workspace_id,omitempty"` // Workspace of the organization the room edits, if any
 }
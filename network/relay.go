@@ -0,0 +1,360 @@
+package network
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// MessageRelayRegister is sent by a node to a relay to receive the messages addressed to it.
+const MessageRelayRegister = "relay-register"
+
+// directRetryInterval is the time after which a node reached through the relay is dialed directly again.
+const directRetryInterval = time.Minute
+
+// registrationSkew is the maximum difference between the time of a relay
+// registration and the clock of the relay.
+const registrationSkew = time.Minute
+
+// maxRelayRoutes is the maximum number of routes the traffic is accounted for.
+// The least recently used route is forgotten to account for a new one.
+const maxRelayRoutes = 1024
+
+// Delays between two attempts to register again with a relay after the connection dropped.
+const (
+	relayRetryMin = time.Second // Delay after the connection dropped
+	relayRetryMax = time.Minute // Delay the attempts back off to while the relay is unreachable
+)
+
+// RelayRegistration is the body of a MessageRelayRegister message. The MAC
+// proves the node knows the secret of the cluster; the time makes every
+// registration of an address newer than the previous ones, so registrations
+// cannot be replayed.
+type RelayRegistration struct {
+	Address string `json:"address"` // Advertised address, the sender of the message
+	Time    int64  `json:"time"`    // Time of the registration, in Unix nanoseconds
+	MAC     []byte `json:"mac"`     // HMAC-SHA256 of the address and time keyed with the cluster secret
+}
+
+// registrationMAC computes the MAC of a registration of the address at the time.
+func registrationMAC(secret []byte, address string, at int64) []byte {
+	mac := hmac.New(sha256.New, secret)
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(at))
+	mac.Write(timestamp[:])
+	mac.Write([]byte(address))
+	return mac.Sum(nil)
+}
+
+// RelayStats holds the traffic forwarded by a relay between two nodes.
+type RelayStats struct {
+	From     string `json:"from"`     // Host:Port address of the sending node
+	To       string `json:"to"`       // Host:Port address of the target node
+	Messages uint64 `json:"messages"` // Number of messages forwarded
+	Bytes    uint64 `json:"bytes"`    // Number of bytes forwarded, including framing overhead
+
+	lastAt time.Time // Time the last message was forwarded
+}
+
+// ConnectRelay registers the transport with the relay at relayAddress under the
+// advertised address, signing the registration with RelaySecret. Nodes that
+// cannot reach the advertised address directly send their messages to the
+// relay, which forwards them over this connection. The transport registers
+// again whenever the connection drops, until it is closed.
+// It also makes relayAddress the relay used by Send as a fallback.
+func (t *TCPTransport) ConnectRelay(relayAddress, advertised string) error {
+	if len(t.RelaySecret) == 0 {
+		return errors.New("a relay secret is required to register with a relay")
+	}
+	conn, err := t.registerWithRelay(relayAddress, advertised)
+	if err != nil {
+		return err
+	}
+
+	if t.msgs == nil {
+		t.msgs = make(chan *Message, 1024)
+	}
+	t.RelayAddress = relayAddress
+	go t.keepRelay(relayAddress, advertised, conn)
+	return nil
+}
+
+// registerWithRelay sends a registration of the advertised address to the relay
+// and returns the connection the relay forwards the messages over.
+func (t *TCPTransport) registerWithRelay(relayAddress, advertised string) (*tcpConn, error) {
+	conn, _, err := t.dial(relayAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixNano()
+	registration := RelayRegistration{Address: advertised, Time: now, MAC: registrationMAC(t.RelaySecret, advertised, now)}
+	data, err := encodeMessage(conn.codec, NewMessage(MessageRelayRegister, advertised, registration))
+	if err != nil {
+		return nil, err
+	}
+	conn.mutex.Lock()
+	err = writeFrame(conn, data)
+	conn.mutex.Unlock()
+	if err != nil {
+		t.dropConn(relayAddress, conn)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// keepRelay delivers the messages forwarded by the relay, registering again
+// with backoff whenever the connection drops, until the transport is closed.
+func (t *TCPTransport) keepRelay(relayAddress, advertised string, conn *tcpConn) {
+	for {
+		t.readRelayed(relayAddress, conn)
+
+		for delay := relayRetryMin; ; delay = min(2*delay, relayRetryMax) {
+			if t.isClosed() {
+				return
+			}
+			time.Sleep(delay)
+			if t.isClosed() {
+				return
+			}
+			var err error
+			if conn, err = t.registerWithRelay(relayAddress, advertised); err == nil {
+				break
+			}
+			log.Printf("Failed to register again with relay %s: %v", relayAddress, err)
+		}
+	}
+}
+
+// isClosed reports whether the transport was closed.
+func (t *TCPTransport) isClosed() bool {
+	t.connMutex.Lock()
+	defer t.connMutex.Unlock()
+	return t.closed
+}
+
+// RelayTraffic returns the traffic forwarded by this relay, sorted by route.
+func (t *TCPTransport) RelayTraffic() []RelayStats {
+	t.relayMutex.Lock()
+	defer t.relayMutex.Unlock()
+
+	stats := make([]RelayStats, 0, len(t.relayStats))
+	for _, s := range t.relayStats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].From != stats[j].From {
+			return stats[i].From < stats[j].From
+		}
+		return stats[i].To < stats[j].To
+	})
+	return stats
+}
+
+// readRelayed delivers the messages the relay forwards over the connection,
+// until it drops.
+func (t *TCPTransport) readRelayed(relayAddress string, conn *tcpConn) {
+	defer t.dropConn(relayAddress, conn)
+
+	for {
+		data, err := readFrame(conn)
+		if err != nil {
+			log.Printf("Lost connection to relay %s: %v", relayAddress, err)
+			return
+		}
+
+		msg, err := decodeMessage(conn.codec, data)
+		if err != nil {
+			log.Printf("Dropping malformed message from relay %s: %v", relayAddress, err)
+			continue
+		}
+		t.msgs <- msg
+	}
+}
+
+// sendViaRelay sends a message to the relay, which forwards it to the address.
+// The relay only forwards the messages sent over the connection registered by
+// ConnectRelay.
+func (t *TCPTransport) sendViaRelay(address string, msg *Message) error {
+	relayed := *msg
+	relayed.To = address
+	if _, err := t.sendDirect(t.RelayAddress, &relayed); err != nil {
+		return fmt.Errorf("relay %s: %w", t.RelayAddress, err)
+	}
+	return nil
+}
+
+// preferRelay reports whether the address recently failed to be dialed directly.
+func (t *TCPTransport) preferRelay(address string) bool {
+	t.relayMutex.Lock()
+	defer t.relayMutex.Unlock()
+
+	failedAt, ok := t.unreachable[address]
+	if !ok {
+		return false
+	}
+	if time.Since(failedAt) > directRetryInterval {
+		delete(t.unreachable, address)
+		return false
+	}
+	return true
+}
+
+// markUnreachable remembers that the address could not be dialed directly.
+func (t *TCPTransport) markUnreachable(address string) {
+	t.relayMutex.Lock()
+	defer t.relayMutex.Unlock()
+
+	if t.unreachable == nil {
+		t.unreachable = make(map[string]time.Time)
+	}
+	t.unreachable[address] = time.Now()
+}
+
+// registerRelayed makes the connection the route to the address the message
+// registers, once the registration is verified with the cluster secret.
+func (t *TCPTransport) registerRelayed(msg *Message, conn *tcpConn) error {
+	if !t.RelayEnabled {
+		return errors.New("relay mode is disabled")
+	}
+	if len(t.RelaySecret) == 0 {
+		return errors.New("the relay has no secret to verify registrations")
+	}
+	var registration RelayRegistration
+	if err := msg.Decode(&registration); err != nil {
+		return err
+	}
+	if registration.Address == "" || registration.Address != msg.From {
+		return errors.New("the registered address is not the sender")
+	}
+	now := time.Now()
+	at := time.Unix(0, registration.Time)
+	if at.Before(now.Add(-registrationSkew)) || at.After(now.Add(registrationSkew)) {
+		return errors.New("the registration is too old or in the future")
+	}
+	if !hmac.Equal(registration.MAC, registrationMAC(t.RelaySecret, registration.Address, registration.Time)) {
+		return errors.New("invalid registration MAC")
+	}
+
+	t.relayMutex.Lock()
+	defer t.relayMutex.Unlock()
+
+	if registration.Time <= t.registered[registration.Address] {
+		return errors.New("the registration was replayed")
+	}
+	if t.relayed == nil {
+		t.relayed = make(map[string]*tcpConn)
+	}
+	if t.registered == nil {
+		t.registered = make(map[string]int64)
+	}
+	// Registrations older than the skew are refused anyway, so their times can be forgotten
+	for address, registeredAt := range t.registered {
+		if time.Unix(0, registeredAt).Before(now.Add(-registrationSkew)) {
+			delete(t.registered, address)
+		}
+	}
+	t.registered[registration.Address] = registration.Time
+	t.relayed[registration.Address] = conn
+	return nil
+}
+
+// unregisterRelayed forgets the addresses routed through a closed connection.
+func (t *TCPTransport) unregisterRelayed(conn *tcpConn) {
+	t.relayMutex.Lock()
+	defer t.relayMutex.Unlock()
+
+	for address, c := range t.relayed {
+		if c == conn {
+			delete(t.relayed, address)
+		}
+	}
+}
+
+// forward relays a message received from the registered sender address to its
+// target, over the connection the target registered with or over a direct
+// connection if the target is a known member of the cluster. The message is
+// sent from the registered address whatever its sender claims, its payload is
+// forwarded untouched and the traffic is accounted per route.
+func (t *TCPTransport) forward(sender string, msg *Message) error {
+	if !t.RelayEnabled {
+		return fmt.Errorf("relay mode is disabled")
+	}
+	if sender == "" {
+		return fmt.Errorf("the sender is not registered with the relay")
+	}
+
+	forwarded := *msg
+	forwarded.From = sender
+	forwarded.To = "" // The target consumes the message, it must not be relayed again
+
+	t.relayMutex.Lock()
+	target, registered := t.relayed[msg.To]
+	t.relayMutex.Unlock()
+
+	var written int
+	if registered {
+		data, err := encodeMessage(target.codec, &forwarded)
+		if err != nil {
+			return err
+		}
+		target.mutex.Lock()
+		err = writeFrame(target, data)
+		target.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+		written = len(data)
+	} else {
+		if t.IsMember == nil || !t.IsMember(msg.To) {
+			return fmt.Errorf("%s is neither registered nor a member of the cluster", msg.To)
+		}
+		n, err := t.sendDirect(msg.To, &forwarded)
+		if err != nil {
+			return err
+		}
+		written = n
+	}
+
+	t.account(sender, msg.To, written)
+	return nil
+}
+
+// account records a forwarded frame, including its 4 byte length prefix.
+func (t *TCPTransport) account(from, to string, bytes int) {
+	t.relayMutex.Lock()
+	defer t.relayMutex.Unlock()
+
+	if t.relayStats == nil {
+		t.relayStats = make(map[string]*RelayStats)
+	}
+	route := from + "->" + to
+	stats, ok := t.relayStats[route]
+	if !ok {
+		if len(t.relayStats) >= maxRelayRoutes {
+			t.forgetOldestRoute()
+		}
+		stats = &RelayStats{From: from, To: to}
+		t.relayStats[route] = stats
+	}
+	stats.Messages++
+	stats.Bytes += uint64(bytes + 4)
+	stats.lastAt = time.Now()
+}
+
+// forgetOldestRoute drops the traffic of the least recently used route.
+// The caller must hold the relay mutex.
+func (t *TCPTransport) forgetOldestRoute() {
+	oldest := ""
+	for route, stats := range t.relayStats {
+		if oldest == "" || stats.lastAt.Before(t.relayStats[oldest].lastAt) {
+			oldest = route
+		}
+	}
+	delete(t.relayStats, oldest)
+}
@@ -0,0 +1,267 @@
+package network
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receive waits for the next message consumed by the transport.
+func receive(t *testing.T, transport *TCPTransport) *Message {
+	select {
+	case msg := <-transport.Consume():
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("message was not received")
+		return nil
+	}
+}
+
+// natAddress is an address that refuses connections, standing for a node behind NAT.
+const natAddress = "127.0.0.1:1"
+
+// testSecret is the cluster secret shared by the nodes of the tests.
+var testSecret = []byte("cluster secret")
+
+// registration returns a signed registration message of the address at the
+// time, as received from the network.
+func registration(t *testing.T, address string, at time.Time, secret []byte) *Message {
+	nanos := at.UnixNano()
+	msg := NewMessage(MessageRelayRegister, address, RelayRegistration{Address: address, Time: nanos, MAC: registrationMAC(secret, address, nanos)})
+	data, err := encodeMessage(MsgpackCodec{}, msg)
+	require.NoError(t, err)
+	received, err := decodeMessage(MsgpackCodec{}, data)
+	require.NoError(t, err)
+	return received
+}
+
+// newRelay starts a relay listening on a test address.
+func newRelay(t *testing.T) (*TCPTransport, string) {
+	relay := NewTCPTransport()
+	relay.RelayEnabled = true
+	relay.RelaySecret = testSecret
+	relayAddr := SetupTest(t)
+	require.NoError(t, relay.Listen(relayAddr))
+	t.Cleanup(func() { relay.Close() })
+	return relay, relayAddr
+}
+
+// newRelaySender returns a node registered with the relay under the address,
+// which the relay forwards the messages of.
+func newRelaySender(t *testing.T, relay *TCPTransport, relayAddr, address string) *TCPTransport {
+	sender := NewTCPTransport()
+	sender.RelaySecret = testSecret
+	require.NoError(t, sender.ConnectRelay(relayAddr, address))
+	t.Cleanup(func() { sender.Close() })
+	require.Eventually(t, func() bool {
+		return relayedConn(relay, address) != nil
+	}, 2*time.Second, 10*time.Millisecond)
+	return sender
+}
+
+// relayedConn returns the connection registered for the address on the relay.
+func relayedConn(relay *TCPTransport, address string) *tcpConn {
+	relay.relayMutex.Lock()
+	defer relay.relayMutex.Unlock()
+	return relay.relayed[address]
+}
+
+func TestRelay_FallbackFromDirectConnection(t *testing.T) {
+	relay, relayAddr := newRelay(t)
+
+	// The node behind NAT only has an outbound connection to the relay
+	natted := NewTCPTransport()
+	natted.Codecs = []Codec{JSONCodec{}}
+	natted.RelaySecret = testSecret
+	require.NoError(t, natted.ConnectRelay(relayAddr, natAddress))
+	defer natted.Close()
+
+	// Wait for the registration to reach the relay
+	require.Eventually(t, func() bool {
+		return relayedConn(relay, natAddress) != nil
+	}, 2*time.Second, 10*time.Millisecond)
+	sender := newRelaySender(t, relay, relayAddr, "sender:1")
+
+	// Direct dial fails, the message goes through the relay
+	edit := Edit{RoomID: "room1", PeerID: "peer1", Path: "main.go", Text: "hello"}
+	require.NoError(t, sender.Send(natAddress, NewMessage(MessageEdit, "sender:1", edit)))
+	assert.True(t, sender.preferRelay(natAddress))
+
+	msg := receive(t, natted)
+	assert.Equal(t, MessageEdit, msg.Type)
+	assert.Equal(t, "sender:1", msg.From)
+	assert.Empty(t, msg.To)
+
+	// The payload was encoded with msgpack by the sender and is decoded as such,
+	// even though the natted node negotiated JSON with the relay
+	assert.Equal(t, "msgpack", msg.Encoding)
+	var decoded Edit
+	require.NoError(t, msg.Decode(&decoded))
+	assert.Equal(t, edit, decoded)
+
+	// Subsequent messages go straight to the relay
+	require.NoError(t, sender.Send(natAddress, NewMessage(MessageEdit, "sender:1", edit)))
+	receive(t, natted)
+
+	stats := relay.RelayTraffic()
+	require.Len(t, stats, 1)
+	assert.Equal(t, "sender:1", stats[0].From)
+	assert.Equal(t, natAddress, stats[0].To)
+	assert.Equal(t, uint64(2), stats[0].Messages)
+	assert.NotZero(t, stats[0].Bytes)
+}
+
+func TestRelay_ForwardsDirectlyToUnregisteredMembers(t *testing.T) {
+	relay, relayAddr := newRelay(t)
+
+	target := NewTCPTransport()
+	require.NoError(t, target.Listen("127.0.0.1:0"))
+	targetAddr := target.Listener.Addr().String()
+	defer target.Close()
+	relay.IsMember = func(address string) bool { return address == targetAddr }
+	sender := newRelaySender(t, relay, relayAddr, "sender:1")
+
+	// The sender cannot reach the target but the relay can
+	require.NoError(t, sender.sendViaRelay(targetAddr, NewMessage(MessageEdit, "sender:1", Edit{Text: "hi"})))
+	msg := receive(t, target)
+	assert.Equal(t, MessageEdit, msg.Type)
+	assert.Len(t, relay.RelayTraffic(), 1)
+}
+
+func TestRelay_RefusesUnknownTargets(t *testing.T) {
+	relay, _ := newRelay(t)
+
+	// Without membership, the relay forwards to registered nodes only
+	assert.Error(t, relay.forward("a:1", &Message{Type: MessageEdit, From: "a:1", To: "10.0.0.1:22"}))
+
+	relay.IsMember = func(string) bool { return false }
+	assert.Error(t, relay.forward("a:1", &Message{Type: MessageEdit, From: "a:1", To: "10.0.0.1:22"}))
+	assert.Empty(t, relay.RelayTraffic())
+}
+
+func TestRelay_AuthenticatesRegistrations(t *testing.T) {
+	relay, _ := newRelay(t)
+	now := time.Now()
+	conn := &tcpConn{}
+
+	// Wrong secret, registering another address than the sender, stale registration
+	assert.Error(t, relay.registerRelayed(registration(t, "b:1", now, []byte("guess")), conn))
+	spoofed := registration(t, "b:1", now, testSecret)
+	spoofed.From = "c:1"
+	assert.Error(t, relay.registerRelayed(spoofed, conn))
+	assert.Error(t, relay.registerRelayed(registration(t, "b:1", now.Add(-2*registrationSkew), testSecret), conn))
+	assert.Error(t, relay.registerRelayed(&Message{Type: MessageRelayRegister, From: "b:1"}, conn))
+	assert.Nil(t, relayedConn(relay, "b:1"))
+
+	valid := registration(t, "b:1", now, testSecret)
+	require.NoError(t, relay.registerRelayed(valid, conn))
+	assert.Same(t, conn, relayedConn(relay, "b:1"))
+
+	// A captured registration cannot be replayed to take over the route
+	other := &tcpConn{}
+	assert.Error(t, relay.registerRelayed(valid, other))
+	assert.Same(t, conn, relayedConn(relay, "b:1"))
+
+	require.NoError(t, relay.registerRelayed(registration(t, "b:1", now.Add(time.Millisecond), testSecret), other))
+	assert.Same(t, other, relayedConn(relay, "b:1"))
+}
+
+func TestRelay_RegistersAgainAfterDrop(t *testing.T) {
+	relay, relayAddr := newRelay(t)
+
+	natted := NewTCPTransport()
+	natted.RelaySecret = testSecret
+	require.NoError(t, natted.ConnectRelay(relayAddr, natAddress))
+	defer natted.Close()
+
+	require.Eventually(t, func() bool {
+		return relayedConn(relay, natAddress) != nil
+	}, 2*time.Second, 10*time.Millisecond)
+	first := relayedConn(relay, natAddress)
+	first.Close()
+
+	require.Eventually(t, func() bool {
+		conn := relayedConn(relay, natAddress)
+		return conn != nil && conn != first
+	}, 5*time.Second, 50*time.Millisecond)
+
+	sender := newRelaySender(t, relay, relayAddr, "sender:1")
+	require.NoError(t, sender.sendViaRelay(natAddress, NewMessage(MessageEdit, "sender:1", Edit{Text: "hello"})))
+	assert.Equal(t, "sender:1", receive(t, natted).From)
+}
+
+func TestRelay_ForwardsForRegisteredSendersOnly(t *testing.T) {
+	relay, relayAddr := newRelay(t)
+
+	natted := NewTCPTransport()
+	natted.RelaySecret = testSecret
+	require.NoError(t, natted.ConnectRelay(relayAddr, natAddress))
+	defer natted.Close()
+	require.Eventually(t, func() bool {
+		return relayedConn(relay, natAddress) != nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// Connections that did not register cannot send through the relay
+	stranger := NewTCPTransport()
+	stranger.RelayAddress = relayAddr
+	defer stranger.Close()
+	require.NoError(t, stranger.sendViaRelay(natAddress, NewMessage(MessageEdit, "sender:1", Edit{Text: "forged"})))
+	assert.Error(t, relay.forward("", &Message{Type: MessageEdit, From: "sender:1", To: natAddress}))
+
+	// Registered senders cannot claim another address
+	sender := newRelaySender(t, relay, relayAddr, "sender:1")
+	require.NoError(t, sender.sendViaRelay(natAddress, NewMessage(MessageEdit, "other:1", Edit{Text: "hello"})))
+	msg := receive(t, natted)
+	assert.Equal(t, "sender:1", msg.From)
+	var edit Edit
+	require.NoError(t, msg.Decode(&edit))
+	assert.Equal(t, "hello", edit.Text)
+
+	stats := relay.RelayTraffic()
+	require.Len(t, stats, 1)
+	assert.Equal(t, "sender:1", stats[0].From)
+}
+
+func TestRelay_BoundsAccountedRoutes(t *testing.T) {
+	relay, _ := newRelay(t)
+	for i := 0; i < maxRelayRoutes; i++ {
+		relay.account(fmt.Sprintf("node%d:1", i), "target:1", 10)
+	}
+	relay.relayStats["node1:1->target:1"].lastAt = time.Now().Add(-time.Hour)
+
+	// The least recently used route makes room for new ones
+	relay.account("new:1", "target:1", 10)
+	stats := relay.RelayTraffic()
+	assert.Len(t, stats, maxRelayRoutes)
+	routes := map[string]bool{}
+	for _, route := range stats {
+		routes[route.From] = true
+	}
+	assert.True(t, routes["node0:1"])
+	assert.True(t, routes["new:1"])
+	assert.False(t, routes["node1:1"])
+}
+
+func TestRelay_ConnectRequiresSecret(t *testing.T) {
+	node := NewTCPTransport()
+	assert.Error(t, node.ConnectRelay("127.0.0.1:1", natAddress))
+}
+
+func TestRelay_Disabled(t *testing.T) {
+	node := NewTCPTransport()
+	assert.Error(t, node.forward("a:1", &Message{Type: MessageEdit, From: "a:1", To: "b:1"}))
+
+	node.RelaySecret = testSecret
+	assert.Error(t, node.registerRelayed(registration(t, "b:1", time.Now(), testSecret), &tcpConn{}))
+	assert.Empty(t, node.relayed)
+}
+
+func TestRelay_NoRelayConfigured(t *testing.T) {
+	sender := NewTCPTransport()
+	err := sender.Send(natAddress, NewMessage(MessageEdit, "sender:1", Edit{}))
+	assert.Error(t, err)
+	assert.False(t, sender.preferRelay(natAddress))
+}
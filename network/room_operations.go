@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 )
 
 var _ HandleRoom = &TCPTransport{}
@@ -15,12 +16,15 @@ var _ HandleRoom = &TCPTransport{}
 // It returns the room ID and an error if creating the room fails.
 func (t *TCPTransport) CreateRoom(host *Peer) (string, error) {
 	roomID := generateRoomID() // Generate a unique room ID
+	if roomID == "" {
+		return "", errors.New("failed to generate room ID")
+	}
 
 	room := &Room{
 		ID:    roomID,
 		Host:  host,
 		Peers: make(map[string]*Peer),
-		Chat:  []string{},
+		Chat:  []*ChatMessage{},
 	}
 
 	if host.ID == "" || host.Name == "" || host.Address == "" || host.Email == "" {
@@ -40,7 +44,7 @@ func (t *TCPTransport) CreateRoom(host *Peer) (string, error) {
 // It generates 8 random bytes and converts them to a hexadecimal string.
 func generateRoomID() string {
 	bytes := make([]byte, 8)
-	if _, err := rand.Read(bytes); err != nil {
+	if _, err := io.ReadFull(rand.Reader, bytes); err != nil {
 		return ""
 	}
 	return hex.EncodeToString(bytes)
@@ -100,6 +104,95 @@ func (t *TCPTransport) LeaveRoom(roomID string, peerID string) error {
 	return nil
 }
 
+// SetRoomVisibility marks a room as public or private.
+// Public rooms are advertised to the local network by the Discovery service.
+// It returns an error if the room doesn't exist.
+func (t *TCPTransport) SetRoomVisibility(roomID string, public bool) error {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	room, ok := t.Rooms[roomID]
+	if !ok {
+		return fmt.Errorf("room %s does not exist", roomID)
+	}
+	room.Public = public
+	return nil
+}
+
+// ApplyMemberState updates the rooms after the membership layer detected a state change.
+// Peers reachable at the member's address are marked online only while the member is alive,
+// and are removed from every room once the member is declared dead.
+// Rooms left without peers are deleted, as in LeaveRoom.
+func (t *TCPTransport) ApplyMemberState(member Member) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	for roomID, room := range t.Rooms {
+		for peerID, peer := range room.Peers {
+			if peer.Address != member.Address {
+				continue
+			}
+			peer.Online = member.State == MemberAlive
+			if member.State == MemberDead {
+				delete(room.Peers, peerID)
+				fmt.Printf("Peer %s removed from room %s: %s is dead\n", peerID, roomID, member.Address)
+			}
+		}
+		if len(room.Peers) == 0 {
+			delete(t.Rooms, roomID)
+		}
+	}
+}
+
+// LeaveOrgRooms removes the peer from every room of the organization, once it
+// is no longer a member of it. Rooms left without peers are deleted, as in LeaveRoom.
+func (t *TCPTransport) LeaveOrgRooms(orgID, peerID string) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	for roomID, room := range t.Rooms {
+		if room.OrgID != orgID {
+			continue
+		}
+		if _, ok := room.Peers[peerID]; !ok {
+			continue
+		}
+		delete(room.Peers, peerID)
+		fmt.Printf("Peer %s removed from room %s: no longer a member of %s\n", peerID, roomID, orgID)
+		if len(room.Peers) == 0 {
+			delete(t.Rooms, roomID)
+		}
+	}
+}
+
+// SetRoomOrg makes a room belong to an organization, optionally editing one of its workspaces.
+// It returns an error if the room doesn't exist.
+func (t *TCPTransport) SetRoomOrg(roomID, orgID, workspaceID string) error {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	room, ok := t.Rooms[roomID]
+	if !ok {
+		return fmt.Errorf("room %s does not exist", roomID)
+	}
+	room.OrgID = orgID
+	room.WorkspaceID = workspaceID
+	return nil
+}
+
+// GetRoom returns the room with the given ID.
+// It returns an error if the room doesn't exist.
+func (t *TCPTransport) GetRoom(roomID string) (*Room, error) {
+	t.Mutex.Lock()
+	defer t.Mutex.Unlock()
+
+	room, ok := t.Rooms[roomID]
+	if !ok {
+		return nil, fmt.Errorf("room %s does not exist", roomID)
+	}
+	return room, nil
+}
+
 func (t *TCPTransport) GetAllRooms() map[string]*Room {
 	return t.Rooms
 }
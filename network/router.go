@@ -0,0 +1,78 @@
+package network
+
+import (
+	"log"
+	"sync"
+)
+
+// routerBuffer is the number of unhandled messages buffered for Consume before
+// new ones are dropped.
+const routerBuffer = 1024
+
+// Router reads the messages of a Transport and dispatches them to the handler
+// registered for their type, so several layers can share the transport.
+// Messages of types without a handler are passed on through Consume.
+type Router struct {
+	Transport Transport // Transport the messages are read from
+
+	mutex     sync.RWMutex
+	handlers  map[string]func(*Message) error // Handlers, keyed by message type
+	unhandled chan *Message                   // Messages of types without a handler
+}
+
+// NewRouter creates a router reading the messages of the transport.
+func NewRouter(transport Transport) *Router {
+	return &Router{
+		Transport: transport,
+		handlers:  make(map[string]func(*Message) error),
+		unhandled: make(chan *Message, routerBuffer),
+	}
+}
+
+// Handle registers the handler of the messages of the type, replacing any previous one.
+// Errors returned by the handler are logged and the message dropped.
+func (r *Router) Handle(msgType string, handler func(*Message) error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.handlers[msgType] = handler
+}
+
+// Consume returns a read-only channel of the messages no handler is registered for.
+func (r *Router) Consume() <-chan *Message {
+	return r.unhandled
+}
+
+// Run dispatches the messages of the transport until done is closed or the
+// transport stops delivering messages.
+func (r *Router) Run(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case msg, ok := <-r.Transport.Consume():
+			if !ok {
+				return
+			}
+			r.dispatch(msg)
+		}
+	}
+}
+
+// dispatch hands the message to the handler of its type, or to Consume.
+func (r *Router) dispatch(msg *Message) {
+	r.mutex.RLock()
+	handler, ok := r.handlers[msg.Type]
+	r.mutex.RUnlock()
+
+	if !ok {
+		select {
+		case r.unhandled <- msg:
+		default:
+			log.Printf("router: dropping %s message from %s: nobody is consuming", msg.Type, msg.From)
+		}
+		return
+	}
+	if err := handler(msg); err != nil {
+		log.Printf("router: dropping %s message from %s: %v", msg.Type, msg.From, err)
+	}
+}
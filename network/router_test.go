@@ -0,0 +1,44 @@
+package network
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter_Dispatch(t *testing.T) {
+	transport := &memoryTransport{msgs: make(chan *Message, 4)}
+	router := NewRouter(transport)
+	gossip := make(chan *Message, 2)
+	router.Handle(MessageGossip, func(msg *Message) error {
+		gossip <- msg
+		return errors.New("handler errors are only logged")
+	})
+	done := make(chan struct{})
+	defer close(done)
+	go router.Run(done)
+
+	transport.msgs <- NewMessage(MessageGossip, "a:1", []Member{})
+	transport.msgs <- NewMessage("edit", "b:1", "payload")
+	transport.msgs <- NewMessage(MessageGossip, "c:1", []Member{})
+
+	// Other message types are not dropped but left to the other consumers
+	select {
+	case msg := <-router.Consume():
+		assert.Equal(t, "edit", msg.Type)
+		assert.Equal(t, "b:1", msg.From)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the unhandled message was not passed on")
+	}
+	for _, from := range []string{"a:1", "c:1"} {
+		select {
+		case msg := <-gossip:
+			require.Equal(t, from, msg.From)
+		case <-time.After(2 * time.Second):
+			t.Fatal("the gossip message was not dispatched")
+		}
+	}
+}
@@ -1,16 +1,51 @@
 package network
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net"
 	"sync"
+	"time"
 )
 
+// dialTimeout bounds the time spent connecting to a remote node.
+const dialTimeout = 5 * time.Second
+
 // TCPTransport implements the Transport interface using TCP.
 // It manages the network transport layer responsible for facilitating communication between peers.
 type TCPTransport struct {
 	Listener net.Listener     // Listener for accepting incoming connections
 	Mutex    sync.Mutex       // Mutex for safe access to the rooms map
 	Rooms    map[string]*Room // Map to store rooms in the network, keyed by room ID
+	Codecs   []Codec          // Codecs offered during the handshake, in order of preference
+
+	RelayEnabled bool   // Forward messages addressed to other nodes, acting as a relay
+	RelayAddress string // Relay used when a node cannot be reached directly
+	RelaySecret  []byte // Secret shared by the nodes of the cluster, authenticating relay registrations
+
+	// IsMember reports whether the address is a known member of the cluster, which
+	// the relay may forward messages to directly. If nil, the relay only forwards
+	// to the nodes registered with it.
+	IsMember func(address string) bool
+
+	connMutex sync.Mutex          // Mutex for safe access to the connections map
+	conns     map[string]*tcpConn // Outbound connections, keyed by remote address
+	closed    bool                // Indicates whether Close was called, so the relay is not reconnected
+	msgs      chan *Message       // Messages received from remote nodes
+
+	relayMutex  sync.Mutex             // Mutex for safe access to the relay state
+	relayed     map[string]*tcpConn    // Connections of the nodes registered with this relay, keyed by advertised address
+	registered  map[string]int64       // Time of the last registration accepted for every advertised address, in Unix nanoseconds
+	relayStats  map[string]*RelayStats // Traffic forwarded by this relay, keyed by route
+	unreachable map[string]time.Time   // Nodes reached through the relay, with the time of the failed direct attempt
+}
+
+// tcpConn is a connection to a remote node.
+type tcpConn struct {
+	net.Conn
+	codec Codec      // Codec negotiated during the handshake
+	mutex sync.Mutex // Serializes writes to the connection
 }
 
 var _ Transport = (*TCPTransport)(nil)
@@ -19,12 +54,16 @@ var _ Transport = (*TCPTransport)(nil)
 // It initializes the Rooms map to store rooms in the network.
 func NewTCPTransport() *TCPTransport {
 	return &TCPTransport{
-		Rooms: make(map[string]*Room),
+		Rooms:  make(map[string]*Room),
+		Codecs: DefaultCodecs,
+		conns:  make(map[string]*tcpConn),
+		msgs:   make(chan *Message, 1024),
 	}
 }
 
 // Listen starts listening for incoming TCP connections on the specified address.
-// It initializes the network listener if not already initialized.
+// It initializes the network listener if not already initialized and accepts
+// connections in the background.
 func (t *TCPTransport) Listen(address string) error {
 	if t.Listener != nil {
 		return nil // Listener already started
@@ -34,13 +73,26 @@ func (t *TCPTransport) Listen(address string) error {
 	if err != nil {
 		return err
 	}
+	if t.msgs == nil {
+		t.msgs = make(chan *Message, 1024)
+	}
 	t.Listener = listener
+
+	go t.acceptLoop(listener)
 	return nil
 }
 
 // Close closes the TCP transport, releasing any associated resources.
-// It closes the network listener if it's initialized.
+// It closes the network listener if it's initialized and every outbound connection.
 func (t *TCPTransport) Close() error {
+	t.connMutex.Lock()
+	t.closed = true
+	for address, conn := range t.conns {
+		conn.Close()
+		delete(t.conns, address)
+	}
+	t.connMutex.Unlock()
+
 	if t.Listener == nil {
 		return nil // Listener already closed
 	}
@@ -52,3 +104,203 @@ func (t *TCPTransport) Close() error {
 	t.Listener = nil // Reset the listener
 	return nil
 }
+
+// Send delivers a message to the node listening on the specified address.
+// If the node cannot be dialed and a relay is configured, the message is
+// sent through the relay instead.
+func (t *TCPTransport) Send(address string, msg *Message) error {
+	if t.RelayAddress == "" || address == t.RelayAddress {
+		_, err := t.sendDirect(address, msg)
+		return err
+	}
+
+	if t.preferRelay(address) {
+		return t.sendViaRelay(address, msg)
+	}
+	_, err := t.sendDirect(address, msg)
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		t.markUnreachable(address)
+		return t.sendViaRelay(address, msg)
+	}
+	return err
+}
+
+// sendDirect delivers a message over a direct connection to the address and
+// returns the number of bytes written. The message is encoded with the codec
+// negotiated for the connection. Connections are reused between calls and
+// re-dialed once if the cached connection turns out to be broken.
+func (t *TCPTransport) sendDirect(address string, msg *Message) (int, error) {
+	for attempt := 0; ; attempt++ {
+		conn, reused, err := t.dial(address)
+		if err != nil {
+			return 0, err
+		}
+
+		data, err := encodeMessage(conn.codec, msg)
+		if err != nil {
+			return 0, err
+		}
+
+		conn.mutex.Lock()
+		err = writeFrame(conn, data)
+		conn.mutex.Unlock()
+		if err == nil {
+			return len(data), nil
+		}
+
+		t.dropConn(address, conn)
+		if !reused || attempt > 0 {
+			return 0, err
+		}
+	}
+}
+
+// Consume returns a read-only channel of the messages received from remote nodes.
+func (t *TCPTransport) Consume() <-chan *Message {
+	return t.msgs
+}
+
+// dial returns the cached connection to the address or opens a new one.
+// It reports whether the returned connection was reused.
+func (t *TCPTransport) dial(address string) (*tcpConn, bool, error) {
+	t.connMutex.Lock()
+	defer t.connMutex.Unlock()
+
+	if t.conns == nil {
+		t.conns = make(map[string]*tcpConn)
+	}
+	if conn, ok := t.conns[address]; ok {
+		return conn, true, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		return nil, false, err
+	}
+	codec, err := t.offerCodecs(conn)
+	if err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("handshake with %s failed: %w", address, err)
+	}
+	c := &tcpConn{Conn: conn, codec: codec}
+	t.conns[address] = c
+	return c, false, nil
+}
+
+// supportedCodecs returns the codecs of the transport, or the default ones if none are set.
+func (t *TCPTransport) supportedCodecs() []Codec {
+	if len(t.Codecs) == 0 {
+		return DefaultCodecs
+	}
+	return t.Codecs
+}
+
+// offerCodecs performs the client side of the handshake.
+// It sends the supported codecs and returns the one picked by the remote node.
+func (t *TCPTransport) offerCodecs(conn net.Conn) (Codec, error) {
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := writeFrame(conn, []byte(codecOffer(t.supportedCodecs()))); err != nil {
+		return nil, err
+	}
+	reply, err := readFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	return codecByName(t.supportedCodecs(), string(reply))
+}
+
+// acceptCodecs performs the server side of the handshake.
+// It reads the codecs offered by the remote node and replies with the one picked,
+// or with an empty name if there is no common codec.
+func (t *TCPTransport) acceptCodecs(conn net.Conn) (Codec, error) {
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	offer, err := readFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := negotiateCodec(t.supportedCodecs(), string(offer))
+	if err != nil {
+		writeFrame(conn, nil)
+		return nil, err
+	}
+	if err := writeFrame(conn, []byte(codec.Name())); err != nil {
+		return nil, err
+	}
+	return codec, nil
+}
+
+// dropConn closes a broken outbound connection and forgets it.
+func (t *TCPTransport) dropConn(address string, conn *tcpConn) {
+	t.connMutex.Lock()
+	defer t.connMutex.Unlock()
+
+	conn.Close()
+	if t.conns[address] == conn {
+		delete(t.conns, address)
+	}
+}
+
+// acceptLoop accepts incoming connections until the listener is closed.
+func (t *TCPTransport) acceptLoop(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("TCP accept error: %v", err)
+			continue
+		}
+		go t.handleConn(conn)
+	}
+}
+
+// handleConn negotiates the codec of an incoming connection, then reads
+// messages from it and forwards them to the consume channel.
+// Relay registrations and messages addressed to other nodes are handled by the
+// relay, which only forwards the messages of registered connections.
+func (t *TCPTransport) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	codec, err := t.acceptCodecs(conn)
+	if err != nil {
+		log.Printf("Handshake with %s failed: %v", conn.RemoteAddr(), err)
+		return
+	}
+	c := &tcpConn{Conn: conn, codec: codec}
+	defer t.unregisterRelayed(c)
+	sender := "" // Address the connection registered with the relay, the only one it may send from
+
+	for {
+		data, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+
+		msg, err := decodeMessage(codec, data)
+		if err != nil {
+			log.Printf("Dropping malformed message from %s: %v", conn.RemoteAddr(), err)
+			continue
+		}
+
+		switch {
+		case msg.Type == MessageRelayRegister:
+			if err := t.registerRelayed(msg, c); err != nil {
+				log.Printf("Rejecting relay registration of %s from %s: %v", msg.From, conn.RemoteAddr(), err)
+				continue
+			}
+			sender = msg.From
+		case msg.To != "":
+			if err := t.forward(sender, msg); err != nil {
+				log.Printf("Failed to relay message from %s to %s: %v", msg.From, msg.To, err)
+			}
+		default:
+			t.msgs <- msg
+		}
+	}
+}
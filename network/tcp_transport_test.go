@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -217,6 +218,32 @@ func TestLeaveRoom(t *testing.T) {
 	}
 }
 
+func TestLeaveOrgRooms(t *testing.T) {
+	transport := NewTCPTransport()
+	host := &Peer{ID: "host1", Name: "Host", Email: "host@example.com", Address: "host:1"}
+	orgRoom, err := transport.CreateRoom(host)
+	assert.NoError(t, err)
+	assert.NoError(t, transport.SetRoomOrg(orgRoom, "org1", ""))
+	otherRoom, err := transport.CreateRoom(host)
+	assert.NoError(t, err)
+	assert.NoError(t, transport.SetRoomOrg(otherRoom, "org2", ""))
+	personalRoom, err := transport.CreateRoom(host)
+	assert.NoError(t, err)
+	for _, roomID := range []string{orgRoom, otherRoom, personalRoom} {
+		assert.NoError(t, transport.JoinRoom(roomID, &Peer{ID: "peer1"}))
+	}
+
+	// Only the rooms of the organization are left
+	transport.LeaveOrgRooms("org1", "peer1")
+	assert.NotContains(t, transport.Rooms[orgRoom].Peers, "peer1")
+	assert.Contains(t, transport.Rooms[otherRoom].Peers, "peer1")
+	assert.Contains(t, transport.Rooms[personalRoom].Peers, "peer1")
+
+	// Rooms left empty are deleted
+	transport.LeaveOrgRooms("org1", "host1")
+	assert.NotContains(t, transport.Rooms, orgRoom)
+}
+
 func TestGetAllRooms(t *testing.T) {
 	// Create a new instance of TCPTransport
 	tcpTransport := NewTCPTransport()
@@ -226,13 +253,13 @@ func TestGetAllRooms(t *testing.T) {
 		ID:    "room1",
 		Host:  &Peer{ID: "host1"},
 		Peers: map[string]*Peer{},
-		Chat:  []string{},
+		Chat:  []*ChatMessage{},
 	}
 	room2 := &Room{
 		ID:    "room2",
 		Host:  &Peer{ID: "host2"},
 		Peers: map[string]*Peer{},
-		Chat:  []string{},
+		Chat:  []*ChatMessage{},
 	}
 
 	// Add the rooms to the TCPTransport
@@ -260,3 +287,52 @@ func TestCreateRoomError(t *testing.T) {
 	assert.Empty(t, roomID)
 
 }
+
+func TestTCPTransport_SendAndConsume(t *testing.T) {
+	receiver := NewTCPTransport()
+	addr := SetupTest(t)
+	assert.NoError(t, receiver.Listen(addr))
+	defer receiver.Close()
+
+	sender := NewTCPTransport()
+	defer sender.Close()
+
+	edit := Edit{RoomID: "room1", PeerID: "peer1", Path: "main.go", Offset: 4, Text: "hello", Version: 2}
+	msg := NewMessage(MessageEdit, "sender:1", edit)
+	assert.NoError(t, sender.Send(addr, msg))
+	assert.NoError(t, sender.Send(addr, msg)) // Reuses the cached connection
+
+	for i := 0; i < 2; i++ {
+		select {
+		case received := <-receiver.Consume():
+			assert.Equal(t, MessageEdit, received.Type)
+			assert.Equal(t, "sender:1", received.From)
+			var decoded Edit
+			assert.NoError(t, received.Decode(&decoded))
+			assert.Equal(t, edit, decoded)
+		case <-time.After(2 * time.Second):
+			t.Fatal("message was not received")
+		}
+	}
+}
+
+func TestTCPTransport_SendError(t *testing.T) {
+	sender := NewTCPTransport()
+	err := sender.Send("invalid_address", &Message{Type: MessageGossip})
+	assert.Error(t, err)
+}
+
+func TestTCPTransport_HandshakeWithoutCommonCodec(t *testing.T) {
+	receiver := NewTCPTransport()
+	receiver.Codecs = []Codec{JSONCodec{}}
+	addr := SetupTest(t)
+	assert.NoError(t, receiver.Listen(addr))
+	defer receiver.Close()
+
+	sender := NewTCPTransport()
+	sender.Codecs = []Codec{MsgpackCodec{}}
+	defer sender.Close()
+
+	err := sender.Send(addr, NewMessage(MessageEdit, "sender:1", Edit{}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// BackoffConfig configures a Backoff.
+type BackoffConfig struct {
+	FreeAttempts     int           // Failures allowed before attempts are delayed
+	BaseDelay        time.Duration // Delay after the first failure past the free attempts, doubled on every failure
+	MaxDelay         time.Duration // Longest delay between two attempts
+	LockoutThreshold int           // Failures after which the key is locked out
+	LockoutDuration  time.Duration // Time a locked out key stays locked
+	ResetAfter       time.Duration // Time without failure after which the failures are forgotten
+}
+
+// DefaultBackoffConfig returns the configuration used for logins: three free
+// attempts, then delays doubling from one second up to a minute, and a 15 minute
+// lockout after ten failures.
+func DefaultBackoffConfig() BackoffConfig {
+	return BackoffConfig{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+		ResetAfter:       time.Hour,
+	}
+}
+
+// Backoff tracks the failed attempts of every key, such as an account or an IP,
+// and delays the next attempts exponentially until the key is locked out.
+type Backoff struct {
+	Config BackoffConfig
+
+	mutex     sync.Mutex
+	failures  map[string]*failures // Failed attempts, keyed by key
+	lastSweep time.Time            // Time the expired failures were last dropped
+	now       func() time.Time
+}
+
+// failures holds the failed attempts of a single key.
+type failures struct {
+	count       int       // Consecutive failed attempts
+	last        time.Time // Time of the last failure
+	lockedUntil time.Time // Time the lockout ends, zero if not locked out
+}
+
+// NewBackoff creates a backoff tracker with the configuration.
+func NewBackoff(config BackoffConfig) *Backoff {
+	return &Backoff{
+		Config:   config,
+		failures: make(map[string]*failures),
+		now:      time.Now,
+	}
+}
+
+// Check returns how long the key must wait before its next attempt, zero if it
+// may try now, and whether the key is locked out.
+func (b *Backoff) Check(key string) (time.Duration, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.now()
+	f := b.get(key, now)
+	if f == nil {
+		return 0, false
+	}
+	if now.Before(f.lockedUntil) {
+		return f.lockedUntil.Sub(now), true
+	}
+	if wait := f.last.Add(b.delay(f.count)).Sub(now); wait > 0 {
+		return wait, false
+	}
+	return 0, false
+}
+
+// Failure records a failed attempt of the key.
+// It returns true if the failure locked the key out.
+func (b *Backoff) Failure(key string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.now()
+	b.sweep(now)
+	f := b.get(key, now)
+	if f == nil {
+		f = &failures{}
+		b.failures[key] = f
+	}
+	f.count++
+	f.last = now
+	if f.count >= b.Config.LockoutThreshold && f.lockedUntil.IsZero() {
+		f.lockedUntil = now.Add(b.Config.LockoutDuration)
+		return true
+	}
+	return false
+}
+
+// Success forgets the failed attempts of the key.
+func (b *Backoff) Success(key string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delete(b.failures, key)
+}
+
+// get returns the failures of the key, forgetting them once the lockout is
+// over or the key stopped failing for a while. The caller must hold the mutex.
+func (b *Backoff) get(key string, now time.Time) *failures {
+	f, ok := b.failures[key]
+	if !ok {
+		return nil
+	}
+	if b.expired(f, now) {
+		delete(b.failures, key)
+		return nil
+	}
+	return f
+}
+
+// sweep drops the failures of the keys that stopped failing, which would
+// otherwise be kept until the key is used again.
+// The caller must hold the mutex.
+func (b *Backoff) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < idleTimeout {
+		return
+	}
+	b.lastSweep = now
+	for key, f := range b.failures {
+		if b.expired(f, now) {
+			delete(b.failures, key)
+		}
+	}
+}
+
+// expired reports whether the failures can be forgotten: the lockout is over
+// or the key stopped failing for a while.
+func (b *Backoff) expired(f *failures, now time.Time) bool {
+	lockoutOver := !f.lockedUntil.IsZero() && !now.Before(f.lockedUntil)
+	return lockoutOver || now.Sub(f.last) > b.Config.ResetAfter
+}
+
+// delay returns the delay required after count failures.
+func (b *Backoff) delay(count int) time.Duration {
+	if count <= b.Config.FreeAttempts {
+		return 0
+	}
+	delay := b.Config.BaseDelay
+	for i := b.Config.FreeAttempts + 1; i < count && delay < b.Config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > b.Config.MaxDelay {
+		delay = b.Config.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBackoff(now *time.Time) *Backoff {
+	backoff := NewBackoff(BackoffConfig{
+		FreeAttempts:     2,
+		BaseDelay:        time.Second,
+		MaxDelay:         4 * time.Second,
+		LockoutThreshold: 6,
+		LockoutDuration:  time.Minute,
+		ResetAfter:       time.Hour,
+	})
+	backoff.now = func() time.Time { return *now }
+	return backoff
+}
+
+func TestBackoffDelays(t *testing.T) {
+	now := time.Now()
+	backoff := newTestBackoff(&now)
+
+	// The free attempts are not delayed
+	assert.False(t, backoff.Failure("a"))
+	assert.False(t, backoff.Failure("a"))
+	wait, locked := backoff.Check("a")
+	assert.Zero(t, wait)
+	assert.False(t, locked)
+
+	// The delay doubles on every failure, up to the maximum
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		assert.False(t, backoff.Failure("a"))
+		wait, locked = backoff.Check("a")
+		assert.Equal(t, expected, wait)
+		assert.False(t, locked)
+	}
+	now = now.Add(4 * time.Second)
+	wait, _ = backoff.Check("a")
+	assert.Zero(t, wait)
+
+	// Other keys are not affected
+	wait, _ = backoff.Check("b")
+	assert.Zero(t, wait)
+}
+
+func TestBackoffLockout(t *testing.T) {
+	now := time.Now()
+	backoff := newTestBackoff(&now)
+
+	for i := 0; i < 5; i++ {
+		assert.False(t, backoff.Failure("a"))
+	}
+	// The failure reaching the threshold reports the lockout, once
+	assert.True(t, backoff.Failure("a"))
+	assert.False(t, backoff.Failure("a"))
+	wait, locked := backoff.Check("a")
+	assert.Equal(t, time.Minute, wait)
+	assert.True(t, locked)
+
+	// The failures are forgotten once the lockout is over
+	now = now.Add(time.Minute)
+	wait, locked = backoff.Check("a")
+	assert.Zero(t, wait)
+	assert.False(t, locked)
+	assert.False(t, backoff.Failure("a"))
+}
+
+func TestBackoffReset(t *testing.T) {
+	now := time.Now()
+	backoff := newTestBackoff(&now)
+
+	for i := 0; i < 4; i++ {
+		backoff.Failure("a")
+	}
+	backoff.Success("a")
+	wait, _ := backoff.Check("a")
+	assert.Zero(t, wait)
+
+	// Failures are also forgotten after a while without failure
+	for i := 0; i < 4; i++ {
+		backoff.Failure("b")
+	}
+	now = now.Add(2 * time.Hour)
+	wait, _ = backoff.Check("b")
+	assert.Zero(t, wait)
+}
+
+func TestBackoffDropsExpiredFailures(t *testing.T) {
+	now := time.Now()
+	backoff := newTestBackoff(&now)
+
+	// Keys never used again, like unknown account names, are dropped too
+	backoff.Failure("a")
+	now = now.Add(2 * time.Hour)
+	backoff.Failure("b")
+	assert.NotContains(t, backoff.failures, "a")
+	assert.Contains(t, backoff.failures, "b")
+}
@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idleTimeout is the time after which the state of an unused key is dropped.
+const idleTimeout = 10 * time.Minute
+
+// Limiter is a token bucket rate limiter keeping one bucket per key, such as
+// a client IP or a user ID. Every key may burst up to Burst requests, then
+// gets Rate requests per second.
+type Limiter struct {
+	Rate  float64 // Requests allowed per second once the burst is used
+	Burst int     // Requests allowed at once
+
+	mutex     sync.Mutex
+	buckets   map[string]*bucket // Buckets, keyed by key
+	lastSweep time.Time          // Time idle buckets were last dropped
+	now       func() time.Time
+}
+
+// bucket holds the tokens of a single key.
+type bucket struct {
+	tokens float64   // Available tokens
+	last   time.Time // Time the tokens were last refilled
+}
+
+// NewLimiter creates a limiter allowing requests requests per interval, with
+// bursts of up to burst requests.
+func NewLimiter(requests int, interval time.Duration, burst int) *Limiter {
+	return &Limiter{
+		Rate:    float64(requests) / interval.Seconds(),
+		Burst:   burst,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow consumes a token for the key. If none is available it returns false
+// and the time until the next token.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets that have been full for a while.
+// The caller must hold the mutex.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleTimeout {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Middleware returns a Gin middleware limiting the requests of every key.
+// Rejected requests get 429 Too Many Requests with a Retry-After header.
+func Middleware(limiter *Limiter, key func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ok, wait := limiter.Allow(key(c)); !ok {
+			SetRetryAfter(c.Writer, wait)
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many requests, try again later"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Handler wraps an http handler, such as a websocket endpoint, limiting the
+// requests of every key.
+func Handler(limiter *Limiter, key func(r *http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := limiter.Allow(key(r)); !ok {
+			SetRetryAfter(w, wait)
+			http.Error(w, "too many requests, try again later", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// ClientIP is a key function limiting Gin requests per client IP.
+// Forwarding headers are only honored for the trusted proxies of the engine,
+// otherwise clients could pick a new key for every request.
+func ClientIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// RemoteIP is a key function limiting http requests per remote IP.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// SetRetryAfter sets the Retry-After header, rounding up to the second.
+func SetRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
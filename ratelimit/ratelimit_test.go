@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Now()
+	limiter := NewLimiter(1, time.Second, 2)
+	limiter.now = func() time.Time { return now }
+
+	// The burst is allowed at once
+	ok, _ := limiter.Allow("a")
+	assert.True(t, ok)
+	ok, _ = limiter.Allow("a")
+	assert.True(t, ok)
+	ok, wait := limiter.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+
+	// Keys have their own buckets
+	ok, _ = limiter.Allow("b")
+	assert.True(t, ok)
+
+	// Tokens are refilled over time
+	now = now.Add(time.Second)
+	ok, _ = limiter.Allow("a")
+	assert.True(t, ok)
+	ok, _ = limiter.Allow("a")
+	assert.False(t, ok)
+}
+
+func TestLimiterDropsIdleBuckets(t *testing.T) {
+	now := time.Now()
+	limiter := NewLimiter(1, time.Minute, 1)
+	limiter.now = func() time.Time { return now }
+
+	limiter.Allow("a")
+	now = now.Add(2 * idleTimeout)
+	limiter.Allow("b")
+	assert.NotContains(t, limiter.buckets, "a")
+	assert.Contains(t, limiter.buckets, "b")
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", Middleware(NewLimiter(1, time.Minute, 1), ClientIP), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:40000"
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "60", resp.Header().Get("Retry-After"))
+
+	// Other clients are not affected
+	req.RemoteAddr = "192.0.2.2:40000"
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestMiddleware_SpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	require.NoError(t, router.SetTrustedProxies([]string{"192.0.2.10"}))
+	router.GET("/", Middleware(NewLimiter(1, time.Minute, 1), ClientIP), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	serve := func(remoteAddr, forwardedFor string) int {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	// A direct client cannot get a new bucket by forging the header
+	assert.Equal(t, http.StatusOK, serve("192.0.2.1:40000", "198.51.100.1"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("192.0.2.1:40000", "198.51.100.2"))
+
+	// Behind a trusted proxy, clients are told apart by the header
+	assert.Equal(t, http.StatusOK, serve("192.0.2.10:40000", "198.51.100.3"))
+	assert.Equal(t, http.StatusOK, serve("192.0.2.10:40000", "198.51.100.4"))
+	assert.Equal(t, http.StatusTooManyRequests, serve("192.0.2.10:40000", "198.51.100.4"))
+}
+
+func TestHandler(t *testing.T) {
+	handler := Handler(NewLimiter(1, time.Minute, 1), RemoteIP, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/compile", nil)
+	resp := httptest.NewRecorder()
+	handler(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	resp = httptest.NewRecorder()
+	handler(resp, req)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.NotEmpty(t, resp.Header().Get("Retry-After"))
+}
@@ -0,0 +1,367 @@
+package signaling
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/auth"
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// Signal types exchanged over the signaling websocket.
+// Offers, answers and ICE candidates are addressed to a single peer,
+// every other signal is broadcast to the whole room.
+const (
+	SignalOffer        = "offer"         // SDP offer addressed to a single peer
+	SignalAnswer       = "answer"        // SDP answer addressed to a single peer
+	SignalICECandidate = "ice-candidate" // ICE candidate addressed to a single peer
+	SignalCallStart    = "call-start"    // A peer started a call in the room
+	SignalCallEnd      = "call-end"      // The call in the room has ended, sent by the peer who started it or the host
+	SignalMediaState   = "media-state"   // A peer changed its mute/camera state
+	SignalPeerJoined   = "peer-joined"   // A peer connected to the signaling channel
+	SignalPeerLeft     = "peer-left"     // A peer disconnected from the signaling channel
+	SignalError        = "error"         // The server rejected a signal
+)
+
+// Signal is the envelope for every message sent over the signaling websocket.
+// The payload is opaque to the server for SDP and ICE messages: media stays
+// peer-to-peer and the backend only relays the negotiation.
+type Signal struct {
+	Type    string          `json:"type"`              // One of the Signal* constants
+	From    string          `json:"from,omitempty"`    // Sender peer ID, always set by the server
+	To      string          `json:"to,omitempty"`      // Target peer ID for offers, answers and ICE candidates
+	RoomID  string          `json:"room_id,omitempty"` // Room the signal belongs to, always set by the server
+	Payload json.RawMessage `json:"payload,omitempty"` // SDP, ICE candidate or media state
+}
+
+// MediaState describes the audio/video state of a peer in a call.
+type MediaState struct {
+	AudioMuted   bool `json:"audio_muted"`   // Indicates whether the peer muted its microphone
+	VideoEnabled bool `json:"video_enabled"` // Indicates whether the peer's camera is on
+}
+
+// client is a single signaling websocket connection.
+type client struct {
+	peerID string
+	conn   *websocket.Conn
+	mutex  sync.Mutex // Serializes writes to the connection
+}
+
+// send writes a signal to the client connection.
+func (c *client) send(signal Signal) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.conn.WriteJSON(signal)
+}
+
+// close sends a close message with the code and reason to the client.
+func (c *client) close(code int, reason string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+}
+
+// call holds the signaling state of a single room.
+type call struct {
+	clients map[string]*client     // Connected clients, keyed by peer ID
+	active  bool                   // Indicates whether a call is in progress
+	starter string                 // Peer who started the call in progress
+	media   map[string]*MediaState // Last known media state, keyed by peer ID
+}
+
+// Server relays WebRTC signaling messages between the peers of a room.
+// Only peers that are members of the room in the TCPTransport may connect, and
+// peers who leave the room stop receiving its signals and are disconnected
+// once they send one.
+type Server struct {
+	TCPTransport *network.TCPTransport // Reference to the TCPTransport instance
+	mutex        sync.Mutex            // Mutex for safe access to the calls map
+	calls        map[string]*call      // Signaling state, keyed by room ID
+}
+
+// NewServer creates a new signaling server backed by the provided transport.
+func NewServer(transport *network.TCPTransport) *Server {
+	return &Server{
+		TCPTransport: transport,
+		calls:        make(map[string]*call),
+	}
+}
+
+// Configure the WebSocket upgrader
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// HandleSignaling upgrades the request to a websocket and relays signals for the peer.
+// The peer is the one authenticated by the auth websocket middleware, the room is
+// taken from the "room_id" query parameter and the peer must already be a member of it.
+func (s *Server) HandleSignaling(w http.ResponseWriter, r *http.Request) {
+	peer := auth.PeerFromRequest(r)
+	if peer == nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+	roomID := r.URL.Query().Get("room_id")
+	peerID := peer.ID
+
+	if err := s.checkMembership(roomID, peerID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade to WebSocket: %v", err)
+		return
+	}
+	defer conn.Close()
+	// Disconnect as soon as the session is revoked
+	auth.CloseOnRevoke(r, conn)
+
+	c := &client{peerID: peerID, conn: conn}
+	if err := s.register(roomID, c); err != nil {
+		c.send(Signal{Type: SignalError, RoomID: roomID, Payload: errorPayload(err)})
+		return
+	}
+	defer s.unregister(roomID, c)
+
+	for {
+		var signal Signal
+		if err := conn.ReadJSON(&signal); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("error: %v", err)
+			}
+			return
+		}
+		// Peers who left the room since they connected can no longer signal
+		if s.checkMembership(roomID, peerID) != nil {
+			c.close(websocket.ClosePolicyViolation, "no longer a member of the room")
+			return
+		}
+
+		if err := s.handleSignal(roomID, c, signal); err != nil {
+			c.send(Signal{Type: SignalError, RoomID: roomID, Payload: errorPayload(err)})
+		}
+	}
+}
+
+// checkMembership returns an error if the peer is not a member of the room.
+func (s *Server) checkMembership(roomID, peerID string) error {
+	if roomID == "" {
+		return fmt.Errorf("room_id is required")
+	}
+
+	s.TCPTransport.Mutex.Lock()
+	defer s.TCPTransport.Mutex.Unlock()
+
+	room, ok := s.TCPTransport.Rooms[roomID]
+	if !ok {
+		return fmt.Errorf("room %s does not exist", roomID)
+	}
+	if _, exists := room.Peers[peerID]; !exists {
+		return fmt.Errorf("peer %s is not in room %s", peerID, roomID)
+	}
+	return nil
+}
+
+// register adds the client to the room and notifies the other peers.
+// The new client receives the current call state of every connected peer.
+func (s *Server) register(roomID string, c *client) error {
+	s.mutex.Lock()
+	room, ok := s.calls[roomID]
+	if !ok {
+		room = &call{
+			clients: make(map[string]*client),
+			media:   make(map[string]*MediaState),
+		}
+		s.calls[roomID] = room
+	}
+	if _, exists := room.clients[c.peerID]; exists {
+		s.mutex.Unlock()
+		return fmt.Errorf("peer %s is already connected to room %s", c.peerID, roomID)
+	}
+	room.clients[c.peerID] = c
+
+	// Snapshot the state for the new client while holding the lock
+	var snapshot []Signal
+	for peerID := range room.clients {
+		if peerID == c.peerID {
+			continue
+		}
+		snapshot = append(snapshot, Signal{Type: SignalPeerJoined, From: peerID, RoomID: roomID})
+		if state, ok := room.media[peerID]; ok {
+			snapshot = append(snapshot, Signal{Type: SignalMediaState, From: peerID, RoomID: roomID, Payload: mustMarshal(state)})
+		}
+	}
+	if room.active {
+		snapshot = append(snapshot, Signal{Type: SignalCallStart, RoomID: roomID})
+	}
+	s.mutex.Unlock()
+
+	for _, signal := range snapshot {
+		c.send(signal)
+	}
+	s.broadcast(roomID, Signal{Type: SignalPeerJoined, From: c.peerID, RoomID: roomID}, c.peerID)
+	return nil
+}
+
+// unregister removes the client from the room and notifies the other peers.
+// The call ends automatically once the last peer disconnects.
+func (s *Server) unregister(roomID string, c *client) {
+	s.mutex.Lock()
+	room, ok := s.calls[roomID]
+	if !ok || room.clients[c.peerID] != c {
+		s.mutex.Unlock()
+		return
+	}
+	delete(room.clients, c.peerID)
+	delete(room.media, c.peerID)
+	empty := len(room.clients) == 0
+	if empty {
+		delete(s.calls, roomID)
+	}
+	s.mutex.Unlock()
+
+	if !empty {
+		s.broadcast(roomID, Signal{Type: SignalPeerLeft, From: c.peerID, RoomID: roomID}, c.peerID)
+	}
+}
+
+// handleSignal validates a signal received from a client and relays it.
+func (s *Server) handleSignal(roomID string, c *client, signal Signal) error {
+	// Never trust the sender and room supplied by the client
+	signal.From = c.peerID
+	signal.RoomID = roomID
+
+	switch signal.Type {
+	case SignalOffer, SignalAnswer, SignalICECandidate:
+		if len(signal.Payload) == 0 {
+			return fmt.Errorf("%s requires a payload", signal.Type)
+		}
+		return s.relay(roomID, signal)
+	case SignalCallStart:
+		s.mutex.Lock()
+		if room := s.calls[roomID]; !room.active {
+			room.active = true
+			room.starter = c.peerID
+		}
+		s.mutex.Unlock()
+		s.broadcast(roomID, signal, c.peerID)
+	case SignalCallEnd:
+		hostID := s.hostID(roomID)
+		s.mutex.Lock()
+		room := s.calls[roomID]
+		if c.peerID != room.starter && c.peerID != hostID {
+			s.mutex.Unlock()
+			return fmt.Errorf("only the peer who started the call or the host of the room can end it")
+		}
+		room.active = false
+		room.starter = ""
+		room.media = make(map[string]*MediaState)
+		s.mutex.Unlock()
+		s.broadcast(roomID, signal, c.peerID)
+	case SignalMediaState:
+		var state MediaState
+		if err := json.Unmarshal(signal.Payload, &state); err != nil {
+			return fmt.Errorf("invalid media state: %v", err)
+		}
+		s.mutex.Lock()
+		s.calls[roomID].media[c.peerID] = &state
+		s.mutex.Unlock()
+		signal.Payload = mustMarshal(state)
+		s.broadcast(roomID, signal, c.peerID)
+	default:
+		return fmt.Errorf("unsupported signal type %q", signal.Type)
+	}
+	return nil
+}
+
+// relay forwards a signal to its target peer in the room.
+func (s *Server) relay(roomID string, signal Signal) error {
+	if signal.To == "" {
+		return fmt.Errorf("%s requires a target peer", signal.Type)
+	}
+
+	s.mutex.Lock()
+	target, ok := s.calls[roomID].clients[signal.To]
+	s.mutex.Unlock()
+	if ok {
+		ok = len(s.members(roomID, []*client{target})) > 0
+	}
+	if !ok {
+		return fmt.Errorf("peer %s is not connected to room %s", signal.To, roomID)
+	}
+	return target.send(signal)
+}
+
+// broadcast sends a signal to every client in the room except the excluded peer.
+func (s *Server) broadcast(roomID string, signal Signal, exclude string) {
+	s.mutex.Lock()
+	room, ok := s.calls[roomID]
+	var targets []*client
+	if ok {
+		for peerID, c := range room.clients {
+			if peerID != exclude {
+				targets = append(targets, c)
+			}
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, c := range s.members(roomID, targets) {
+		if err := c.send(signal); err != nil {
+			log.Printf("error: %v", err)
+		}
+	}
+}
+
+// members returns the clients whose peer is still a member of the room, so the
+// peers who left it stop receiving its signals.
+func (s *Server) members(roomID string, clients []*client) []*client {
+	s.TCPTransport.Mutex.Lock()
+	defer s.TCPTransport.Mutex.Unlock()
+
+	room, ok := s.TCPTransport.Rooms[roomID]
+	if !ok {
+		return nil
+	}
+	var kept []*client
+	for _, c := range clients {
+		if _, member := room.Peers[c.peerID]; member {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// hostID returns the ID of the host of the room, empty if unknown.
+func (s *Server) hostID(roomID string) string {
+	s.TCPTransport.Mutex.Lock()
+	defer s.TCPTransport.Mutex.Unlock()
+
+	if room, ok := s.TCPTransport.Rooms[roomID]; ok && room.Host != nil {
+		return room.Host.ID
+	}
+	return ""
+}
+
+// errorPayload wraps an error into a JSON payload.
+func errorPayload(err error) json.RawMessage {
+	return mustMarshal(map[string]string{"error": err.Error()})
+}
+
+// mustMarshal marshals values that are known to be JSON encodable.
+func mustMarshal(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
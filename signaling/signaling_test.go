@@ -0,0 +1,213 @@
+package signaling
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Rishi-Mishra0704/code-collab-backend/auth"
+	"github.com/Rishi-Mishra0704/code-collab-backend/network"
+)
+
+// setupRoom creates a server with a room containing the host and one guest.
+func setupRoom(t *testing.T) (*httptest.Server, string, *network.TCPTransport) {
+	transport := network.NewTCPTransport()
+	host := &network.Peer{ID: "host", Name: "Host", Email: "host@example.com", Address: "127.0.0.1:9000"}
+	roomID, err := transport.CreateRoom(host)
+	require.NoError(t, err)
+	require.NoError(t, transport.JoinRoom(roomID, &network.Peer{ID: "guest"}))
+
+	server := httptest.NewServer(withPeerFromQuery(NewServer(transport).HandleSignaling))
+	t.Cleanup(server.Close)
+	return server, roomID, transport
+}
+
+// withPeerFromQuery authenticates the peer named by the "peer_id" query parameter,
+// standing in for the auth websocket middleware.
+func withPeerFromQuery(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if peerID := r.URL.Query().Get("peer_id"); peerID != "" {
+			r = r.WithContext(auth.WithPeer(r.Context(), &network.Peer{ID: peerID}))
+		}
+		next(w, r)
+	}
+}
+
+// dial connects a peer to the signaling server.
+func dial(t *testing.T, server *httptest.Server, roomID, peerID string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "?room_id=" + roomID + "&peer_id=" + peerID
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readSignal reads the next signal from the connection.
+func readSignal(t *testing.T, conn *websocket.Conn) Signal {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var signal Signal
+	require.NoError(t, conn.ReadJSON(&signal))
+	return signal
+}
+
+func TestHandleSignaling_RejectsNonMembers(t *testing.T) {
+	server, roomID, _ := setupRoom(t)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "?room_id=" + roomID + "&peer_id=stranger"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	url = "ws" + strings.TrimPrefix(server.URL, "http") + "?room_id=nonexistent&peer_id=host"
+	_, resp, err = websocket.DefaultDialer.Dial(url, nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	url = "ws" + strings.TrimPrefix(server.URL, "http") + "?room_id=" + roomID
+	_, resp, err = websocket.DefaultDialer.Dial(url, nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestHandleSignaling_RelaysOfferAnswerAndCandidates(t *testing.T) {
+	server, roomID, _ := setupRoom(t)
+
+	host := dial(t, server, roomID, "host")
+	guest := dial(t, server, roomID, "guest")
+
+	// The host is told about the guest, the guest about the host
+	joined := readSignal(t, host)
+	assert.Equal(t, SignalPeerJoined, joined.Type)
+	assert.Equal(t, "guest", joined.From)
+	joined = readSignal(t, guest)
+	assert.Equal(t, SignalPeerJoined, joined.Type)
+	assert.Equal(t, "host", joined.From)
+
+	// Offer from host to guest, with a spoofed sender that must be overwritten
+	offer := Signal{Type: SignalOffer, From: "spoofed", To: "guest", Payload: json.RawMessage(`{"sdp":"fake-offer"}`)}
+	require.NoError(t, host.WriteJSON(offer))
+	received := readSignal(t, guest)
+	assert.Equal(t, SignalOffer, received.Type)
+	assert.Equal(t, "host", received.From)
+	assert.Equal(t, roomID, received.RoomID)
+	assert.JSONEq(t, `{"sdp":"fake-offer"}`, string(received.Payload))
+
+	// Answer from guest to host
+	require.NoError(t, guest.WriteJSON(Signal{Type: SignalAnswer, To: "host", Payload: json.RawMessage(`{"sdp":"fake-answer"}`)}))
+	received = readSignal(t, host)
+	assert.Equal(t, SignalAnswer, received.Type)
+	assert.Equal(t, "guest", received.From)
+
+	// ICE candidate from guest to host
+	require.NoError(t, guest.WriteJSON(Signal{Type: SignalICECandidate, To: "host", Payload: json.RawMessage(`{"candidate":"fake"}`)}))
+	received = readSignal(t, host)
+	assert.Equal(t, SignalICECandidate, received.Type)
+}
+
+func TestHandleSignaling_CallEventsAndMediaState(t *testing.T) {
+	server, roomID, _ := setupRoom(t)
+
+	host := dial(t, server, roomID, "host")
+	guest := dial(t, server, roomID, "guest")
+	readSignal(t, host)
+	readSignal(t, guest)
+
+	require.NoError(t, host.WriteJSON(Signal{Type: SignalCallStart}))
+	assert.Equal(t, SignalCallStart, readSignal(t, guest).Type)
+
+	require.NoError(t, guest.WriteJSON(Signal{Type: SignalMediaState, Payload: json.RawMessage(`{"audio_muted":true,"video_enabled":false}`)}))
+	received := readSignal(t, host)
+	assert.Equal(t, SignalMediaState, received.Type)
+	assert.Equal(t, "guest", received.From)
+	var state MediaState
+	require.NoError(t, json.Unmarshal(received.Payload, &state))
+	assert.True(t, state.AudioMuted)
+	assert.False(t, state.VideoEnabled)
+
+	require.NoError(t, host.WriteJSON(Signal{Type: SignalCallEnd}))
+	assert.Equal(t, SignalCallEnd, readSignal(t, guest).Type)
+
+	// Leaving notifies the remaining peers
+	guest.Close()
+	left := readSignal(t, host)
+	assert.Equal(t, SignalPeerLeft, left.Type)
+	assert.Equal(t, "guest", left.From)
+}
+
+func TestHandleSignaling_Errors(t *testing.T) {
+	server, roomID, _ := setupRoom(t)
+
+	host := dial(t, server, roomID, "host")
+
+	// Offer to a peer that is not connected
+	require.NoError(t, host.WriteJSON(Signal{Type: SignalOffer, To: "guest", Payload: json.RawMessage(`{"sdp":"fake"}`)}))
+	assert.Equal(t, SignalError, readSignal(t, host).Type)
+
+	// Offer without payload
+	require.NoError(t, host.WriteJSON(Signal{Type: SignalOffer, To: "guest"}))
+	assert.Equal(t, SignalError, readSignal(t, host).Type)
+
+	// Unknown signal type
+	require.NoError(t, host.WriteJSON(Signal{Type: "unknown"}))
+	assert.Equal(t, SignalError, readSignal(t, host).Type)
+}
+
+func TestHandleSignaling_CallEndedByStarterOrHost(t *testing.T) {
+	server, roomID, transport := setupRoom(t)
+	require.NoError(t, transport.JoinRoom(roomID, &network.Peer{ID: "other"}))
+
+	host := dial(t, server, roomID, "host")
+	guest := dial(t, server, roomID, "guest")
+	other := dial(t, server, roomID, "other")
+	readSignal(t, host)
+	readSignal(t, host)
+	readSignal(t, guest)
+	readSignal(t, guest)
+	readSignal(t, other)
+	readSignal(t, other)
+
+	// Only the guest who started the call and the host can end it
+	require.NoError(t, guest.WriteJSON(Signal{Type: SignalCallStart}))
+	assert.Equal(t, SignalCallStart, readSignal(t, host).Type)
+	assert.Equal(t, SignalCallStart, readSignal(t, other).Type)
+	require.NoError(t, other.WriteJSON(Signal{Type: SignalCallEnd}))
+	assert.Equal(t, SignalError, readSignal(t, other).Type)
+	require.NoError(t, guest.WriteJSON(Signal{Type: SignalCallEnd}))
+	assert.Equal(t, SignalCallEnd, readSignal(t, host).Type)
+	assert.Equal(t, SignalCallEnd, readSignal(t, other).Type)
+
+	require.NoError(t, other.WriteJSON(Signal{Type: SignalCallStart}))
+	assert.Equal(t, SignalCallStart, readSignal(t, guest).Type)
+	require.NoError(t, host.WriteJSON(Signal{Type: SignalCallEnd}))
+	assert.Equal(t, SignalCallEnd, readSignal(t, guest).Type)
+}
+
+func TestHandleSignaling_PeersWhoLeft(t *testing.T) {
+	server, roomID, transport := setupRoom(t)
+
+	host := dial(t, server, roomID, "host")
+	guest := dial(t, server, roomID, "guest")
+	readSignal(t, host)
+	readSignal(t, guest)
+	require.NoError(t, transport.LeaveRoom(roomID, "guest"))
+
+	// The guest no longer receives the signals of the room
+	require.NoError(t, host.WriteJSON(Signal{Type: SignalOffer, To: "guest", Payload: json.RawMessage(`{"sdp":"fake"}`)}))
+	assert.Equal(t, SignalError, readSignal(t, host).Type)
+
+	// And is disconnected as soon as it signals
+	require.NoError(t, guest.WriteJSON(Signal{Type: SignalCallEnd}))
+	guest.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := guest.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "%v", err)
+	left := readSignal(t, host)
+	assert.Equal(t, SignalPeerLeft, left.Type)
+	assert.Equal(t, "guest", left.From)
+}